@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// TokenTypeAPIKey - token_type claims, построенных по API-ключу.
+	TokenTypeAPIKey = "api_key"
+	// APIKeyPrefix начинает каждый API-ключ, чтобы его можно было опознать в логах и конфигурации.
+	APIKeyPrefix = "tss_"
+
+	// apiKeyDisplayLength - длина начала ключа, которое хранится открыто и показывается в списке ключей.
+	apiKeyDisplayLength = len(APIKeyPrefix) + 8
+)
+
+// ErrAPIKeyNotFound возвращается APIKeyStore, если ключа нет в хранилище.
+var ErrAPIKeyNotFound = fmt.Errorf("%w: API key not found", ErrInvalidToken)
+
+// APIKey - долгоживущий ключ пользователя для сервисных учетных записей. Хранится только
+// SHA-256 хеш ключа и его начало Prefix. Пустой ExpiresAt - ключ бессрочный.
+// TokenVersion - версия токенов пользователя при создании ключа: как и токены, ключ
+// перестает действовать после увеличения версии (сброса пароля, выхода на всех устройствах).
+type APIKey struct {
+	ID           string
+	Username     string
+	Name         string
+	Prefix       string
+	Hash         string
+	Scopes       []string
+	TokenVersion int64
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+}
+
+// APIKeyStore ищет API-ключи по хешу и версии токенов их владельцев, например repository.AuthRepository.
+// GetAPIKey возвращает ErrAPIKeyNotFound для неизвестного хеша.
+type APIKeyStore interface {
+	TokenVersions
+	GetAPIKey(hash string) (*APIKey, error)
+}
+
+// GenerateAPIKey создает новый ключ и возвращает его вместе с записью для хранилища.
+// Сам ключ нигде не сохраняется и показывается пользователю один раз.
+func GenerateAPIKey(id, username string) (string, *APIKey, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	key := APIKeyPrefix + b64.EncodeToString(buf)
+	return key, &APIKey{
+		ID:       id,
+		Username: username,
+		Prefix:   key[:apiKeyDisplayLength],
+		Hash:     HashAPIKey(key),
+	}, nil
+}
+
+// HashAPIKey возвращает хеш, под которым API-ключ хранится в APIKeyStore.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuthenticateAPIKey находит ключ в store и возвращает claims, равноценные access-токену
+// пользователя с разрешениями ключа. Истекший ключ отклоняется с ErrTokenExpired, ключ,
+// созданный до увеличения версии токенов владельца, - с ErrTokenRevoked.
+func AuthenticateAPIKey(store APIKeyStore, key string, now time.Time) (*Claims, error) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return nil, ErrTokenMalformed
+	}
+	stored, err := store.GetAPIKey(HashAPIKey(key))
+	if err != nil {
+		return nil, err
+	}
+	if !stored.ExpiresAt.IsZero() && !now.Before(stored.ExpiresAt) {
+		return nil, ErrTokenExpired
+	}
+	version, err := store.GetTokenVersion(stored.Username)
+	if err != nil {
+		return nil, fmt.Errorf("load token version of '%s': %w", stored.Username, err)
+	}
+	if stored.TokenVersion < version {
+		return nil, ErrTokenRevoked
+	}
+	return stored.Claims(), nil
+}
+
+// Claims возвращает claims, которые получает запрос, аутентифицированный ключом.
+func (k *APIKey) Claims() *Claims {
+	claims := &Claims{
+		Username:     k.Username,
+		TokenType:    TokenTypeAPIKey,
+		Scope:        strings.Join(k.Scopes, " "),
+		TokenVersion: k.TokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       k.ID,
+			Subject:  k.Username,
+			IssuedAt: jwt.NewNumericDate(k.CreatedAt),
+		},
+	}
+	if !k.ExpiresAt.IsZero() {
+		claims.ExpiresAt = jwt.NewNumericDate(k.ExpiresAt)
+	}
+	return claims
+}
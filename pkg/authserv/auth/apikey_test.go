@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryAPIKeyStore - APIKeyStore в памяти.
+type memoryAPIKeyStore struct {
+	memoryTokenVersions
+	keys map[string]APIKey
+}
+
+func (s memoryAPIKeyStore) GetAPIKey(hash string) (*APIKey, error) {
+	key, ok := s.keys[hash]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	return &key, nil
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	key, apiKey, err := GenerateAPIKey("key-1", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, APIKeyPrefix) || !strings.HasPrefix(key, apiKey.Prefix) || apiKey.Hash != HashAPIKey(key) {
+		t.Fatalf("key %q does not match record %+v", key, apiKey)
+	}
+	if strings.Contains(apiKey.Hash, key) || len(apiKey.Prefix) >= len(key) {
+		t.Fatal("record contains the key")
+	}
+	apiKey.Scopes = []string{"orders:read", "orders:write"}
+	apiKey.CreatedAt = now.Add(-time.Hour)
+
+	expiredKey, expired, err := GenerateAPIKey("key-2", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired.ExpiresAt = now
+
+	// Ключ, созданный до выхода на всех устройствах.
+	revokedKey, revoked, err := GenerateAPIKey("key-3", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiKey.TokenVersion, revoked.TokenVersion = 2, 1
+
+	store := memoryAPIKeyStore{
+		memoryTokenVersions: memoryTokenVersions{"alice": 2},
+		keys:                map[string]APIKey{apiKey.Hash: *apiKey, expired.Hash: *expired, revoked.Hash: *revoked},
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		wantErr error
+	}{
+		{"valid key", key, nil},
+		{"expired key", expiredKey, ErrTokenExpired},
+		{"key of previous token version", revokedKey, ErrTokenRevoked},
+		{"unknown key", APIKeyPrefix + "unknown", ErrAPIKeyNotFound},
+		{"jwt instead of key", "eyJhbGciOiJIUzI1NiJ9.e30.sig", ErrTokenMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := AuthenticateAPIKey(store, tt.key, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AuthenticateAPIKey err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("AuthenticateAPIKey err = %v does not wrap ErrInvalidToken", err)
+				}
+				return
+			}
+			if claims.Username != "alice" || claims.TokenType != TokenTypeAPIKey || claims.ID != "key-1" || claims.TokenVersion != 2 {
+				t.Errorf("claims = %+v", claims)
+			}
+			if !claims.HasScope("orders:write") || claims.ExpiresAt != nil {
+				t.Errorf("scope = %q, exp = %v, want both scopes and no expiry", claims.Scope, claims.ExpiresAt)
+			}
+		})
+	}
+}
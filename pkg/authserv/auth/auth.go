@@ -2,57 +2,411 @@ package auth
 
 import (
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultAccessTTL  = 15 * time.Minute
+	DefaultRefreshTTL = 7 * 24 * time.Hour
+
+	// minSecretLength - минимальная длина HMAC-секрета для HS256 (RFC 7518, 3.2).
+	minSecretLength = 32
+)
+
+var (
+	ErrNoSecret       = errors.New("no signing keys are configured")
+	ErrSecretTooShort = fmt.Errorf("secret must be at least %d bytes long", minSecretLength)
+)
+
+// Типы токенов в claim token_type.
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
 )
 
 type Claims struct {
-	Username string `json:"username"`
+	// Username заполняется только в токенах пользователей, для OAuth-клиентов субъект - в sub.
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type"`
+	// FamilyID связывает все токены, полученные из одного входа через цепочку refresh.
+	FamilyID string   `json:"fid,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+	// Scope - список разрешений через пробел (RFC 8693, 4.2).
+	Scope string `json:"scope,omitempty"`
+	// ClientID - OAuth-клиент, которому выдан токен (RFC 9068, 2.2).
+	ClientID string `json:"client_id,omitempty"`
+	// TokenVersion - версия токенов пользователя на момент выпуска (см. TokenVersions).
+	TokenVersion int64 `json:"token_version,omitempty"`
+	// Confirmation привязывает токен к ключу DPoP клиента (RFC 9449, 6).
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+	// Actor - сторона, действующая от имени субъекта токена (RFC 8693, 4.1).
+	Actor *Actor `json:"act,omitempty"`
+	// Email и EmailVerified - адрес пользователя и подтвержден ли он (OpenID Connect Core 1.0, 5.1).
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified,omitempty"`
 	jwt.RegisteredClaims
 }
 
-var jwtKey = []byte("my_secret_key")
+// Scopes возвращает разрешения из claim scope.
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
 
-func GenerateToken(username string) (string, string, error) {
-	accessTokenExpiration := time.Now().Add(15 * time.Minute)
-	accessClaims := &Claims{
-		Username: username,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(accessTokenExpiration),
-		},
+// ClientSubjectPrefix отличает субъекты OAuth-клиентов от имен пользователей в claim sub,
+// чтобы клиент с идентификатором, совпадающим с именем пользователя, не получил его права.
+const ClientSubjectPrefix = "client:"
+
+// ClientSubject возвращает субъект токенов, выданных клиенту clientID от его собственного имени.
+func ClientSubject(clientID string) string {
+	return ClientSubjectPrefix + clientID
+}
+
+// HasScope сообщает, содержит ли токен разрешение scope.
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes(), scope)
+}
+
+// HasRole сообщает, содержит ли токен роль role.
+func (c *Claims) HasRole(role string) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+// DPoPKey возвращает thumbprint ключа DPoP, к которому привязан токен, или пустую строку.
+func (c *Claims) DPoPKey() string {
+	if c.Confirmation == nil {
+		return ""
+	}
+	return c.Confirmation.JKT
+}
+
+// TokenPair - выпущенные access- и refresh-токены вместе с их claims.
+type TokenPair struct {
+	AccessToken   string
+	RefreshToken  string
+	AccessClaims  *Claims
+	RefreshClaims *Claims
+}
+
+// Validator проверяет токен и возвращает его claims.
+type Validator interface {
+	ValidateToken(tokenString string, opts ...ValidateOption) (*Claims, error)
+}
+
+// Config содержит параметры для выпуска и проверки токенов.
+// Ключи берутся из первого заданного источника: KeyStore, KeySet, SigningKey, Secret.
+type Config struct {
+	// KeyStore - общее хранилище ключей с плановой ротацией по Rotation.
+	// Ключи в нем шифруются KeyCipher, без которого KeyStore использовать нельзя.
+	KeyStore   KeyStore
+	KeyCipher  *KeyCipher
+	Rotation   RotationConfig
+	KeySet     *KeySet
+	SigningKey *SigningKey
+	Secret     SecretProvider
+	// KeyID попадает в заголовок kid токенов, подписанных секретом из Secret.
+	KeyID      string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	Issuer     string
+	Audience   string
+	// Leeway - допуск на расхождение часов при проверке токенов.
+	Leeway time.Duration
+	// Clock - источник текущего времени, по умолчанию time.Now.
+	Clock func() time.Time
+	// RoleScopes - разрешения, которые получают пользователи с данной ролью.
+	RoleScopes map[string][]string
+	// TokenFormat - формат access- и refresh-токенов: TokenFormatJWT (по умолчанию), TokenFormatOpaque,
+	// TokenFormatPASETOPublic или TokenFormatPASETOLocal. ID Token всегда выпускается в виде JWT.
+	TokenFormat string
+	// TokenStore хранит opaque-токены, обязателен для TokenFormatOpaque.
+	TokenStore TokenStore
+	// TokenVersions - версии токенов пользователей. Если задано, токены пользователя
+	// с версией ниже текущей не проходят ValidateToken. Обязательно для authserv.Run:
+	// без него сброс пароля и выход на всех устройствах не отзывают выданные ранее access-токены.
+	// Смена пароля версию не меняет, чтобы не завершать текущую сессию: с revoke_other_sessions
+	// она отзывает семейства токенов остальных сессий.
+	TokenVersions TokenVersions
+	// OpenIDConnect включает выпуск ID Token. Требует Issuer и асимметричный активный ключ
+	// (а при KeyStore - асимметричный Rotation.Algorithm): клиенты проверяют ID Token по JWKS,
+	// в котором HMAC-ключ не публикуется.
+	OpenIDConnect bool
+}
+
+// Issuer выпускает и проверяет токены согласно Config.
+type Issuer struct {
+	keys       *KeySet
+	format     tokenFormat
+	versions   TokenVersions
+	store      KeyStore
+	keyCipher  *KeyCipher
+	rotation   RotationConfig
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	issuer     string
+	audience   string
+	leeway     time.Duration
+	clock      func() time.Time
+	roleScopes map[string][]string
+	openID     bool
+}
+
+// NewIssuer загружает ключи подписи и создает Issuer. Нулевые TTL заменяются значениями по умолчанию.
+// При заданном KeyStore и пустом хранилище создается первый ключ.
+func NewIssuer(config Config) (*Issuer, error) {
+	issuer := &Issuer{
+		store:      config.KeyStore,
+		keyCipher:  config.KeyCipher,
+		rotation:   config.Rotation,
+		accessTTL:  config.AccessTTL,
+		refreshTTL: config.RefreshTTL,
+		issuer:     config.Issuer,
+		audience:   config.Audience,
+		leeway:     config.Leeway,
+		clock:      config.Clock,
+		roleScopes: config.RoleScopes,
+		versions:   config.TokenVersions,
+		openID:     config.OpenIDConnect,
+	}
+	if issuer.clock == nil {
+		issuer.clock = time.Now
+	}
+	if issuer.accessTTL <= 0 {
+		issuer.accessTTL = DefaultAccessTTL
+	}
+	if issuer.refreshTTL <= 0 {
+		issuer.refreshTTL = DefaultRefreshTTL
+	}
+	if err := issuer.rotation.setAlgorithm(config.TokenFormat); err != nil {
+		return nil, err
+	}
+	if issuer.rotation.Interval <= 0 {
+		issuer.rotation.Interval = DefaultRotationInterval
+	}
+	if issuer.rotation.ActivationDelay <= 0 {
+		issuer.rotation.ActivationDelay = DefaultActivationDelay
+	}
+
+	if config.KeyStore != nil {
+		if config.KeyCipher == nil {
+			return nil, ErrNoKeyCipher
+		}
+		issuer.keys = &KeySet{}
+		err := issuer.SyncKeys()
+		if errors.Is(err, ErrNoActiveKey) {
+			// Первый ключ некому опережать: он подписывает токены сразу.
+			err = issuer.rotateKeys(0)
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		keys, err := loadKeySet(config)
+		if err != nil {
+			return nil, err
+		}
+		issuer.keys = keys
 	}
 
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	accessTokenString, err := accessToken.SignedString(jwtKey)
+	format, err := newTokenFormat(config, issuer.keys)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
+	issuer.format = format
 
-	refreshTokenExpiration := time.Now().Add(7 * 24 * time.Hour)
-	refreshClaims := &Claims{
-		Username: username,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(refreshTokenExpiration),
-		},
+	if config.OpenIDConnect {
+		if err := issuer.checkOpenID(); err != nil {
+			return nil, err
+		}
+	}
+	return issuer, nil
+}
+
+func loadKeySet(config Config) (*KeySet, error) {
+	if config.KeySet != nil {
+		if config.KeySet.Active() == nil {
+			return nil, errors.New("key set has no active key")
+		}
+		return config.KeySet, nil
+	}
+	if config.SigningKey != nil {
+		return NewKeySet(config.SigningKey)
+	}
+	if config.Secret == nil {
+		return nil, ErrNoSecret
+	}
+	secret, err := config.Secret.Secret()
+	if err != nil {
+		return nil, fmt.Errorf("load secret: %w", err)
+	}
+	signingKey, err := NewSigningKey(config.KeyID, AlgHS256, secret)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeySet(signingKey)
+}
+
+// GenerateToken выпускает пару токенов для username. Без WithFamily создается новое семейство токенов.
+func (i *Issuer) GenerateToken(username string, opts ...TokenOption) (*TokenPair, error) {
+	options := newTokenOptions(opts)
+	if options.familyID == "" {
+		options.familyID = uuid.NewString()
+	}
+	version, err := i.tokenVersion(username)
+	if err != nil {
+		return nil, err
+	}
+
+	accessClaims := i.newClaims(username, TokenTypeAccess, i.accessTTL, options)
+	accessClaims.Username = username
+	accessClaims.TokenVersion = version
+	accessTokenString, err := i.format.encode(accessClaims)
+	if err != nil {
+		return nil, err
 	}
 
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	refreshTokenString, err := refreshToken.SignedString(jwtKey)
+	refreshClaims := i.newClaims(username, TokenTypeRefresh, i.refreshTTL, options)
+	refreshClaims.Username = username
+	refreshClaims.TokenVersion = version
+	refreshTokenString, err := i.format.encode(refreshClaims)
 	if err != nil {
-		return "", "", err
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:   accessTokenString,
+		RefreshToken:  refreshTokenString,
+		AccessClaims:  accessClaims,
+		RefreshClaims: refreshClaims,
+	}, nil
+}
+
+// GenerateAccessToken выпускает только access-токен для subject, например для OAuth-клиента.
+func (i *Issuer) GenerateAccessToken(subject string, opts ...TokenOption) (string, *Claims, error) {
+	claims := i.newClaims(subject, TokenTypeAccess, i.accessTTL, newTokenOptions(opts))
+	tokenString, err := i.format.encode(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return tokenString, claims, nil
+}
+
+// ValidateToken проверяет токен в формате Config.TokenFormat, его claims и версию токенов пользователя.
+// Ожидаемые issuer и audience, допуск и часы берутся из Config и могут быть переопределены опциями.
+func (i *Issuer) ValidateToken(tokenString string, opts ...ValidateOption) (*Claims, error) {
+	defaults := validateOptions{
+		issuer:   i.issuer,
+		audience: i.audience,
+		leeway:   i.leeway,
+		clock:    i.clock,
+	}
+	claims, err := i.format.decode(tokenString, newValidateOptions(defaults, opts))
+	if err != nil {
+		return nil, err
+	}
+	if err := i.checkTokenVersion(claims); err != nil {
+		return nil, err
 	}
+	return claims, nil
+}
+
+// Name возвращает значение claim iss выпускаемых токенов.
+func (i *Issuer) Name() string {
+	return i.issuer
+}
+
+// JWKS возвращает открытые ключи Issuer, включая ключи, пригодные только для проверки.
+func (i *Issuer) JWKS() JWKS {
+	return i.keys.JWKS()
+}
+
+func (i *Issuer) newClaims(subject, tokenType string, ttl time.Duration, options *tokenOptions) *Claims {
+	now := i.clock()
+	claims := &Claims{
+		TokenType: tokenType,
+		FamilyID:  options.familyID,
+		Roles:     options.roles,
+		Scope:     strings.Join(i.scopes(options), " "),
+		ClientID:  options.clientID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   subject,
+			Issuer:    i.issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	if i.audience != "" {
+		claims.Audience = jwt.ClaimStrings{i.audience}
+	}
+	if len(options.audience) > 0 {
+		claims.Audience = options.audience
+	}
+	if options.email != "" {
+		claims.Email = options.email
+		claims.EmailVerified = options.emailVerified
+	}
+	if options.dpopJKT != "" {
+		claims.Confirmation = &Confirmation{JKT: options.dpopJKT}
+	}
+	return claims
+}
 
-	return accessTokenString, refreshTokenString, nil
+// scopes объединяет явно запрошенные разрешения и разрешения ролей без повторов.
+// Токены OAuth-клиента содержат только выданные клиенту разрешения.
+func (i *Issuer) scopes(options *tokenOptions) []string {
+	scopes := make([]string, 0, len(options.scopes))
+	add := func(scope string) {
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	for _, scope := range options.scopes {
+		add(scope)
+	}
+	if options.clientID != "" {
+		return scopes
+	}
+	for _, role := range options.roles {
+		for _, scope := range i.roleScopes[role] {
+			add(scope)
+		}
+	}
+	return scopes
 }
 
-func ValidateToken(tokenString string) (*Claims, error) {
+// parseToken проверяет подпись ключом, найденным по kid, и стандартные claims.
+// Алгоритм из заголовка токена обязан совпадать с алгоритмом ключа.
+func parseToken(tokenString string, lookup func(kid string) (*verificationKey, error), options *validateOptions) (*Claims, error) {
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
-	if err != nil || !token.Valid {
-		return nil, errors.New("invalid token")
+		if !options.algorithmAllowed(token.Method.Alg()) {
+			return nil, ErrAlgorithmNotAllowed
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, err := lookup(kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.algorithm {
+			return nil, ErrAlgorithmNotAllowed
+		}
+		return key.key, nil
+	}, options.parserOptions()...)
+	if err != nil {
+		return nil, tokenError(err)
+	}
+	if !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	if options.tokenType != "" && claims.TokenType != options.tokenType {
+		return nil, ErrWrongTokenType
 	}
 	return claims, nil
 }
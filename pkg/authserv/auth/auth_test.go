@@ -0,0 +1,326 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = bytes.Repeat([]byte("k"), minSecretLength)
+
+func newTestIssuer(t *testing.T, config Config) *Issuer {
+	t.Helper()
+	if config.Secret == nil && config.SigningKey == nil {
+		config.Secret = StaticSecret(testSecret)
+	}
+	issuer, err := NewIssuer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issuer
+}
+
+func generateTokens(t *testing.T, issuer *Issuer, opts ...TokenOption) *TokenPair {
+	t.Helper()
+	tokens, err := issuer.GenerateToken("alice", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+func TestNewIssuer(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretFile, append(testSecret, " \n"...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	shortFile := filepath.Join(t.TempDir(), "short")
+	if err := os.WriteFile(shortFile, []byte("short\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		secret  SecretProvider
+		wantErr error
+	}{
+		{"static secret", StaticSecret(testSecret), nil},
+		{"file secret without trailing newline", FileSecret(secretFile), nil},
+		{"no secret", nil, ErrNoSecret},
+		{"short secret", StaticSecret([]byte("short")), ErrSecretTooShort},
+		{"short file secret", FileSecret(shortFile), ErrSecretTooShort},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewIssuer(Config{Secret: tt.secret})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("NewIssuer err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	for name, secret := range map[string]SecretProvider{
+		"missing file":         FileSecret(filepath.Join(t.TempDir(), "missing")),
+		"missing env variable": EnvSecret("TSS_TOOLS_TEST_MISSING_SECRET"),
+	} {
+		if _, err := NewIssuer(Config{Secret: secret}); err == nil {
+			t.Errorf("%s: NewIssuer succeeded", name)
+		}
+	}
+}
+
+func TestIssuerValidateToken(t *testing.T) {
+	issuer := newTestIssuer(t, Config{Issuer: "https://auth.example.com", Audience: "api"})
+	tokens := generateTokens(t, issuer)
+	access, refresh := tokens.AccessToken, tokens.RefreshToken
+
+	otherKey := newTestIssuer(t, Config{
+		Secret:   StaticSecret(bytes.Repeat([]byte("o"), minSecretLength)),
+		Issuer:   "https://auth.example.com",
+		Audience: "api",
+	})
+	otherAudience := newTestIssuer(t, Config{Issuer: "https://auth.example.com", Audience: "other"})
+	otherIssuer := newTestIssuer(t, Config{Issuer: "https://other.example.com", Audience: "api"})
+
+	tampered := []byte(access)
+	tampered[len(tampered)-2] ^= 1
+
+	tests := []struct {
+		name      string
+		validator *Issuer
+		token     string
+		wantErr   bool
+	}{
+		{"access token", issuer, access, false},
+		{"refresh token", issuer, refresh, false},
+		{"other key", otherKey, access, true},
+		{"other audience", otherAudience, access, true},
+		{"other issuer", otherIssuer, access, true},
+		{"tampered signature", issuer, string(tampered), true},
+		{"not a token", issuer, "not-a-token", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tt.validator.ValidateToken(tt.token)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("ValidateToken accepted the token")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateToken: %v", err)
+			}
+			if claims.Username != "alice" {
+				t.Errorf("username = %q, want alice", claims.Username)
+			}
+		})
+	}
+}
+
+func TestIssuerJWKS(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgES256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			key, err := GenerateSigningKey(alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			issuer := newTestIssuer(t, Config{SigningKey: key})
+			access := generateTokens(t, issuer).AccessToken
+
+			jwks := issuer.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != key.ID || jwks.Keys[0].Algorithm != alg {
+				t.Fatalf("JWKS = %+v, want the %s key '%s'", jwks, alg, key.ID)
+			}
+			verifier, err := NewJWKSVerifier(context.Background(), VerifierConfig{JWKS: &jwks})
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := verifier.ValidateToken(access)
+			if err != nil {
+				t.Fatalf("ValidateToken with JWKS: %v", err)
+			}
+			if claims.Username != "alice" {
+				t.Errorf("username = %q, want alice", claims.Username)
+			}
+		})
+	}
+
+	if jwks := newTestIssuer(t, Config{}).JWKS(); len(jwks.Keys) != 0 {
+		t.Errorf("HMAC secret is published in JWKS: %+v", jwks)
+	}
+}
+
+func TestValidateTokenType(t *testing.T) {
+	issuer := newTestIssuer(t, Config{})
+	tokens := generateTokens(t, issuer)
+	access, refresh := tokens.AccessToken, tokens.RefreshToken
+
+	tests := []struct {
+		name    string
+		token   string
+		opts    []ValidateOption
+		wantErr error
+	}{
+		{"access as access", access, []ValidateOption{WithTokenType(TokenTypeAccess)}, nil},
+		{"refresh as refresh", refresh, []ValidateOption{WithTokenType(TokenTypeRefresh)}, nil},
+		{"refresh as access", refresh, []ValidateOption{WithTokenType(TokenTypeAccess)}, ErrWrongTokenType},
+		{"access as refresh", access, []ValidateOption{WithTokenType(TokenTypeRefresh)}, ErrWrongTokenType},
+		{"any type", refresh, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := issuer.ValidateToken(tt.token, tt.opts...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidateToken err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateTokenFamily(t *testing.T) {
+	issuer := newTestIssuer(t, Config{})
+	first := generateTokens(t, issuer)
+	second := generateTokens(t, issuer)
+	rotated := generateTokens(t, issuer, WithFamily(first.RefreshClaims.FamilyID))
+
+	if first.AccessClaims.FamilyID == "" || first.AccessClaims.FamilyID != first.RefreshClaims.FamilyID {
+		t.Errorf("pair families = %q and %q, want one new family", first.AccessClaims.FamilyID, first.RefreshClaims.FamilyID)
+	}
+	if second.RefreshClaims.FamilyID == first.RefreshClaims.FamilyID {
+		t.Error("new login reused the token family")
+	}
+	if rotated.RefreshClaims.FamilyID != first.RefreshClaims.FamilyID {
+		t.Errorf("family = %q, want %q", rotated.RefreshClaims.FamilyID, first.RefreshClaims.FamilyID)
+	}
+
+	ids := map[string]bool{}
+	for _, claims := range []*Claims{first.AccessClaims, first.RefreshClaims, rotated.AccessClaims, rotated.RefreshClaims} {
+		if claims.ID == "" || ids[claims.ID] {
+			t.Errorf("jti %q is empty or repeated", claims.ID)
+		}
+		ids[claims.ID] = true
+	}
+
+	claims, err := issuer.ValidateToken(rotated.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.ID != rotated.RefreshClaims.ID || claims.FamilyID != rotated.RefreshClaims.FamilyID {
+		t.Errorf("validated claims %+v differ from the issued ones %+v", claims, rotated.RefreshClaims)
+	}
+}
+
+func TestValidateTokenErrors(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	clock := func() time.Time { return now }
+	issuer := newTestIssuer(t, Config{Issuer: "https://auth.example.com", Audience: "api", Clock: clock})
+	access := generateTokens(t, issuer).AccessToken
+
+	esKey, err := GenerateSigningKey(AlgES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := GenerateSigningKey(AlgES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	esIssuer := newTestIssuer(t, Config{SigningKey: esKey, Clock: clock})
+	unknownKeyToken := generateTokens(t, newTestIssuer(t, Config{SigningKey: otherKey, Clock: clock})).AccessToken
+
+	parts := strings.Split(access, ".")
+	payload, err := b64.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := b64.EncodeToString(bytes.ReplaceAll(payload, []byte("alice"), []byte("admin")))
+	otherSignature := strings.Split(generateTokens(t, issuer).AccessToken, ".")[2]
+
+	at := func(t time.Time) ValidateOption { return WithClock(func() time.Time { return t }) }
+
+	tests := []struct {
+		name    string
+		issuer  *Issuer
+		token   string
+		opts    []ValidateOption
+		wantErr error
+	}{
+		{"valid", issuer, access, nil, nil},
+		{"expired", issuer, access, []ValidateOption{at(now.Add(DefaultAccessTTL + time.Minute))}, ErrTokenExpired},
+		{"expired within leeway", issuer, access, []ValidateOption{at(now.Add(DefaultAccessTTL + time.Minute)), WithLeeway(2 * time.Minute)}, nil},
+		{"not valid yet", issuer, access, []ValidateOption{at(now.Add(-time.Minute))}, ErrTokenNotYetValid},
+		{"wrong issuer", issuer, access, []ValidateOption{WithIssuer("https://other.example.com")}, ErrInvalidIssuer},
+		{"wrong audience", issuer, access, []ValidateOption{WithAudience("other")}, ErrInvalidAudience},
+		{"algorithm not allowed", issuer, access, []ValidateOption{WithAlgorithms(AlgES256)}, ErrAlgorithmNotAllowed},
+		{"HS256 token for ES256 key", esIssuer, access, nil, ErrInvalidToken},
+		{"unknown key", esIssuer, unknownKeyToken, nil, ErrUnknownKey},
+		{"forged payload", issuer, parts[0] + "." + forged + "." + parts[2], nil, ErrSignatureInvalid},
+		{"signature of another token", issuer, parts[0] + "." + parts[1] + "." + otherSignature, nil, ErrSignatureInvalid},
+		{"missing signature", issuer, parts[0] + "." + parts[1] + ".", nil, ErrInvalidToken},
+		{"malformed", issuer, "not-a-token", nil, ErrTokenMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.issuer.ValidateToken(tt.token, tt.opts...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidateToken err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("ValidateToken err = %v does not wrap ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestRegisteredClaims(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	issuer := newTestIssuer(t, Config{
+		Issuer:    "https://auth.example.com",
+		Audience:  "api",
+		AccessTTL: time.Minute,
+		Clock:     func() time.Time { return now },
+	})
+	claims := generateTokens(t, issuer).AccessClaims
+
+	if claims.Subject != "alice" || claims.Issuer != "https://auth.example.com" {
+		t.Errorf("sub = %q, iss = %q", claims.Subject, claims.Issuer)
+	}
+	if len(claims.Audience) != 1 || claims.Audience[0] != "api" {
+		t.Errorf("aud = %v, want [api]", claims.Audience)
+	}
+	if !claims.IssuedAt.Equal(now) || !claims.NotBefore.Equal(now) || !claims.ExpiresAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("iat = %v, nbf = %v, exp = %v", claims.IssuedAt, claims.NotBefore, claims.ExpiresAt)
+	}
+}
+
+func TestGenerateTokenScopes(t *testing.T) {
+	issuer := newTestIssuer(t, Config{RoleScopes: map[string][]string{
+		"admin":  {"users:read", "users:write"},
+		"viewer": {"users:read"},
+	}})
+
+	tests := []struct {
+		name      string
+		opts      []TokenOption
+		wantScope string
+	}{
+		{"no scopes", nil, ""},
+		{"explicit scopes", []TokenOption{WithScopes("profile")}, "profile"},
+		{"role scopes", []TokenOption{WithRoles("admin")}, "users:read users:write"},
+		{"no duplicates", []TokenOption{WithScopes("users:read"), WithRoles("viewer", "admin")}, "users:read users:write"},
+		{"unknown role", []TokenOption{WithRoles("guest")}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := generateTokens(t, issuer, tt.opts...).AccessClaims
+			if claims.Scope != tt.wantScope {
+				t.Errorf("scope = %q, want %q", claims.Scope, tt.wantScope)
+			}
+		})
+	}
+}
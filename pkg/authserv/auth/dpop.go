@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DPoPHeader - заголовок запроса с DPoP proof (RFC 9449, 4.1).
+	DPoPHeader = "DPoP"
+	// DefaultDPoPProofLifetime - сколько DPoP proof принимается после его iat.
+	DefaultDPoPProofLifetime = 5 * time.Minute
+
+	dpopProofType = "dpop+jwt"
+)
+
+// DPoPAlgorithms - алгоритмы, допустимые для подписи DPoP proof. Симметричные алгоритмы запрещены.
+var DPoPAlgorithms = []string{AlgES256, AlgES384, AlgES512, AlgRS256, AlgEdDSA}
+
+// ErrInvalidDPoPProof - общая ошибка проверки DPoP proof.
+var ErrInvalidDPoPProof = errors.New("invalid DPoP proof")
+
+// ErrDPoPKeyMismatch возвращается, если токен привязан к другому ключу DPoP или предъявлен без него.
+var ErrDPoPKeyMismatch = fmt.Errorf("%w: token is bound to a different DPoP key", ErrInvalidToken)
+
+// ErrDPoPBindingRequired возвращается, если ресурс принимает только токены, привязанные к ключу DPoP.
+var ErrDPoPBindingRequired = fmt.Errorf("%w: DPoP-bound token is required", ErrInvalidDPoPProof)
+
+// DPoPErrorDescription возвращает причину отказа в проверке DPoP, которую можно показать клиенту.
+// Подробности ошибок проверки proof (например, разбора JWT) не раскрываются, их следует только
+// записывать в журнал.
+func DPoPErrorDescription(err error) string {
+	switch {
+	case errors.Is(err, ErrDPoPBindingRequired):
+		return ErrDPoPBindingRequired.Error()
+	case errors.Is(err, ErrInvalidToken):
+		return ErrorDescription(err)
+	}
+	return ErrInvalidDPoPProof.Error()
+}
+
+// Confirmation - claim cnf (RFC 7800). JKT - SHA-256 thumbprint ключа DPoP, к которому привязан токен.
+type Confirmation struct {
+	JKT string `json:"jkt,omitempty"`
+}
+
+// DPoPClaims - claims DPoP proof (RFC 9449, 4.2).
+type DPoPClaims struct {
+	Method string `json:"htm"`
+	URL    string `json:"htu"`
+	// AccessTokenHash - хеш access-токена, с которым предъявлен proof.
+	AccessTokenHash string `json:"ath,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// ReplayCache запоминает jti уже предъявленных DPoP proof.
+type ReplayCache interface {
+	// Use запоминает jti до expiresAt и возвращает false, если jti уже использован.
+	Use(jti string, expiresAt time.Time) bool
+}
+
+// MemoryReplayCache - ReplayCache в памяти процесса. При нескольких экземплярах сервиса
+// повтор proof на другом экземпляре не обнаруживается.
+type MemoryReplayCache struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastPurge time.Time
+}
+
+// NewMemoryReplayCache создает пустой MemoryReplayCache.
+func NewMemoryReplayCache() *MemoryReplayCache {
+	return &MemoryReplayCache{seen: make(map[string]time.Time)}
+}
+
+func (c *MemoryReplayCache) Use(jti string, expiresAt time.Time) bool {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastPurge) > time.Minute {
+		for seenJTI, seenUntil := range c.seen {
+			if now.After(seenUntil) {
+				delete(c.seen, seenJTI)
+			}
+		}
+		c.lastPurge = now
+	}
+	if seenUntil, ok := c.seen[jti]; ok && !now.After(seenUntil) {
+		return false
+	}
+	c.seen[jti] = expiresAt
+	return true
+}
+
+// DPoPVerifier проверяет DPoP proof (RFC 9449, 4.3).
+type DPoPVerifier struct {
+	Cache ReplayCache
+	// Lifetime - допустимый возраст proof, по умолчанию DefaultDPoPProofLifetime.
+	Lifetime time.Duration
+	// Leeway - допуск на расхождение часов клиента и сервера.
+	Leeway time.Duration
+	Clock  func() time.Time
+}
+
+// NewDPoPVerifier создает DPoPVerifier с кэшем cache и параметрами по умолчанию.
+func NewDPoPVerifier(cache ReplayCache) *DPoPVerifier {
+	return &DPoPVerifier{Cache: cache, Lifetime: DefaultDPoPProofLifetime, Leeway: 30 * time.Second, Clock: time.Now}
+}
+
+// Verify проверяет proof запроса method к targetURL и возвращает thumbprint его ключа.
+// Если accessToken не пустой, proof обязан содержать его хеш в ath.
+func (v *DPoPVerifier) Verify(proof, method, targetURL, accessToken string) (string, error) {
+	if proof == "" {
+		return "", fmt.Errorf("%w: missing %s header", ErrInvalidDPoPProof, DPoPHeader)
+	}
+	clock := v.Clock
+	if clock == nil {
+		clock = time.Now
+	}
+	lifetime := v.Lifetime
+	if lifetime <= 0 {
+		lifetime = DefaultDPoPProofLifetime
+	}
+
+	var jwk JWK
+	claims := &DPoPClaims{}
+	_, err := jwt.ParseWithClaims(proof, claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != dpopProofType {
+			return nil, fmt.Errorf("typ must be %s", dpopProofType)
+		}
+		rawJWK, ok := token.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("missing jwk header")
+		}
+		if _, private := rawJWK["d"]; private {
+			return nil, errors.New("jwk header contains a private key")
+		}
+		data, err := json.Marshal(rawJWK)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &jwk); err != nil {
+			return nil, err
+		}
+		return jwk.PublicKey()
+	}, jwt.WithValidMethods(DPoPAlgorithms), jwt.WithTimeFunc(clock), jwt.WithLeeway(v.Leeway))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidDPoPProof, err)
+	}
+
+	switch {
+	case claims.ID == "":
+		return "", fmt.Errorf("%w: missing jti", ErrInvalidDPoPProof)
+	case claims.Method != method:
+		return "", fmt.Errorf("%w: htm does not match request method", ErrInvalidDPoPProof)
+	case !sameURL(claims.URL, targetURL):
+		return "", fmt.Errorf("%w: htu does not match request URL", ErrInvalidDPoPProof)
+	case claims.IssuedAt == nil:
+		return "", fmt.Errorf("%w: missing iat", ErrInvalidDPoPProof)
+	}
+	now := clock()
+	issuedAt := claims.IssuedAt.Time
+	if issuedAt.After(now.Add(v.Leeway)) || now.After(issuedAt.Add(lifetime+v.Leeway)) {
+		return "", fmt.Errorf("%w: iat is outside of the acceptable window", ErrInvalidDPoPProof)
+	}
+	if accessToken != "" && claims.AccessTokenHash != AccessTokenHash(accessToken) {
+		return "", fmt.Errorf("%w: ath does not match access token", ErrInvalidDPoPProof)
+	}
+	if v.Cache != nil && !v.Cache.Use(claims.ID, issuedAt.Add(lifetime+v.Leeway)) {
+		return "", fmt.Errorf("%w: proof has already been used", ErrInvalidDPoPProof)
+	}
+
+	thumbprint, err := jwk.Thumbprint()
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidDPoPProof, err)
+	}
+	return thumbprint, nil
+}
+
+// AccessTokenHash возвращает значение ath для access-токена (RFC 9449, 4.2).
+func AccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return b64.EncodeToString(sum[:])
+}
+
+// sameURL сравнивает htu с адресом запроса без учета query и fragment (RFC 9449, 4.3).
+func sameURL(htu, target string) bool {
+	a, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	b, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Host, b.Host) && a.EscapedPath() == b.EscapedPath()
+}
@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const dpopTestURL = "https://auth.example.com/oauth/token"
+
+// dpopProof подписывает proof ключом signer. mutate может изменить заголовок и claims.
+func dpopProof(t *testing.T, signer *testSigner, now time.Time, mutate func(header map[string]interface{}, claims jwt.MapClaims)) string {
+	t.Helper()
+	var jwk map[string]interface{}
+	data, err := json.Marshal(JWK{KeyType: signer.jwk.KeyType, Curve: signer.jwk.Curve, X: signer.jwk.X, Y: signer.jwk.Y})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.MapClaims{
+		"jti": "proof-1",
+		"htm": http.MethodPost,
+		"htu": dpopTestURL,
+		"iat": now.Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = dpopProofType
+	token.Header["jwk"] = jwk
+	if mutate != nil {
+		mutate(token.Header, claims)
+	}
+	proof, err := token.SignedString(signer.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
+
+func TestDPoPVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	signer := newTestSigner(t, "")
+	other := newTestSigner(t, "")
+	thumbprint, err := signer.jwk.Thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const accessToken = "access-token"
+
+	hmacProof := func() string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"jti": "proof-1", "htm": http.MethodPost, "htu": dpopTestURL, "iat": now.Unix(),
+		})
+		token.Header["typ"] = dpopProofType
+		token.Header["jwk"] = map[string]interface{}{"kty": "oct", "k": "c2VjcmV0"}
+		proof, err := token.SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return proof
+	}
+
+	tests := []struct {
+		name        string
+		proof       string
+		method      string
+		url         string
+		accessToken string
+		wantErr     bool
+	}{
+		{name: "valid proof", proof: dpopProof(t, signer, now, nil)},
+		{
+			name: "query and host case are ignored",
+			proof: dpopProof(t, signer, now, func(_ map[string]interface{}, c jwt.MapClaims) {
+				c["htu"] = "https://AUTH.example.com/oauth/token"
+			}),
+			url: dpopTestURL + "?grant_type=refresh_token",
+		},
+		{
+			name:  "iat within leeway in the future",
+			proof: dpopProof(t, signer, now.Add(20*time.Second), nil),
+		},
+		{
+			name:  "iat within lifetime",
+			proof: dpopProof(t, signer, now.Add(-DefaultDPoPProofLifetime), nil),
+		},
+		{
+			name: "access token hash",
+			proof: dpopProof(t, signer, now, func(_ map[string]interface{}, c jwt.MapClaims) {
+				c["ath"] = AccessTokenHash(accessToken)
+			}),
+			accessToken: accessToken,
+		},
+		{name: "empty proof", proof: "", wantErr: true},
+		{name: "other method", proof: dpopProof(t, signer, now, nil), method: http.MethodGet, wantErr: true},
+		{name: "other path", proof: dpopProof(t, signer, now, nil), url: "https://auth.example.com/oauth/revoke", wantErr: true},
+		{name: "other host", proof: dpopProof(t, signer, now, nil), url: "https://evil.example.com/oauth/token", wantErr: true},
+		{name: "other scheme", proof: dpopProof(t, signer, now, nil), url: "http://auth.example.com/oauth/token", wantErr: true},
+		{
+			name: "missing jti",
+			proof: dpopProof(t, signer, now, func(_ map[string]interface{}, c jwt.MapClaims) {
+				delete(c, "jti")
+			}),
+			wantErr: true,
+		},
+		{
+			name: "missing iat",
+			proof: dpopProof(t, signer, now, func(_ map[string]interface{}, c jwt.MapClaims) {
+				delete(c, "iat")
+			}),
+			wantErr: true,
+		},
+		{name: "iat in the future", proof: dpopProof(t, signer, now.Add(time.Minute), nil), wantErr: true},
+		{name: "expired iat", proof: dpopProof(t, signer, now.Add(-DefaultDPoPProofLifetime-time.Minute), nil), wantErr: true},
+		{name: "missing ath", proof: dpopProof(t, signer, now, nil), accessToken: accessToken, wantErr: true},
+		{
+			name: "ath of another token",
+			proof: dpopProof(t, signer, now, func(_ map[string]interface{}, c jwt.MapClaims) {
+				c["ath"] = AccessTokenHash("another-token")
+			}),
+			accessToken: accessToken,
+			wantErr:     true,
+		},
+		{
+			name: "wrong typ",
+			proof: dpopProof(t, signer, now, func(h map[string]interface{}, _ jwt.MapClaims) {
+				h["typ"] = "JWT"
+			}),
+			wantErr: true,
+		},
+		{
+			name: "missing jwk",
+			proof: dpopProof(t, signer, now, func(h map[string]interface{}, _ jwt.MapClaims) {
+				delete(h, "jwk")
+			}),
+			wantErr: true,
+		},
+		{
+			name: "private key in jwk",
+			proof: dpopProof(t, signer, now, func(h map[string]interface{}, _ jwt.MapClaims) {
+				h["jwk"].(map[string]interface{})["d"] = b64.EncodeToString(signer.key.D.Bytes())
+			}),
+			wantErr: true,
+		},
+		{
+			name: "jwk of another key",
+			proof: dpopProof(t, signer, now, func(h map[string]interface{}, _ jwt.MapClaims) {
+				h["jwk"] = map[string]interface{}{"kty": "EC", "crv": "P-256", "x": other.jwk.X, "y": other.jwk.Y}
+			}),
+			wantErr: true,
+		},
+		{name: "symmetric algorithm", proof: hmacProof(), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := NewDPoPVerifier(NewMemoryReplayCache())
+			verifier.Clock = func() time.Time { return now }
+			method, target := tt.method, tt.url
+			if method == "" {
+				method = http.MethodPost
+			}
+			if target == "" {
+				target = dpopTestURL
+			}
+
+			got, err := verifier.Verify(tt.proof, method, target, tt.accessToken)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidDPoPProof) {
+					t.Errorf("Verify err = %v, want ErrInvalidDPoPProof", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if got != thumbprint {
+				t.Errorf("Verify = %s, want thumbprint %s", got, thumbprint)
+			}
+		})
+	}
+}
+
+func TestDPoPVerifyReplay(t *testing.T) {
+	now := time.Now()
+	signer := newTestSigner(t, "")
+	verifier := NewDPoPVerifier(NewMemoryReplayCache())
+
+	proof := dpopProof(t, signer, now, nil)
+	if _, err := verifier.Verify(proof, http.MethodPost, dpopTestURL, ""); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if _, err := verifier.Verify(proof, http.MethodPost, dpopTestURL, ""); !errors.Is(err, ErrInvalidDPoPProof) {
+		t.Errorf("replayed proof: err = %v, want ErrInvalidDPoPProof", err)
+	}
+
+	fresh := dpopProof(t, signer, now, func(_ map[string]interface{}, c jwt.MapClaims) {
+		c["jti"] = "proof-2"
+	})
+	if _, err := verifier.Verify(fresh, http.MethodPost, dpopTestURL, ""); err != nil {
+		t.Errorf("proof with a new jti: %v", err)
+	}
+}
+
+func TestMemoryReplayCache(t *testing.T) {
+	cache := NewMemoryReplayCache()
+	now := time.Now()
+
+	tests := []struct {
+		jti       string
+		expiresAt time.Time
+		want      bool
+	}{
+		{"a", now.Add(time.Minute), true},
+		{"a", now.Add(time.Minute), false},
+		{"b", now.Add(time.Minute), true},
+		{"expired", now.Add(-time.Second), true},
+		// Запись с истекшим сроком больше не защищает от повтора.
+		{"expired", now.Add(time.Minute), true},
+		{"expired", now.Add(time.Minute), false},
+	}
+	for i, tt := range tests {
+		if got := cache.Use(tt.jti, tt.expiresAt); got != tt.want {
+			t.Errorf("%d: Use(%q) = %v, want %v", i, tt.jti, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidToken - общая ошибка проверки токена. Все ошибки ниже оборачивают ее,
+// поэтому errors.Is(err, ErrInvalidToken) верно для любой причины отказа.
+var ErrInvalidToken = errors.New("invalid token")
+
+var (
+	ErrTokenMalformed      = fmt.Errorf("%w: token is malformed", ErrInvalidToken)
+	ErrSignatureInvalid    = fmt.Errorf("%w: signature is invalid", ErrInvalidToken)
+	ErrTokenExpired        = fmt.Errorf("%w: token is expired", ErrInvalidToken)
+	ErrTokenNotYetValid    = fmt.Errorf("%w: token is not valid yet", ErrInvalidToken)
+	ErrInvalidIssuer       = fmt.Errorf("%w: wrong issuer", ErrInvalidToken)
+	ErrInvalidAudience     = fmt.Errorf("%w: wrong audience", ErrInvalidToken)
+	ErrAlgorithmNotAllowed = fmt.Errorf("%w: signing algorithm is not allowed", ErrInvalidToken)
+	ErrUnknownKey          = fmt.Errorf("%w: unknown signing key", ErrInvalidToken)
+	ErrWrongTokenType      = fmt.Errorf("%w: wrong token type", ErrInvalidToken)
+	ErrTokenRevoked        = fmt.Errorf("%w: token is revoked", ErrInvalidToken)
+	ErrWrongClient         = fmt.Errorf("%w: token was issued to another client", ErrInvalidToken)
+)
+
+// tokenError приводит ошибку разбора jwt к одной из ошибок пакета.
+func tokenError(err error) error {
+	for _, known := range []error{ErrUnknownKey, ErrAlgorithmNotAllowed} {
+		if errors.Is(err, known) {
+			return known
+		}
+	}
+	switch {
+	case errors.Is(err, jwt.ErrTokenMalformed), errors.Is(err, jwt.ErrTokenRequiredClaimMissing):
+		return ErrTokenMalformed
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return ErrSignatureInvalid
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ErrTokenExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return ErrTokenNotYetValid
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return ErrInvalidIssuer
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return ErrInvalidAudience
+	}
+	return fmt.Errorf("%w: %v", ErrInvalidToken, err)
+}
+
+// ErrorDescription возвращает причину отказа в проверке токена, которую можно показать клиенту:
+// текст одной из ошибок пакета или, для прочих ошибок (например, сбоя загрузки JWKS), только
+// текст ErrInvalidToken. Подробности таких ошибок следует только записывать в журнал.
+func ErrorDescription(err error) string {
+	known := []error{
+		ErrTokenMalformed, ErrSignatureInvalid, ErrTokenExpired, ErrTokenNotYetValid, ErrInvalidIssuer,
+		ErrInvalidAudience, ErrAlgorithmNotAllowed, ErrUnknownKey, ErrWrongTokenType, ErrTokenRevoked,
+		ErrWrongClient, ErrTokenNotFound, ErrAPIKeyNotFound, ErrDPoPKeyMismatch,
+	}
+	for _, sentinel := range known {
+		if errors.Is(err, sentinel) {
+			return sentinel.Error()
+		}
+	}
+	return ErrInvalidToken.Error()
+}
@@ -0,0 +1,46 @@
+package auth
+
+// Типы токенов RFC 8693, 3, используемые при обмене токенов.
+const (
+	TokenTypeURIAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeURIJWT         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// Actor - claim act (RFC 8693, 4.1). Вложенный Actor - предыдущий участник цепочки делегирования.
+type Actor struct {
+	Subject  string `json:"sub"`
+	ClientID string `json:"client_id,omitempty"`
+	Actor    *Actor `json:"act,omitempty"`
+}
+
+// ExchangeToken выпускает access-токен субъекта токена subject, с которым действует actor
+// (RFC 8693, 1.1). Новый токен наследует пользователя, роли, семейство и версию токенов subject,
+// поэтому отзыв исходной сессии отзывает и его, и истекает не позже subject.
+// act исходного токена вкладывается в act нового.
+// Разрешения, audience и клиент задаются опциями.
+func (i *Issuer) ExchangeToken(subject *Claims, actor Actor, opts ...TokenOption) (string, *Claims, error) {
+	options := newTokenOptions(opts)
+	if options.familyID == "" {
+		options.familyID = subject.FamilyID
+	}
+	if options.roles == nil {
+		options.roles = subject.Roles
+	}
+	if options.email == "" {
+		options.email, options.emailVerified = subject.Email, subject.EmailVerified
+	}
+
+	claims := i.newClaims(subject.Subject, TokenTypeAccess, i.accessTTL, options)
+	claims.Username = subject.Username
+	claims.TokenVersion = subject.TokenVersion
+	if subject.ExpiresAt != nil && subject.ExpiresAt.Before(claims.ExpiresAt.Time) {
+		claims.ExpiresAt = subject.ExpiresAt
+	}
+	actor.Actor = subject.Actor
+	claims.Actor = &actor
+	tokenString, err := i.format.encode(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return tokenString, claims, nil
+}
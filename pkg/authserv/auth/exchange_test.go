@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExchangeToken(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	issuer := newTestIssuer(t, Config{
+		Audience:  "api",
+		AccessTTL: time.Hour,
+		Clock:     func() time.Time { return now },
+	})
+	subject := generateTokens(t, issuer, WithRoles("admin")).AccessClaims
+	subject.TokenVersion = 3
+	// Исходный токен истекает раньше, чем истек бы новый.
+	subject.ExpiresAt.Time = now.Add(time.Minute)
+
+	token, claims, err := issuer.ExchangeToken(subject, Actor{Subject: "gateway", ClientID: "gateway"},
+		WithClientID("gateway"), WithScopes("orders:read"), WithTokenAudience("orders"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "alice" || claims.Username != "alice" || claims.FamilyID != subject.FamilyID || claims.TokenVersion != 3 {
+		t.Errorf("claims = %+v, want alice's family and token version", claims)
+	}
+	if !claims.HasRole("admin") || claims.Scope != "orders:read" || claims.ClientID != "gateway" {
+		t.Errorf("roles = %v, scope = %q, client_id = %q", claims.Roles, claims.Scope, claims.ClientID)
+	}
+	if len(claims.Audience) != 1 || claims.Audience[0] != "orders" {
+		t.Errorf("aud = %v, want [orders]", claims.Audience)
+	}
+	if !claims.ExpiresAt.Equal(subject.ExpiresAt.Time) {
+		t.Errorf("exp = %v, want the subject token expiry %v", claims.ExpiresAt, subject.ExpiresAt)
+	}
+	if claims.Actor == nil || claims.Actor.Subject != "gateway" || claims.Actor.Actor != nil {
+		t.Errorf("act = %+v", claims.Actor)
+	}
+
+	// Повторный обмен вкладывает предыдущего участника в act.
+	parsed, err := issuer.ValidateToken(token, WithAudience("orders"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, nested, err := issuer.ExchangeToken(parsed, Actor{Subject: "billing", ClientID: "billing"}, WithClientID("billing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nested.Actor.Subject != "billing" || nested.Actor.Actor == nil || nested.Actor.Actor.Subject != "gateway" {
+		t.Errorf("nested act = %+v, want billing acting for gateway", nested.Actor)
+	}
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Форматы токенов в Config.TokenFormat.
+const (
+	// TokenFormatJWT - подписанные JWT (по умолчанию).
+	TokenFormatJWT = "jwt"
+	// TokenFormatOpaque - случайные строки, claims которых хранятся в Config.TokenStore.
+	TokenFormatOpaque = "opaque"
+	// TokenFormatPASETOPublic - PASETO v4.public, подписанные активным ключом EdDSA.
+	TokenFormatPASETOPublic = "paseto.v4.public"
+	// TokenFormatPASETOLocal - PASETO v4.local, зашифрованные активным 32-байтовым ключом HS256.
+	TokenFormatPASETOLocal = "paseto.v4.local"
+)
+
+// tokenFormat превращает claims в строку токена и восстанавливает их при проверке.
+type tokenFormat interface {
+	encode(claims *Claims) (string, error)
+	decode(token string, options *validateOptions) (*Claims, error)
+}
+
+func newTokenFormat(config Config, keys *KeySet) (tokenFormat, error) {
+	switch config.TokenFormat {
+	case "", TokenFormatJWT:
+		return jwtFormat{keys: keys}, nil
+	case TokenFormatOpaque:
+		if config.TokenStore == nil {
+			return nil, ErrNoTokenStore
+		}
+		return opaqueFormat{store: config.TokenStore}, nil
+	case TokenFormatPASETOPublic:
+		return newPASETOFormat(keys, pasetoV4Public)
+	case TokenFormatPASETOLocal:
+		return newPASETOFormat(keys, pasetoV4Local)
+	}
+	return nil, fmt.Errorf("unsupported token format '%s'", config.TokenFormat)
+}
+
+type jwtFormat struct {
+	keys *KeySet
+}
+
+func (f jwtFormat) encode(claims *Claims) (string, error) {
+	return signJWT(f.keys, claims)
+}
+
+func (f jwtFormat) decode(token string, options *validateOptions) (*Claims, error) {
+	return parseToken(token, f.keys.lookupKey, options)
+}
+
+// validateClaims проверяет стандартные claims и тип токена, подпись или запись которого уже проверены.
+func validateClaims(claims *Claims, options *validateOptions) (*Claims, error) {
+	if err := jwt.NewValidator(options.parserOptions()...).Validate(claims); err != nil {
+		return nil, tokenError(err)
+	}
+	if options.tokenType != "" && claims.TokenType != options.tokenType {
+		return nil, ErrWrongTokenType
+	}
+	return claims, nil
+}
+
+// signJWT подписывает claims активным ключом набора и указывает его kid в заголовке.
+func signJWT(keys *KeySet, claims jwt.Claims) (string, error) {
+	signingKey := keys.Active()
+	token := jwt.NewWithClaims(signingKey.method(), claims)
+	if signingKey.ID != "" {
+		token.Header["kid"] = signingKey.ID
+	}
+	return token.SignedString(signingKey.Key)
+}
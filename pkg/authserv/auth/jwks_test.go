@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestJWKThumbprint(t *testing.T) {
+	// canonical возвращает ожидаемый thumbprint для JSON обязательных членов (RFC 7638, 3.2).
+	canonical := func(json string) string {
+		sum := sha256.Sum256([]byte(json))
+		return b64.EncodeToString(sum[:])
+	}
+
+	tests := []struct {
+		name    string
+		jwk     JWK
+		want    string
+		wantErr bool
+	}{
+		{
+			// RFC 8037, приложение A.3.
+			name: "rfc 8037 Ed25519",
+			jwk:  JWK{KeyType: "OKP", Curve: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+			want: "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k",
+		},
+		{
+			name: "optional members are ignored",
+			jwk: JWK{KeyType: "OKP", Curve: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo",
+				KeyID: "key-1", Use: "sig", Algorithm: "EdDSA"},
+			want: "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k",
+		},
+		{
+			name: "EC members in lexicographic order",
+			jwk:  JWK{KeyType: "EC", Curve: "P-256", X: "xx", Y: "yy", KeyID: "key-1"},
+			want: canonical(`{"crv":"P-256","kty":"EC","x":"xx","y":"yy"}`),
+		},
+		{
+			name: "RSA members in lexicographic order",
+			jwk:  JWK{KeyType: "RSA", N: "nn", E: "AQAB", Algorithm: "RS256"},
+			want: canonical(`{"e":"AQAB","kty":"RSA","n":"nn"}`),
+		},
+		{
+			name:    "unsupported key type",
+			jwk:     JWK{KeyType: "oct"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.jwk.Thumbprint()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Thumbprint = %s, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Thumbprint: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Thumbprint = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWKRoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		alg  string
+		pub  interface {
+			Equal(x crypto.PublicKey) bool
+		}
+	}{
+		{"RSA", "RS256", &rsaKey.PublicKey},
+		{"EC", "ES384", &ecKey.PublicKey},
+		{"Ed25519", "EdDSA", edKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwk, err := NewJWK("key-1", tt.alg, tt.pub)
+			if err != nil {
+				t.Fatalf("NewJWK: %v", err)
+			}
+			pub, err := jwk.PublicKey()
+			if err != nil {
+				t.Fatalf("PublicKey: %v", err)
+			}
+			if !tt.pub.Equal(pub) {
+				t.Error("decoded key differs from the original")
+			}
+		})
+	}
+}
+
+func TestJWKPublicKeyInvalid(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := NewJWK("", "ES256", &ecKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offCurve := valid
+	offCurve.Y = valid.X
+
+	tests := []struct {
+		name string
+		jwk  JWK
+	}{
+		{"point off the curve", offCurve},
+		{"short coordinate", JWK{KeyType: "EC", Curve: "P-256", X: "AQAB", Y: valid.Y}},
+		{"unknown curve", JWK{KeyType: "EC", Curve: "secp256k1", X: valid.X, Y: valid.Y}},
+		{"short Ed25519 key", JWK{KeyType: "OKP", Curve: "Ed25519", X: "AQAB"}},
+		{"X25519 key", JWK{KeyType: "OKP", Curve: "X25519", X: valid.X}},
+		{"small RSA exponent", JWK{KeyType: "RSA", N: valid.X, E: "AQ"}},
+		{"empty RSA modulus", JWK{KeyType: "RSA", E: "AQAB"}},
+		{"symmetric key", JWK{KeyType: "oct"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.jwk.PublicKey(); err == nil {
+				t.Error("PublicKey accepted an invalid key")
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// KeyCipherKeySize - размер ключа шифрования ключей подписи (AES-256).
+const KeyCipherKeySize = 32
+
+var (
+	ErrNoKeyCipher   = errors.New("key store requires a key cipher")
+	ErrKeyDecryption = errors.New("could not decrypt signing key")
+)
+
+// KeyCipher шифрует ключи подписи перед сохранением в KeyStore (AES-256-GCM). kid входит
+// в аутентифицируемые данные, поэтому зашифрованный ключ нельзя выдать за ключ с другим kid.
+type KeyCipher struct {
+	aead cipher.AEAD
+}
+
+// NewKeyCipher создает KeyCipher с ключом key длиной KeyCipherKeySize байт,
+// например загруженным через FileSecret.
+func NewKeyCipher(key []byte) (*KeyCipher, error) {
+	if len(key) != KeyCipherKeySize {
+		return nil, fmt.Errorf("key encryption key must be %d bytes, got %d", KeyCipherKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyCipher{aead: aead}, nil
+}
+
+// Encrypt шифрует ключ с идентификатором kid. Результат начинается со случайного nonce.
+func (c *KeyCipher) Encrypt(kid string, key []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, key, []byte(kid)), nil
+}
+
+// Decrypt расшифровывает ключ с идентификатором kid, зашифрованный Encrypt.
+func (c *KeyCipher) Decrypt(kid string, data []byte) ([]byte, error) {
+	nonceSize := c.aead.NonceSize()
+	if len(data) < nonceSize {
+		return nil, ErrKeyDecryption
+	}
+	key, err := c.aead.Open(nil, data[:nonceSize], data[nonceSize:], []byte(kid))
+	if err != nil {
+		return nil, ErrKeyDecryption
+	}
+	return key, nil
+}
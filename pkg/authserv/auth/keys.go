@@ -0,0 +1,251 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Поддерживаемые алгоритмы подписи.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgES384 = "ES384"
+	AlgES512 = "ES512"
+	AlgEdDSA = "EdDSA"
+)
+
+const rsaKeyBits = 2048
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrKeyAlgorithmMismatch = errors.New("key type does not match signing algorithm")
+)
+
+// SigningKey - ключ подписи токенов. ID попадает в заголовок kid.
+// Key содержит []byte для HS256, *rsa.PrivateKey для RS256,
+// *ecdsa.PrivateKey для ES256/ES384/ES512 и ed25519.PrivateKey для EdDSA.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	Key       crypto.PrivateKey
+}
+
+// NewSigningKey проверяет, что key подходит для алгоритма alg, и создает SigningKey.
+func NewSigningKey(kid, alg string, key crypto.PrivateKey) (*SigningKey, error) {
+	signingKey := &SigningKey{ID: kid, Algorithm: alg, Key: key}
+	if err := signingKey.check(); err != nil {
+		return nil, err
+	}
+	return signingKey, nil
+}
+
+// GenerateSigningKey создает новый ключ для алгоритма alg. Идентификатором асимметричного ключа
+// становится его JWK thumbprint (RFC 7638), симметричного - случайная строка.
+func GenerateSigningKey(alg string) (*SigningKey, error) {
+	var (
+		key crypto.PrivateKey
+		err error
+	)
+	switch alg {
+	case AlgHS256:
+		secret := make([]byte, minSecretLength)
+		_, err = rand.Read(secret)
+		key = secret
+	case AlgRS256:
+		key, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgES384:
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case AlgES512:
+		key, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case AlgEdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w: '%s'", ErrUnsupportedAlgorithm, alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("generate %s key: %w", alg, err)
+	}
+
+	signingKey := &SigningKey{Algorithm: alg, Key: key}
+	if signingKey.Symmetric() {
+		kid := make([]byte, 16)
+		if _, err := rand.Read(kid); err != nil {
+			return nil, fmt.Errorf("generate key id: %w", err)
+		}
+		signingKey.ID = b64.EncodeToString(kid)
+		return signingKey, nil
+	}
+	jwk, err := NewJWK("", alg, signingKey.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+	signingKey.ID, err = jwk.Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	return signingKey, nil
+}
+
+// ParseSigningKeyPEM разбирает закрытый ключ в формате PEM (PKCS#8, PKCS#1 или SEC 1).
+// Алгоритм выбирается по типу ключа: RSA - RS256, ECDSA - по кривой, Ed25519 - EdDSA.
+func ParseSigningKeyPEM(kid string, pemData []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var (
+		key crypto.PrivateKey
+		err error
+	)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+
+	alg, err := defaultAlgorithm(key)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigningKey(kid, alg, key)
+}
+
+// MarshalPEM кодирует асимметричный ключ в PEM (PKCS#8).
+func (k *SigningKey) MarshalPEM() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.Key)
+	if err != nil {
+		return nil, fmt.Errorf("marshal private key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// marshalKey кодирует ключ для хранилища: PEM для асимметричных ключей, сам секрет - для HMAC.
+func (k *SigningKey) marshalKey() ([]byte, error) {
+	if k.Symmetric() {
+		secret, _ := k.Key.([]byte)
+		return append([]byte(nil), secret...), nil
+	}
+	return k.MarshalPEM()
+}
+
+func unmarshalKey(kid, alg string, data []byte) (*SigningKey, error) {
+	if alg == AlgHS256 {
+		return NewSigningKey(kid, alg, data)
+	}
+	key, err := ParseSigningKeyPEM(kid, data)
+	if err != nil {
+		return nil, err
+	}
+	if key.Algorithm != alg {
+		return nil, fmt.Errorf("%w: stored %s, parsed %s", ErrKeyAlgorithmMismatch, alg, key.Algorithm)
+	}
+	return key, nil
+}
+
+// PublicKey возвращает открытый ключ или nil для симметричного ключа.
+func (k *SigningKey) PublicKey() crypto.PublicKey {
+	switch key := k.Key.(type) {
+	case *rsa.PrivateKey:
+		return &key.PublicKey
+	case *ecdsa.PrivateKey:
+		return &key.PublicKey
+	case ed25519.PrivateKey:
+		return key.Public()
+	}
+	return nil
+}
+
+// Symmetric сообщает, является ли ключ HMAC-секретом.
+func (k *SigningKey) Symmetric() bool {
+	return k.Algorithm == AlgHS256
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// verificationKey - ключ, которым проверяется подпись токена.
+type verificationKey struct {
+	algorithm string
+	key       interface{}
+}
+
+func (k *SigningKey) verifier() *verificationKey {
+	if k.Symmetric() {
+		return &verificationKey{algorithm: k.Algorithm, key: k.Key}
+	}
+	return &verificationKey{algorithm: k.Algorithm, key: k.PublicKey()}
+}
+
+func (k *SigningKey) check() error {
+	var ok bool
+	switch k.Algorithm {
+	case AlgHS256:
+		var secret []byte
+		secret, ok = k.Key.([]byte)
+		if ok && len(secret) < minSecretLength {
+			return ErrSecretTooShort
+		}
+	case AlgRS256:
+		_, ok = k.Key.(*rsa.PrivateKey)
+	case AlgES256, AlgES384, AlgES512:
+		var key *ecdsa.PrivateKey
+		key, ok = k.Key.(*ecdsa.PrivateKey)
+		ok = ok && curveAlgorithm(key.Curve) == k.Algorithm
+	case AlgEdDSA:
+		_, ok = k.Key.(ed25519.PrivateKey)
+	default:
+		return fmt.Errorf("%w: '%s'", ErrUnsupportedAlgorithm, k.Algorithm)
+	}
+	if !ok {
+		return fmt.Errorf("%w: %T for %s", ErrKeyAlgorithmMismatch, k.Key, k.Algorithm)
+	}
+	return nil
+}
+
+func defaultAlgorithm(key crypto.PrivateKey) (string, error) {
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return AlgRS256, nil
+	case *ecdsa.PrivateKey:
+		if alg := curveAlgorithm(key.Curve); alg != "" {
+			return alg, nil
+		}
+		return "", fmt.Errorf("%w: curve %s", ErrUnsupportedAlgorithm, key.Curve.Params().Name)
+	case ed25519.PrivateKey:
+		return AlgEdDSA, nil
+	}
+	return "", fmt.Errorf("%w: key type %T", ErrUnsupportedAlgorithm, key)
+}
+
+func curveAlgorithm(curve elliptic.Curve) string {
+	switch curve {
+	case elliptic.P256():
+		return AlgES256
+	case elliptic.P384():
+		return AlgES384
+	case elliptic.P521():
+		return AlgES512
+	}
+	return ""
+}
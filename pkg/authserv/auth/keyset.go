@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// KeySet - набор ключей с одним активным ключом подписи и ключами, пригодными только для проверки.
+// Ключ для проверки выбирается по kid из заголовка токена.
+type KeySet struct {
+	mu     sync.RWMutex
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// NewKeySet создает KeySet с активным ключом active и ключами проверки verificationKeys.
+func NewKeySet(active *SigningKey, verificationKeys ...*SigningKey) (*KeySet, error) {
+	set := &KeySet{}
+	if err := set.Replace(active, verificationKeys...); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// Replace атомарно заменяет содержимое набора.
+func (s *KeySet) Replace(active *SigningKey, verificationKeys ...*SigningKey) error {
+	if active == nil {
+		return errors.New("active signing key is required")
+	}
+	keys := make(map[string]*SigningKey, len(verificationKeys)+1)
+	for _, key := range append([]*SigningKey{active}, verificationKeys...) {
+		if err := key.check(); err != nil {
+			return err
+		}
+		if _, ok := keys[key.ID]; ok {
+			return errors.New("duplicate key id '" + key.ID + "'")
+		}
+		keys[key.ID] = key
+	}
+
+	s.mu.Lock()
+	s.active = active
+	s.keys = keys
+	s.mu.Unlock()
+	return nil
+}
+
+// Active возвращает ключ, которым подписываются новые токены.
+func (s *KeySet) Active() *SigningKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.active
+}
+
+// Lookup ищет ключ по kid.
+func (s *KeySet) Lookup(kid string) (*SigningKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// Keys возвращает все ключи набора, упорядоченные по kid.
+func (s *KeySet) Keys() []*SigningKey {
+	s.mu.RLock()
+	keys := make([]*SigningKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+// JWKS возвращает открытые ключи набора. Симметричные ключи не публикуются.
+func (s *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range s.Keys() {
+		if key.Symmetric() {
+			continue
+		}
+		jwk, err := NewJWK(key.ID, key.Algorithm, key.PublicKey())
+		if err != nil {
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
+
+func (s *KeySet) lookupKey(kid string) (*verificationKey, error) {
+	key, ok := s.Lookup(kid)
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key.verifier(), nil
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Разрешения OpenID Connect (OpenID Connect Core 1.0, 5.4).
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+var (
+	// ErrNoIssuerName возвращается NewIssuer, если Config.OpenIDConnect задан без Config.Issuer.
+	ErrNoIssuerName = errors.New("issuer name is required for OpenID Connect")
+	// ErrSymmetricIDTokenKey возвращается, если ID Token пришлось бы подписать HMAC-ключом,
+	// которого нет в JWKS: клиент не смог бы проверить такую подпись.
+	ErrSymmetricIDTokenKey = errors.New("OpenID Connect requires an asymmetric signing key")
+	// ErrOpenIDDisabled возвращается GenerateIDToken, если не задан Config.OpenIDConnect.
+	ErrOpenIDDisabled = errors.New("OpenID Connect is not enabled")
+)
+
+// IDTokenClaims - claims ID Token (OpenID Connect Core 1.0, 2).
+type IDTokenClaims struct {
+	Nonce    string           `json:"nonce,omitempty"`
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// GenerateIDToken выпускает ID Token пользователя subject для клиента clientID.
+// nonce переносится из запроса авторизации, authTime - момент входа пользователя.
+func (i *Issuer) GenerateIDToken(subject, clientID, nonce string, authTime time.Time) (string, error) {
+	if !i.openID {
+		return "", ErrOpenIDDisabled
+	}
+	if i.keys.Active().Symmetric() {
+		return "", fmt.Errorf("%w: active key '%s'", ErrSymmetricIDTokenKey, i.keys.Active().ID)
+	}
+	now := i.clock()
+	claims := &IDTokenClaims{
+		Nonce: nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   subject,
+			Issuer:    i.issuer,
+			Audience:  jwt.ClaimStrings{clientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(i.accessTTL)),
+		},
+	}
+	if !authTime.IsZero() {
+		claims.AuthTime = jwt.NewNumericDate(authTime)
+	}
+	return signJWT(i.keys, claims)
+}
+
+// SigningAlgorithm возвращает алгоритм, которым подписываются новые токены.
+func (i *Issuer) SigningAlgorithm() string {
+	return i.keys.Active().Algorithm
+}
+
+// OpenIDEnabled сообщает, выпускает ли Issuer ID Token (Config.OpenIDConnect).
+func (i *Issuer) OpenIDEnabled() bool {
+	return i.openID
+}
+
+// checkOpenID проверяет, что ID Token можно подписать и проверить по JWKS, в том числе после ротации.
+func (i *Issuer) checkOpenID() error {
+	if i.issuer == "" {
+		return ErrNoIssuerName
+	}
+	if active := i.keys.Active(); active.Symmetric() {
+		return fmt.Errorf("%w: active key '%s' is %s", ErrSymmetricIDTokenKey, active.ID, active.Algorithm)
+	}
+	if i.store != nil && i.rotation.Algorithm == AlgHS256 {
+		return fmt.Errorf("%w: rotation algorithm is %s", ErrSymmetricIDTokenKey, i.rotation.Algorithm)
+	}
+	return nil
+}
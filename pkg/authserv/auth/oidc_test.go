@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestGenerateIDToken(t *testing.T) {
+	key, err := GenerateSigningKey(AlgES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	issuer := newTestIssuer(t, Config{
+		SigningKey:    key,
+		Issuer:        "https://auth.example.com",
+		Audience:      "api",
+		OpenIDConnect: true,
+		AccessTTL:     time.Minute,
+		Clock:         func() time.Time { return now },
+	})
+
+	authTime := now.Add(-time.Minute)
+	idToken, err := issuer.GenerateIDToken("alice", "spa", "n-0S6_WzA2Mj", authTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := &IDTokenClaims{}
+	_, err = jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return key.PublicKey(), nil
+	}, jwt.WithValidMethods([]string{AlgES256}), jwt.WithTimeFunc(func() time.Time { return now }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "alice" || claims.Issuer != "https://auth.example.com" || claims.Nonce != "n-0S6_WzA2Mj" {
+		t.Errorf("sub = %q, iss = %q, nonce = %q", claims.Subject, claims.Issuer, claims.Nonce)
+	}
+	// Аудитория ID Token - клиент, а не API из Config.Audience.
+	if len(claims.Audience) != 1 || claims.Audience[0] != "spa" {
+		t.Errorf("aud = %v, want [spa]", claims.Audience)
+	}
+	if !claims.AuthTime.Equal(authTime) || !claims.ExpiresAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("auth_time = %v, exp = %v", claims.AuthTime, claims.ExpiresAt)
+	}
+	if issuer.SigningAlgorithm() != AlgES256 {
+		t.Errorf("SigningAlgorithm = %q, want %q", issuer.SigningAlgorithm(), AlgES256)
+	}
+
+	// ID Token не принимается как access-токен.
+	if _, err := issuer.ValidateToken(idToken, WithTokenType(TokenTypeAccess)); err == nil {
+		t.Error("ID token was accepted as an access token")
+	}
+
+	disabled := newTestIssuer(t, Config{SigningKey: key, Issuer: "https://auth.example.com"})
+	if _, err := disabled.GenerateIDToken("alice", "spa", "", time.Time{}); !errors.Is(err, ErrOpenIDDisabled) {
+		t.Errorf("GenerateIDToken err = %v, want %v", err, ErrOpenIDDisabled)
+	}
+}
+
+func TestOpenIDConnectConfig(t *testing.T) {
+	key, err := GenerateSigningKey(AlgES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := StaticSecret(bytes.Repeat([]byte("k"), 32))
+
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr error
+	}{
+		{"asymmetric key", Config{SigningKey: key, Issuer: "https://auth.example.com"}, nil},
+		{"no issuer name", Config{SigningKey: key}, ErrNoIssuerName},
+		// HMAC-ключ не публикуется в JWKS, и клиенты не смогли бы проверить ID Token.
+		{"hmac secret", Config{Secret: secret, Issuer: "https://auth.example.com"}, ErrSymmetricIDTokenKey},
+		{
+			name: "hmac rotation",
+			config: Config{KeyStore: newMemoryKeyStore(), KeyCipher: newTestKeyCipher(t),
+				Rotation: RotationConfig{Algorithm: AlgHS256}, Issuer: "https://auth.example.com"},
+			wantErr: ErrSymmetricIDTokenKey,
+		},
+		{
+			name: "paseto local",
+			config: Config{KeyStore: newMemoryKeyStore(), KeyCipher: newTestKeyCipher(t),
+				TokenFormat: TokenFormatPASETOLocal, Issuer: "https://auth.example.com"},
+			wantErr: ErrSymmetricIDTokenKey,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.OpenIDConnect = true
+			issuer, err := NewIssuer(tt.config)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewIssuer err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !issuer.OpenIDEnabled() {
+				t.Error("OpenID Connect is not enabled")
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// ErrNoTokenStore возвращается NewIssuer, если для opaque-токенов не задан Config.TokenStore.
+var ErrNoTokenStore = errors.New("token store is required for opaque tokens")
+
+// ErrTokenNotFound возвращается TokenStore, если токена нет в хранилище.
+var ErrTokenNotFound = fmt.Errorf("%w: token not found", ErrInvalidToken)
+
+// OpaqueToken - запись opaque-токена в TokenStore. Хранится только SHA-256 хеш токена.
+type OpaqueToken struct {
+	Hash   string
+	Claims *Claims
+}
+
+// TokenStore хранит claims opaque-токенов, например repository.AuthRepository.
+// GetOpaqueToken возвращает ErrTokenNotFound для неизвестного хеша,
+// DeleteOpaqueToken не считает отсутствие записи ошибкой.
+type TokenStore interface {
+	SaveOpaqueToken(token OpaqueToken) error
+	GetOpaqueToken(hash string) (*OpaqueToken, error)
+	DeleteOpaqueToken(hash string) error
+}
+
+// opaqueFormat выдает случайные токены без содержимого. Проверка токена - поиск его хеша
+// в хранилище, поэтому удаление записи отзывает токен немедленно.
+type opaqueFormat struct {
+	store TokenStore
+}
+
+func (f opaqueFormat) encode(claims *Claims) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := b64.EncodeToString(buf)
+	if err := f.store.SaveOpaqueToken(OpaqueToken{Hash: HashOpaqueToken(token), Claims: claims}); err != nil {
+		return "", fmt.Errorf("save opaque token: %w", err)
+	}
+	return token, nil
+}
+
+func (f opaqueFormat) decode(token string, options *validateOptions) (*Claims, error) {
+	stored, err := f.store.GetOpaqueToken(HashOpaqueToken(token))
+	if err != nil {
+		return nil, err
+	}
+	return validateClaims(stored.Claims, options)
+}
+
+// RevokeOpaqueToken удаляет opaque-токен из TokenStore, после чего он не проходит ValidateToken.
+// Для остальных форматов возвращает false: такие токены отзываются черным списком.
+func (i *Issuer) RevokeOpaqueToken(token string) (bool, error) {
+	f, ok := i.format.(opaqueFormat)
+	if !ok {
+		return false, nil
+	}
+	if err := f.store.DeleteOpaqueToken(HashOpaqueToken(token)); err != nil {
+		return true, fmt.Errorf("delete opaque token: %w", err)
+	}
+	return true, nil
+}
+
+// HashOpaqueToken возвращает хеш, под которым opaque-токен хранится в TokenStore.
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
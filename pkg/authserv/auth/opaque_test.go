@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryTokenStore - TokenStore в памяти.
+type memoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]OpaqueToken
+}
+
+func newMemoryTokenStore() *memoryTokenStore {
+	return &memoryTokenStore{tokens: make(map[string]OpaqueToken)}
+}
+
+func (s *memoryTokenStore) SaveOpaqueToken(token OpaqueToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token.Hash] = token
+	return nil
+}
+
+func (s *memoryTokenStore) GetOpaqueToken(hash string) (*OpaqueToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[hash]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+	return &token, nil
+}
+
+func (s *memoryTokenStore) DeleteOpaqueToken(hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, hash)
+	return nil
+}
+
+func TestOpaqueTokens(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := newMemoryTokenStore()
+	issuer := newTestIssuer(t, Config{
+		TokenFormat: TokenFormatOpaque,
+		TokenStore:  store,
+		AccessTTL:   time.Minute,
+		Clock:       func() time.Time { return now },
+	})
+	tokens := generateTokens(t, issuer, WithScopes("orders:read"))
+
+	for _, token := range []string{tokens.AccessToken, tokens.RefreshToken} {
+		if strings.Contains(token, ".") {
+			t.Errorf("opaque token %q looks like a JWT", token)
+		}
+		stored, ok := store.tokens[HashOpaqueToken(token)]
+		if !ok {
+			t.Fatal("token is not in the store")
+		}
+		// Хранилище не содержит самого токена.
+		if stored.Hash == token {
+			t.Error("token is stored in plaintext")
+		}
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		opts    []ValidateOption
+		wantErr error
+	}{
+		{"access token", tokens.AccessToken, []ValidateOption{WithTokenType(TokenTypeAccess)}, nil},
+		{"refresh token", tokens.RefreshToken, []ValidateOption{WithTokenType(TokenTypeRefresh)}, nil},
+		{"wrong type", tokens.RefreshToken, []ValidateOption{WithTokenType(TokenTypeAccess)}, ErrWrongTokenType},
+		{"unknown token", "unknown", nil, ErrTokenNotFound},
+		{"expired", tokens.AccessToken, []ValidateOption{WithClock(func() time.Time { return now.Add(time.Hour) })}, ErrTokenExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := issuer.ValidateToken(tt.token, tt.opts...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ValidateToken err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("ValidateToken err = %v does not wrap ErrInvalidToken", err)
+				}
+				return
+			}
+			if claims.Subject != "alice" || claims.Scope != "orders:read" {
+				t.Errorf("sub = %q, scope = %q", claims.Subject, claims.Scope)
+			}
+		})
+	}
+}
+
+func TestRevokeOpaqueToken(t *testing.T) {
+	store := newMemoryTokenStore()
+	issuer := newTestIssuer(t, Config{TokenFormat: TokenFormatOpaque, TokenStore: store})
+	tokens := generateTokens(t, issuer)
+
+	opaque, err := issuer.RevokeOpaqueToken(tokens.AccessToken)
+	if err != nil || !opaque {
+		t.Fatalf("RevokeOpaqueToken = %v, %v, want true", opaque, err)
+	}
+	if _, err := issuer.ValidateToken(tokens.AccessToken); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("revoked token: ValidateToken err = %v, want %v", err, ErrTokenNotFound)
+	}
+	if _, err := issuer.ValidateToken(tokens.RefreshToken); err != nil {
+		t.Errorf("refresh token: %v", err)
+	}
+
+	// Токены остальных форматов отзываются черным списком.
+	jwtIssuer := newTestIssuer(t, Config{})
+	if opaque, err := jwtIssuer.RevokeOpaqueToken(generateTokens(t, jwtIssuer).AccessToken); opaque || err != nil {
+		t.Errorf("RevokeOpaqueToken of a JWT = %v, %v, want false", opaque, err)
+	}
+}
+
+func TestNewIssuerTokenFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"jwt by default", Config{}, false},
+		{"opaque", Config{TokenFormat: TokenFormatOpaque, TokenStore: newMemoryTokenStore()}, false},
+		{"opaque without store", Config{TokenFormat: TokenFormatOpaque}, true},
+		{"unknown format", Config{TokenFormat: "paseto"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Secret = StaticSecret(testSecret)
+			_, err := NewIssuer(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewIssuer err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
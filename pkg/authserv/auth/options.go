@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TokenOption задает параметры выпуска токенов в GenerateToken.
+type TokenOption func(*tokenOptions)
+
+type tokenOptions struct {
+	familyID string
+	roles    []string
+	scopes   []string
+	clientID string
+	dpopJKT  string
+	audience []string
+
+	email         string
+	emailVerified bool
+}
+
+// WithFamily выпускает токены в существующем семействе familyID (при обновлении по refresh-токену).
+func WithFamily(familyID string) TokenOption {
+	return func(o *tokenOptions) {
+		o.familyID = familyID
+	}
+}
+
+// WithRoles добавляет в токены роли пользователя и разрешения этих ролей из Config.RoleScopes.
+func WithRoles(roles ...string) TokenOption {
+	return func(o *tokenOptions) {
+		o.roles = roles
+	}
+}
+
+// WithScopes добавляет в токены разрешения scopes.
+func WithScopes(scopes ...string) TokenOption {
+	return func(o *tokenOptions) {
+		o.scopes = scopes
+	}
+}
+
+// WithClientID указывает OAuth-клиента, которому выдаются токены.
+func WithClientID(clientID string) TokenOption {
+	return func(o *tokenOptions) {
+		o.clientID = clientID
+	}
+}
+
+// WithDPoPKey привязывает токены к ключу DPoP клиента с thumbprint jkt (claim cnf.jkt).
+func WithDPoPKey(jkt string) TokenOption {
+	return func(o *tokenOptions) {
+		o.dpopJKT = jkt
+	}
+}
+
+// WithEmail добавляет в токены адрес пользователя и признак его подтверждения.
+func WithEmail(email string, verified bool) TokenOption {
+	return func(o *tokenOptions) {
+		o.email = email
+		o.emailVerified = verified
+	}
+}
+
+// WithTokenAudience заменяет audience из Config на audience, например для токенов, полученных обменом.
+func WithTokenAudience(audience ...string) TokenOption {
+	return func(o *tokenOptions) {
+		o.audience = audience
+	}
+}
+
+func newTokenOptions(opts []TokenOption) *tokenOptions {
+	options := &tokenOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// ValidateOption задает дополнительные проверки токена в ValidateToken.
+// Опции переопределяют значения по умолчанию из Config или VerifierConfig.
+type ValidateOption func(*validateOptions)
+
+type validateOptions struct {
+	tokenType  string
+	issuer     string
+	audience   string
+	algorithms []string
+	leeway     time.Duration
+	clock      func() time.Time
+}
+
+// WithTokenType требует, чтобы токен имел тип tokenType (TokenTypeAccess, TokenTypeRefresh).
+func WithTokenType(tokenType string) ValidateOption {
+	return func(o *validateOptions) {
+		o.tokenType = tokenType
+	}
+}
+
+// WithIssuer требует, чтобы claim iss совпадал с issuer.
+func WithIssuer(issuer string) ValidateOption {
+	return func(o *validateOptions) {
+		o.issuer = issuer
+	}
+}
+
+// WithAudience требует, чтобы claim aud содержал audience.
+func WithAudience(audience string) ValidateOption {
+	return func(o *validateOptions) {
+		o.audience = audience
+	}
+}
+
+// WithAlgorithms ограничивает допустимые алгоритмы подписи.
+func WithAlgorithms(algorithms ...string) ValidateOption {
+	return func(o *validateOptions) {
+		o.algorithms = algorithms
+	}
+}
+
+// WithLeeway задает допуск на расхождение часов при проверке exp, nbf и iat.
+func WithLeeway(leeway time.Duration) ValidateOption {
+	return func(o *validateOptions) {
+		o.leeway = leeway
+	}
+}
+
+// WithClock подменяет источник текущего времени.
+func WithClock(clock func() time.Time) ValidateOption {
+	return func(o *validateOptions) {
+		o.clock = clock
+	}
+}
+
+func newValidateOptions(defaults validateOptions, opts []ValidateOption) *validateOptions {
+	options := defaults
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.clock == nil {
+		options.clock = time.Now
+	}
+	return &options
+}
+
+func (o *validateOptions) parserOptions() []jwt.ParserOption {
+	parserOptions := []jwt.ParserOption{
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(o.leeway),
+		jwt.WithTimeFunc(o.clock),
+	}
+	if o.issuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(o.issuer))
+	}
+	if o.audience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(o.audience))
+	}
+	return parserOptions
+}
+
+func (o *validateOptions) algorithmAllowed(alg string) bool {
+	if len(o.algorithms) == 0 {
+		return true
+	}
+	for _, allowed := range o.algorithms {
+		if allowed == alg {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,347 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+)
+
+// Заголовки токенов PASETO версии 4 (https://github.com/paseto-standard/paseto-spec).
+const (
+	pasetoV4Public = "v4.public."
+	pasetoV4Local  = "v4.local."
+
+	pasetoNonceSize = 32
+	pasetoMACSize   = 32
+	pasetoKeySize   = 32
+)
+
+// ErrKeyNotSuitable возвращается, если активный ключ нельзя использовать в выбранном формате токенов.
+var ErrKeyNotSuitable = errors.New("signing key is not suitable for token format")
+
+// pasetoTimeClaims - claims, которые в PASETO записываются строками ISO 8601, а не числами.
+var pasetoTimeClaims = []string{"exp", "nbf", "iat"}
+
+type pasetoFooter struct {
+	KeyID string `json:"kid,omitempty"`
+}
+
+// pasetoFormat выпускает токены PASETO v4.public (Ed25519, ключи EdDSA из KeySet)
+// или v4.local (XChaCha20 + BLAKE2b, 32-байтовые симметричные ключи HS256 из KeySet).
+// kid ключа передается в незашифрованном footer токена.
+type pasetoFormat struct {
+	keys   *KeySet
+	header string
+}
+
+func newPASETOFormat(keys *KeySet, header string) (pasetoFormat, error) {
+	format := pasetoFormat{keys: keys, header: header}
+	if err := format.checkKey(keys.Active()); err != nil {
+		return pasetoFormat{}, err
+	}
+	return format, nil
+}
+
+func (f pasetoFormat) checkKey(key *SigningKey) error {
+	switch f.header {
+	case pasetoV4Public:
+		if _, ok := key.Key.(ed25519.PrivateKey); ok {
+			return nil
+		}
+	case pasetoV4Local:
+		if secret, ok := key.Key.([]byte); ok && len(secret) == pasetoKeySize {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: key '%s' (%s) for %s", ErrKeyNotSuitable, key.ID, key.Algorithm, strings.TrimSuffix(f.header, "."))
+}
+
+func (f pasetoFormat) encode(claims *Claims) (string, error) {
+	key := f.keys.Active()
+	if err := f.checkKey(key); err != nil {
+		return "", err
+	}
+	payload, err := marshalPASETOClaims(claims)
+	if err != nil {
+		return "", err
+	}
+	var footer []byte
+	if key.ID != "" {
+		if footer, err = json.Marshal(pasetoFooter{KeyID: key.ID}); err != nil {
+			return "", err
+		}
+	}
+
+	if f.header == pasetoV4Public {
+		return pasetoV4Sign(key.Key.(ed25519.PrivateKey), payload, footer)
+	}
+	return pasetoV4Encrypt(key.Key.([]byte), payload, footer)
+}
+
+func (f pasetoFormat) decode(token string, options *validateOptions) (*Claims, error) {
+	if !strings.HasPrefix(token, f.header) {
+		return nil, ErrTokenMalformed
+	}
+	footer, err := pasetoFooterOf(token)
+	if err != nil {
+		return nil, err
+	}
+	var parsedFooter pasetoFooter
+	if len(footer) > 0 {
+		if err := json.Unmarshal(footer, &parsedFooter); err != nil {
+			return nil, ErrTokenMalformed
+		}
+	}
+	key, ok := f.keys.Lookup(parsedFooter.KeyID)
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if f.checkKey(key) != nil {
+		return nil, ErrAlgorithmNotAllowed
+	}
+
+	var payload []byte
+	if f.header == pasetoV4Public {
+		payload, err = pasetoV4Verify(key.Key.(ed25519.PrivateKey).Public().(ed25519.PublicKey), token)
+	} else {
+		payload, err = pasetoV4Decrypt(key.Key.([]byte), token)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := unmarshalPASETOClaims(payload)
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	return validateClaims(claims, options)
+}
+
+// pasetoV4Sign реализует v4.public Sign: Ed25519 над PAE(h, m, f, i) с пустым implicit assertion.
+func pasetoV4Sign(key ed25519.PrivateKey, payload, footer []byte) (string, error) {
+	signature := ed25519.Sign(key, pae([]byte(pasetoV4Public), payload, footer, nil))
+	return pasetoToken(pasetoV4Public, append(payload, signature...), footer), nil
+}
+
+// pasetoV4Verify реализует v4.public Verify и возвращает полезную нагрузку токена.
+func pasetoV4Verify(key ed25519.PublicKey, token string) ([]byte, error) {
+	body, footer, err := splitPASETO(token, pasetoV4Public)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < ed25519.SignatureSize {
+		return nil, ErrTokenMalformed
+	}
+	payload := body[:len(body)-ed25519.SignatureSize]
+	signature := body[len(body)-ed25519.SignatureSize:]
+	if !ed25519.Verify(key, pae([]byte(pasetoV4Public), payload, footer, nil), signature) {
+		return nil, ErrSignatureInvalid
+	}
+	return payload, nil
+}
+
+// pasetoV4Encrypt реализует v4.local Encrypt со случайным nonce.
+func pasetoV4Encrypt(key, payload, footer []byte) (string, error) {
+	nonce := make([]byte, pasetoNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return pasetoV4EncryptWithNonce(key, nonce, payload, footer)
+}
+
+func pasetoV4EncryptWithNonce(key, nonce, payload, footer []byte) (string, error) {
+	encryptionKey, counterNonce, authKey, err := pasetoV4Keys(key, nonce)
+	if err != nil {
+		return "", err
+	}
+	cipher, err := chacha20.NewUnauthenticatedCipher(encryptionKey, counterNonce)
+	if err != nil {
+		return "", err
+	}
+	ciphertext := make([]byte, len(payload))
+	cipher.XORKeyStream(ciphertext, payload)
+
+	mac, err := blake2bMAC(authKey, pae([]byte(pasetoV4Local), nonce, ciphertext, footer, nil))
+	if err != nil {
+		return "", err
+	}
+	body := make([]byte, 0, len(nonce)+len(ciphertext)+len(mac))
+	body = append(append(append(body, nonce...), ciphertext...), mac...)
+	return pasetoToken(pasetoV4Local, body, footer), nil
+}
+
+// pasetoV4Decrypt реализует v4.local Decrypt: MAC проверяется до расшифровки.
+func pasetoV4Decrypt(key []byte, token string) ([]byte, error) {
+	body, footer, err := splitPASETO(token, pasetoV4Local)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < pasetoNonceSize+pasetoMACSize {
+		return nil, ErrTokenMalformed
+	}
+	nonce := body[:pasetoNonceSize]
+	ciphertext := body[pasetoNonceSize : len(body)-pasetoMACSize]
+	mac := body[len(body)-pasetoMACSize:]
+
+	encryptionKey, counterNonce, authKey, err := pasetoV4Keys(key, nonce)
+	if err != nil {
+		return nil, err
+	}
+	expected, err := blake2bMAC(authKey, pae([]byte(pasetoV4Local), nonce, ciphertext, footer, nil))
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(mac, expected) != 1 {
+		return nil, ErrSignatureInvalid
+	}
+
+	cipher, err := chacha20.NewUnauthenticatedCipher(encryptionKey, counterNonce)
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]byte, len(ciphertext))
+	cipher.XORKeyStream(payload, ciphertext)
+	return payload, nil
+}
+
+// pasetoV4Keys выводит ключ шифрования, nonce XChaCha20 и ключ аутентификации из ключа и nonce токена.
+func pasetoV4Keys(key, nonce []byte) (encryptionKey, counterNonce, authKey []byte, err error) {
+	if len(key) != pasetoKeySize {
+		return nil, nil, nil, ErrKeyNotSuitable
+	}
+	hash, err := blake2b.New(56, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	hash.Write([]byte("paseto-encryption-key"))
+	hash.Write(nonce)
+	tmp := hash.Sum(nil)
+
+	authKey, err = blake2bMAC(key, append([]byte("paseto-auth-key-for-aead"), nonce...))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return tmp[:32], tmp[32:], authKey, nil
+}
+
+func blake2bMAC(key, message []byte) ([]byte, error) {
+	hash, err := blake2b.New256(key)
+	if err != nil {
+		return nil, err
+	}
+	hash.Write(message)
+	return hash.Sum(nil), nil
+}
+
+// pae - Pre-Authentication Encoding: число частей и длина каждой части как LE64.
+func pae(pieces ...[]byte) []byte {
+	var buf bytes.Buffer
+	le64 := func(n int) {
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], uint64(n)&(1<<63-1))
+		buf.Write(b[:])
+	}
+	le64(len(pieces))
+	for _, piece := range pieces {
+		le64(len(piece))
+		buf.Write(piece)
+	}
+	return buf.Bytes()
+}
+
+func pasetoToken(header string, body, footer []byte) string {
+	token := header + b64.EncodeToString(body)
+	if len(footer) > 0 {
+		token += "." + b64.EncodeToString(footer)
+	}
+	return token
+}
+
+// splitPASETO отделяет заголовок и возвращает декодированные тело и footer токена.
+func splitPASETO(token, header string) (body, footer []byte, err error) {
+	if !strings.HasPrefix(token, header) {
+		return nil, nil, ErrTokenMalformed
+	}
+	encodedBody, encodedFooter, _ := strings.Cut(strings.TrimPrefix(token, header), ".")
+	if body, err = b64.DecodeString(encodedBody); err != nil {
+		return nil, nil, ErrTokenMalformed
+	}
+	if footer, err = b64.DecodeString(encodedFooter); err != nil {
+		return nil, nil, ErrTokenMalformed
+	}
+	return body, footer, nil
+}
+
+func pasetoFooterOf(token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	switch len(parts) {
+	case 3:
+		return nil, nil
+	case 4:
+		footer, err := b64.DecodeString(parts[3])
+		if err != nil {
+			return nil, ErrTokenMalformed
+		}
+		return footer, nil
+	}
+	return nil, ErrTokenMalformed
+}
+
+// marshalPASETOClaims кодирует claims в JSON, записывая exp, nbf и iat в формате RFC 3339.
+func marshalPASETOClaims(claims *Claims) ([]byte, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for _, name := range pasetoTimeClaims {
+		if value, ok := fields[name].(float64); ok {
+			fields[name] = time.Unix(int64(value), 0).UTC().Format(time.RFC3339)
+		}
+	}
+	// В PASETO aud - строка.
+	if aud, ok := fields["aud"].([]interface{}); ok && len(aud) == 1 {
+		fields["aud"] = aud[0]
+	}
+	return json.Marshal(fields)
+}
+
+func unmarshalPASETOClaims(payload []byte) (*Claims, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, err
+	}
+	for _, name := range pasetoTimeClaims {
+		value, ok := fields[name].(string)
+		if !ok {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("claim %s: %w", name, err)
+		}
+		fields[name] = parsed.Unix()
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	claims := &Claims{}
+	if err := json.Unmarshal(data, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Тестовые векторы PASETO v4 из https://github.com/paseto-standard/test-vectors (v4.json)
+// с пустым implicit assertion.
+const (
+	pasetoVectorLocalKey  = "707172737475767778797a7b7c7d7e7f808182838485868788898a8b8c8d8e8f"
+	pasetoVectorSecretKey = "b4cbfb43df4ce210727d953e4a713307fa19bb7d9f85041438d9e11b942a3774" +
+		"1eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2"
+	pasetoVectorPublicKey = "1eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2"
+	pasetoVectorFooter    = `{"kid":"zVhMiPBP9fRf2snEcT7gFTioeA9COcNy9DfgL1W60haN"}`
+
+	// 4-E-3
+	pasetoVectorNonce        = "df654812bac492663825520ba2f6e67cf5ca5bdc13d4e7507a98cc4c2fcc3ad8"
+	pasetoVectorLocalPayload = `{"data":"this is a secret message","exp":"2022-01-01T00:00:00+00:00"}`
+	pasetoVectorLocalToken   = "v4.local.32VIErrEkmY4JVILovbmfPXKW9wT1OdQepjMTC_MOtjA4kiqw7_tcaOM5GNEcnTxl60WkwMsYXw6FSNb_UdJPXjpzm0KW9ojM5f4O2mRvE2IcweP-PRdoHjd5-RHCiExR1IK6t6-tyebyWG6Ov7kKvBdkrrAJ837lKP3iDag2hzUPHuMKA"
+
+	// 4-S-1 и 4-S-2
+	pasetoVectorPublicPayload = `{"data":"this is a signed message","exp":"2022-01-01T00:00:00+00:00"}`
+	pasetoVectorPublicToken   = "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9bg_XBBzds8lTZShVlwwKSgeKpLT3yukTw6JUz3W4h_ExsQV-P0V54zemZDcAxFaSeef1QlXEFtkqxT1ciiQEDA"
+	pasetoVectorFooterToken   = "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9v3Jt8mx_TdM2ceTGoqwrh4yDFn0XsHvvV_D0DtwQxVrJEBMl0F2caAdgnpKlt4p7xBnx1HcO-SPo8FPp214HDw.eyJraWQiOiJ6VmhNaVBCUDlmUmYyc25FY1Q3Z0ZUaW9lQTlDT2NOeTlEZmdMMVc2MGhhTiJ9"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestPASETOV4Local(t *testing.T) {
+	key := mustHex(t, pasetoVectorLocalKey)
+	token, err := pasetoV4EncryptWithNonce(key, mustHex(t, pasetoVectorNonce), []byte(pasetoVectorLocalPayload), nil)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if token != pasetoVectorLocalToken {
+		t.Errorf("encrypt = %s, want %s", token, pasetoVectorLocalToken)
+	}
+
+	withFooter, err := pasetoV4Encrypt(key, []byte(pasetoVectorLocalPayload), []byte(pasetoVectorFooter))
+	if err != nil {
+		t.Fatalf("encrypt with footer: %v", err)
+	}
+	otherKey := mustHex(t, strings.Repeat("00", pasetoKeySize))
+
+	tests := []struct {
+		name    string
+		key     []byte
+		token   string
+		payload string
+		err     error
+	}{
+		{name: "4-E-3", key: key, token: pasetoVectorLocalToken, payload: pasetoVectorLocalPayload},
+		{name: "footer", key: key, token: withFooter, payload: pasetoVectorLocalPayload},
+		{name: "wrong key", key: otherKey, token: pasetoVectorLocalToken, err: ErrSignatureInvalid},
+		{name: "short key", key: key[:16], token: pasetoVectorLocalToken, err: ErrKeyNotSuitable},
+		{name: "modified ciphertext", key: key, token: flipPASETOChar(pasetoVectorLocalToken, pasetoV4Local, 60), err: ErrSignatureInvalid},
+		{name: "modified footer", key: key, token: withFooter[:strings.LastIndex(withFooter, ".")+1] + b64.EncodeToString([]byte(`{"kid":"other"}`)), err: ErrSignatureInvalid},
+		{name: "added footer", key: key, token: pasetoVectorLocalToken + "." + b64.EncodeToString([]byte(pasetoVectorFooter)), err: ErrSignatureInvalid},
+		{name: "public header", key: key, token: "v4.public." + strings.TrimPrefix(pasetoVectorLocalToken, pasetoV4Local), err: ErrTokenMalformed},
+		{name: "other version", key: key, token: "v3.local." + strings.TrimPrefix(pasetoVectorLocalToken, pasetoV4Local), err: ErrTokenMalformed},
+		{name: "truncated", key: key, token: pasetoVectorLocalToken[:len(pasetoV4Local)+40], err: ErrTokenMalformed},
+		{name: "not base64url", key: key, token: pasetoV4Local + "not+base64/", err: ErrTokenMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := pasetoV4Decrypt(tt.key, tt.token)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("decrypt error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decrypt: %v", err)
+			}
+			if string(payload) != tt.payload {
+				t.Errorf("decrypt = %s, want %s", payload, tt.payload)
+			}
+		})
+	}
+}
+
+func TestPASETOV4Public(t *testing.T) {
+	secretKey := ed25519.PrivateKey(mustHex(t, pasetoVectorSecretKey))
+	publicKey := ed25519.PublicKey(mustHex(t, pasetoVectorPublicKey))
+
+	signTests := []struct {
+		name   string
+		footer string
+		token  string
+	}{
+		{name: "4-S-1", token: pasetoVectorPublicToken},
+		{name: "4-S-2", footer: pasetoVectorFooter, token: pasetoVectorFooterToken},
+	}
+	for _, tt := range signTests {
+		t.Run("sign "+tt.name, func(t *testing.T) {
+			token, err := pasetoV4Sign(secretKey, []byte(pasetoVectorPublicPayload), []byte(tt.footer))
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+			if token != tt.token {
+				t.Errorf("sign = %s, want %s", token, tt.token)
+			}
+		})
+	}
+
+	otherKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	footerStart := strings.LastIndex(pasetoVectorFooterToken, ".")
+
+	verifyTests := []struct {
+		name  string
+		key   ed25519.PublicKey
+		token string
+		err   error
+	}{
+		{name: "4-S-1", key: publicKey, token: pasetoVectorPublicToken},
+		{name: "4-S-2", key: publicKey, token: pasetoVectorFooterToken},
+		{name: "wrong key", key: otherKey, token: pasetoVectorPublicToken, err: ErrSignatureInvalid},
+		{name: "modified payload", key: publicKey, token: flipPASETOChar(pasetoVectorPublicToken, pasetoV4Public, 20), err: ErrSignatureInvalid},
+		{name: "modified signature", key: publicKey, token: flipPASETOChar(pasetoVectorPublicToken, pasetoV4Public, len(pasetoVectorPublicToken)-len(pasetoV4Public)-10), err: ErrSignatureInvalid},
+		{name: "removed footer", key: publicKey, token: pasetoVectorFooterToken[:footerStart], err: ErrSignatureInvalid},
+		{name: "modified footer", key: publicKey, token: pasetoVectorFooterToken[:footerStart+1] + b64.EncodeToString([]byte(`{"kid":"other"}`)), err: ErrSignatureInvalid},
+		{name: "local header", key: publicKey, token: "v4.local." + strings.TrimPrefix(pasetoVectorPublicToken, pasetoV4Public), err: ErrTokenMalformed},
+		{name: "truncated", key: publicKey, token: pasetoVectorPublicToken[:len(pasetoV4Public)+40], err: ErrTokenMalformed},
+	}
+	for _, tt := range verifyTests {
+		t.Run("verify "+tt.name, func(t *testing.T) {
+			payload, err := pasetoV4Verify(tt.key, tt.token)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("verify error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			if string(payload) != pasetoVectorPublicPayload {
+				t.Errorf("verify = %s, want %s", payload, pasetoVectorPublicPayload)
+			}
+		})
+	}
+}
+
+// flipPASETOChar заменяет символ токена с индексом i, отсчитанным от конца заголовка header,
+// другим символом base64url.
+func flipPASETOChar(token, header string, i int) string {
+	body := []byte(strings.TrimPrefix(token, header))
+	if body[i] == 'A' {
+		body[i] = 'B'
+	} else {
+		body[i] = 'A'
+	}
+	return header + string(body)
+}
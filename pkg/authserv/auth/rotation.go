@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultRotationAlgorithm = AlgES256
+	DefaultRotationInterval  = 30 * 24 * time.Hour
+	DefaultActivationDelay   = 2 * time.Minute
+)
+
+var ErrNoActiveKey = errors.New("no active signing key in key store")
+
+// StoredKey - ключ подписи в хранилище. Key содержит PEM асимметричного ключа или HMAC-секрет,
+// зашифрованные KeyCipher, если Encrypted (ключи, сохраненные без шифрования, шифруются RotateKeysIfDue).
+// Активный ключ подписывает токены с ActivateAt (nil - сразу), до этого он только публикуется
+// для проверки. После RetireAt ключ больше не принимается и удаляется из хранилища.
+type StoredKey struct {
+	ID         string
+	Algorithm  string
+	Key        []byte
+	Encrypted  bool
+	Active     bool
+	CreatedAt  time.Time
+	ActivateAt *time.Time
+	RetireAt   *time.Time
+}
+
+// activeSince возвращает момент, с которого ключ подписывает токены.
+func (k StoredKey) activeSince() time.Time {
+	if k.ActivateAt != nil {
+		return *k.ActivateAt
+	}
+	return k.CreatedAt
+}
+
+// KeyStore хранит ключи подписи, общие для всех экземпляров authserv.
+type KeyStore interface {
+	SaveSigningKey(key StoredKey) error
+	GetSigningKeys() ([]StoredKey, error)
+	DeleteRetiredSigningKeys(now time.Time) error
+}
+
+// RotationConfig задает плановую ротацию ключей из KeyStore.
+// Пустой Algorithm выбирается по Config.TokenFormat: EdDSA для PASETO v4.public, HS256
+// (32-байтовый ключ) для PASETO v4.local и DefaultRotationAlgorithm для остальных форматов.
+// Новый ключ создается, когда активному ключу исполняется Interval.
+// ActivationDelay - сколько новый ключ только публикуется для проверки, прежде чем начать
+// подписывать токены. Он должен превышать период SyncKeys/RotateKeysIfDue на всех экземплярах,
+// иначе их токены, подписанные новым ключом, будут отклоняться остальными экземплярами.
+type RotationConfig struct {
+	Algorithm       string
+	Interval        time.Duration
+	ActivationDelay time.Duration
+}
+
+// setAlgorithm выбирает алгоритм ключей по умолчанию для формата токенов format и проверяет,
+// что ключи заданного алгоритма подходят формату: иначе первая же ротация сломала бы выпуск токенов.
+func (c *RotationConfig) setAlgorithm(format string) error {
+	required := ""
+	switch format {
+	case TokenFormatPASETOPublic:
+		required = AlgEdDSA
+	case TokenFormatPASETOLocal:
+		required = AlgHS256
+	}
+	if c.Algorithm == "" {
+		c.Algorithm = required
+		if required == "" {
+			c.Algorithm = DefaultRotationAlgorithm
+		}
+		return nil
+	}
+	if required != "" && c.Algorithm != required {
+		return fmt.Errorf("%w: rotation algorithm '%s' for %s", ErrKeyNotSuitable, c.Algorithm, format)
+	}
+	return nil
+}
+
+// SyncKeys перечитывает ключи из KeyStore.
+func (i *Issuer) SyncKeys() error {
+	if i.store == nil {
+		return nil
+	}
+	stored, err := i.store.GetSigningKeys()
+	if err != nil {
+		return fmt.Errorf("load signing keys: %w", err)
+	}
+	_, _, err = i.applyStoredKeys(stored, i.clock())
+	return err
+}
+
+// RotateKeys создает новый активный ключ, который начнет подписывать токены через
+// RotationConfig.ActivationDelay. Прежние активные ключи подписывают токены до этого момента
+// и остаются ключами проверки на время жизни самого долгоживущего токена, после чего удаляются.
+func (i *Issuer) RotateKeys() error {
+	return i.rotateKeys(i.rotation.ActivationDelay)
+}
+
+func (i *Issuer) rotateKeys(activationDelay time.Duration) error {
+	if i.store == nil {
+		return errors.New("key store is not configured")
+	}
+	now := i.clock()
+	stored, err := i.store.GetSigningKeys()
+	if err != nil {
+		return fmt.Errorf("load signing keys: %w", err)
+	}
+
+	key, err := GenerateSigningKey(i.rotation.Algorithm)
+	if err != nil {
+		return err
+	}
+	data, err := key.marshalKey()
+	if err != nil {
+		return err
+	}
+	data, err = i.keyCipher.Encrypt(key.ID, data)
+	if err != nil {
+		return fmt.Errorf("encrypt signing key '%s': %w", key.ID, err)
+	}
+	activateAt := now.Add(activationDelay)
+	record := StoredKey{
+		ID:         key.ID,
+		Algorithm:  key.Algorithm,
+		Key:        data,
+		Encrypted:  true,
+		Active:     true,
+		CreatedAt:  now,
+		ActivateAt: &activateAt,
+	}
+	if err := i.store.SaveSigningKey(record); err != nil {
+		return fmt.Errorf("save signing key '%s': %w", key.ID, err)
+	}
+
+	// Прежний ключ остается активным до activateAt: из нескольких активных ключей подписывает
+	// самый новый из уже вступивших в действие.
+	retireAt := activateAt.Add(i.maxTTL())
+	for _, old := range stored {
+		if !old.Active || old.RetireAt != nil {
+			continue
+		}
+		old.RetireAt = &retireAt
+		if err := i.store.SaveSigningKey(old); err != nil {
+			return fmt.Errorf("retire signing key '%s': %w", old.ID, err)
+		}
+	}
+
+	return i.SyncKeys()
+}
+
+// RotateKeysIfDue удаляет выведенные из оборота ключи, шифрует ключи, сохраненные без шифрования,
+// перечитывает KeySet и выполняет ротацию, если активный ключ старше RotationConfig.Interval.
+func (i *Issuer) RotateKeysIfDue() error {
+	if i.store == nil {
+		return nil
+	}
+	now := i.clock()
+	if err := i.store.DeleteRetiredSigningKeys(now); err != nil {
+		return fmt.Errorf("delete retired signing keys: %w", err)
+	}
+	stored, err := i.store.GetSigningKeys()
+	if err != nil {
+		return fmt.Errorf("load signing keys: %w", err)
+	}
+	if err := i.encryptStoredKeys(stored); err != nil {
+		return err
+	}
+
+	activeSince, pending, err := i.applyStoredKeys(stored, now)
+	if errors.Is(err, ErrNoActiveKey) && !pending {
+		return i.rotateKeys(0)
+	}
+	if err == nil && !pending && i.rotation.Interval > 0 && now.Sub(activeSince) >= i.rotation.Interval {
+		return i.RotateKeys()
+	}
+	return err
+}
+
+// KeyRotationEnabled сообщает, нужно ли периодически вызывать RotateKeysIfDue.
+func (i *Issuer) KeyRotationEnabled() bool {
+	return i.store != nil
+}
+
+// applyStoredKeys загружает в KeySet действующие ключи. Если активных ключей несколько
+// (например, во время ActivationDelay или после одновременной ротации на двух экземплярах),
+// подписывает самый новый из вступивших в действие. Возвращается момент, с которого он подписывает
+// токены, и есть ли ключ, ожидающий вступления в действие.
+func (i *Issuer) applyStoredKeys(stored []StoredKey, now time.Time) (time.Time, bool, error) {
+	var (
+		active       *SigningKey
+		activeSince  time.Time
+		pending      bool
+		verification []*SigningKey
+	)
+	for _, record := range stored {
+		if record.RetireAt != nil && !record.RetireAt.After(now) {
+			continue
+		}
+		key, err := i.openStoredKey(record)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("signing key '%s': %w", record.ID, err)
+		}
+		since := record.activeSince()
+		if record.Active && since.After(now) {
+			pending = true
+		} else if record.Active && (active == nil || since.After(activeSince)) {
+			if active != nil {
+				verification = append(verification, active)
+			}
+			active, activeSince = key, since
+			continue
+		}
+		verification = append(verification, key)
+	}
+	if active == nil {
+		return time.Time{}, pending, ErrNoActiveKey
+	}
+	return activeSince, pending, i.keys.Replace(active, verification...)
+}
+
+// openStoredKey расшифровывает и разбирает ключ из хранилища.
+func (i *Issuer) openStoredKey(record StoredKey) (*SigningKey, error) {
+	data := record.Key
+	if record.Encrypted {
+		var err error
+		if data, err = i.keyCipher.Decrypt(record.ID, data); err != nil {
+			return nil, err
+		}
+	}
+	return unmarshalKey(record.ID, record.Algorithm, data)
+}
+
+// encryptStoredKeys шифрует и пересохраняет ключи, сохраненные без шифрования.
+func (i *Issuer) encryptStoredKeys(stored []StoredKey) error {
+	for n, record := range stored {
+		if record.Encrypted {
+			continue
+		}
+		data, err := i.keyCipher.Encrypt(record.ID, record.Key)
+		if err != nil {
+			return fmt.Errorf("encrypt signing key '%s': %w", record.ID, err)
+		}
+		record.Key, record.Encrypted = data, true
+		if err := i.store.SaveSigningKey(record); err != nil {
+			return fmt.Errorf("save signing key '%s': %w", record.ID, err)
+		}
+		stored[n] = record
+	}
+	return nil
+}
+
+func (i *Issuer) maxTTL() time.Duration {
+	if i.refreshTTL > i.accessTTL {
+		return i.refreshTTL
+	}
+	return i.accessTTL
+}
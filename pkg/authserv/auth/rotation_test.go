@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryKeyStore - KeyStore в памяти.
+type memoryKeyStore struct {
+	mu   sync.Mutex
+	keys map[string]StoredKey
+}
+
+func newMemoryKeyStore() *memoryKeyStore {
+	return &memoryKeyStore{keys: make(map[string]StoredKey)}
+}
+
+func (s *memoryKeyStore) SaveSigningKey(key StoredKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key.ID] = key
+	return nil
+}
+
+func (s *memoryKeyStore) GetSigningKeys() ([]StoredKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]StoredKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *memoryKeyStore) DeleteRetiredSigningKeys(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, key := range s.keys {
+		if key.RetireAt != nil && !key.RetireAt.After(now) {
+			delete(s.keys, id)
+		}
+	}
+	return nil
+}
+
+// backdate сдвигает все даты ключей хранилища на d в прошлое.
+func (s *memoryKeyStore) backdate(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, key := range s.keys {
+		key.CreatedAt = key.CreatedAt.Add(-d)
+		if key.ActivateAt != nil {
+			activateAt := key.ActivateAt.Add(-d)
+			key.ActivateAt = &activateAt
+		}
+		if key.RetireAt != nil {
+			retireAt := key.RetireAt.Add(-d)
+			key.RetireAt = &retireAt
+		}
+		s.keys[id] = key
+	}
+}
+
+func newTestKeyCipher(t *testing.T) *KeyCipher {
+	t.Helper()
+	keyCipher, err := NewKeyCipher(bytes.Repeat([]byte("e"), KeyCipherKeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyCipher
+}
+
+func tokenKeyID(t *testing.T, issuer *Issuer) (string, string) {
+	t.Helper()
+	return generateTokens(t, issuer).AccessToken, issuer.keys.Active().ID
+}
+
+func TestIssuerKeyRotation(t *testing.T) {
+	store := newMemoryKeyStore()
+	keyCipher := newTestKeyCipher(t)
+	issuer := newTestIssuer(t, Config{KeyStore: store, KeyCipher: keyCipher, Rotation: RotationConfig{Interval: time.Hour}})
+	// Второй экземпляр с тем же хранилищем.
+	replica := newTestIssuer(t, Config{KeyStore: store, KeyCipher: keyCipher, Rotation: RotationConfig{Interval: time.Hour}})
+
+	oldToken, oldKID := tokenKeyID(t, issuer)
+	if _, replicaKID := tokenKeyID(t, replica); replicaKID != oldKID {
+		t.Fatalf("replica signs with '%s', want the stored key '%s'", replicaKID, oldKID)
+	}
+
+	if err := issuer.RotateKeysIfDue(); err != nil {
+		t.Fatal(err)
+	}
+	if _, kid := tokenKeyID(t, issuer); kid != oldKID {
+		t.Fatalf("key was rotated before the interval: '%s'", kid)
+	}
+
+	store.backdate(time.Hour)
+	if err := issuer.RotateKeysIfDue(); err != nil {
+		t.Fatal(err)
+	}
+	if err := replica.SyncKeys(); err != nil {
+		t.Fatal(err)
+	}
+	// Новый ключ сначала только публикуется, а подписывает прежний.
+	if _, kid := tokenKeyID(t, issuer); kid != oldKID {
+		t.Fatalf("new key '%s' signs before its activation", kid)
+	}
+	if keys := replica.JWKS().Keys; len(keys) != 2 {
+		t.Fatalf("replica publishes %d keys, want the old and the pending one", len(keys))
+	}
+
+	store.backdate(DefaultActivationDelay)
+	if err := issuer.SyncKeys(); err != nil {
+		t.Fatal(err)
+	}
+	newToken, newKID := tokenKeyID(t, issuer)
+	if newKID == oldKID {
+		t.Fatal("key was not rotated after the activation delay")
+	}
+	if err := replica.SyncKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := replica.JWKS()
+	verifier, err := NewJWKSVerifier(context.Background(), VerifierConfig{JWKS: &jwks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		if _, err := replica.ValidateToken(token); err != nil {
+			t.Errorf("replica rejected the %s token: %v", name, err)
+		}
+		if _, err := verifier.ValidateToken(token); err != nil {
+			t.Errorf("JWKS verifier rejected the %s token: %v", name, err)
+		}
+	}
+
+	// Прежний ключ удаляется, когда истекают все подписанные им токены.
+	store.backdate(DefaultRefreshTTL)
+	if err := issuer.RotateKeysIfDue(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := issuer.keys.Lookup(oldKID); ok {
+		t.Errorf("retired key '%s' is still accepted", oldKID)
+	}
+}
+
+func TestKeyStoreEncryption(t *testing.T) {
+	store := newMemoryKeyStore()
+	keyCipher := newTestKeyCipher(t)
+	if _, err := NewIssuer(Config{KeyStore: store}); !errors.Is(err, ErrNoKeyCipher) {
+		t.Fatalf("NewIssuer without key cipher err = %v, want %v", err, ErrNoKeyCipher)
+	}
+
+	// Ключ, сохраненный до включения шифрования.
+	key, err := GenerateSigningKey(AlgES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := key.marshalKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveSigningKey(StoredKey{ID: key.ID, Algorithm: key.Algorithm, Key: data, Active: true, CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := newTestIssuer(t, Config{KeyStore: store, KeyCipher: keyCipher})
+	if err := issuer.RotateKeysIfDue(); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := store.GetSigningKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || !stored[0].Encrypted || bytes.Contains(stored[0].Key, []byte("PRIVATE KEY")) {
+		t.Fatalf("stored key = %+v, want it encrypted", stored[0])
+	}
+	if _, kid := tokenKeyID(t, issuer); kid != key.ID {
+		t.Errorf("issuer signs with '%s', want the stored key '%s'", kid, key.ID)
+	}
+
+	// Экземпляр с другим ключом шифрования не может прочитать ключи.
+	other, err := NewKeyCipher(bytes.Repeat([]byte("x"), KeyCipherKeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewIssuer(Config{KeyStore: store, KeyCipher: other}); !errors.Is(err, ErrKeyDecryption) {
+		t.Errorf("NewIssuer with another key cipher err = %v, want %v", err, ErrKeyDecryption)
+	}
+}
+
+func TestKeySetReplace(t *testing.T) {
+	first, err := GenerateSigningKey(AlgES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := GenerateSigningKey(AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		active       *SigningKey
+		verification []*SigningKey
+		wantErr      bool
+	}{
+		{"active only", first, nil, false},
+		{"with verification key", first, []*SigningKey{second}, false},
+		{"no active key", nil, []*SigningKey{second}, true},
+		{"duplicate key id", first, []*SigningKey{first}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := NewKeySet(first)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = set.Replace(tt.active, tt.verification...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Replace err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				// Неудачная замена не меняет набор.
+				if set.Active() != first || len(set.Keys()) != 1 {
+					t.Error("failed Replace modified the key set")
+				}
+				return
+			}
+			if set.Active() != tt.active || len(set.JWKS().Keys) != 1+len(tt.verification) {
+				t.Errorf("key set = %v, want active '%s' and %d keys", set.Keys(), tt.active.ID, 1+len(tt.verification))
+			}
+		})
+	}
+}
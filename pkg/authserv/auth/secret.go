@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// SecretProvider возвращает секрет, которым подписываются токены.
+type SecretProvider interface {
+	Secret() ([]byte, error)
+}
+
+// SecretProviderFunc позволяет использовать обычную функцию как SecretProvider.
+type SecretProviderFunc func() ([]byte, error)
+
+func (f SecretProviderFunc) Secret() ([]byte, error) {
+	return f()
+}
+
+// StaticSecret возвращает заранее заданный секрет.
+func StaticSecret(secret []byte) SecretProvider {
+	return SecretProviderFunc(func() ([]byte, error) {
+		return secret, nil
+	})
+}
+
+// EnvSecret читает секрет из переменной окружения name.
+func EnvSecret(name string) SecretProvider {
+	return SecretProviderFunc(func() ([]byte, error) {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("environment variable '%s' is not set", name)
+		}
+		return []byte(value), nil
+	})
+}
+
+// FileSecret читает секрет из файла path. Завершающие пробелы и переводы строк отбрасываются.
+func FileSecret(path string) SecretProvider {
+	return SecretProviderFunc(func() ([]byte, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read secret file '%s': %w", path, err)
+		}
+		return bytes.TrimRight(data, " \t\r\n"), nil
+	})
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJWKSRefreshInterval = time.Minute
+	defaultJWKSFetchTimeout    = 10 * time.Second
+)
+
+// VerifierConfig содержит параметры JWKSVerifier.
+// Ключи берутся из JWKS, а если он не задан - загружаются по JWKSURL.
+type VerifierConfig struct {
+	JWKS       *JWKS
+	JWKSURL    string
+	HTTPClient *http.Client
+	// MinRefreshInterval ограничивает частоту повторной загрузки JWKS при встрече неизвестного kid.
+	MinRefreshInterval time.Duration
+	Issuer             string
+	Audience           string
+	Leeway             time.Duration
+}
+
+// JWKSVerifier проверяет токены по открытым ключам из JWKS и не требует закрытых ключей.
+type JWKSVerifier struct {
+	config VerifierConfig
+
+	mu          sync.RWMutex
+	keys        map[string]*verificationKey
+	lastRefresh time.Time
+}
+
+// NewJWKSVerifier создает JWKSVerifier. При заданном JWKSURL набор ключей загружается сразу.
+func NewJWKSVerifier(ctx context.Context, config VerifierConfig) (*JWKSVerifier, error) {
+	if config.JWKS == nil && config.JWKSURL == "" {
+		return nil, errors.New("neither JWKS nor JWKS URL is configured")
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: defaultJWKSFetchTimeout}
+	}
+	if config.MinRefreshInterval <= 0 {
+		config.MinRefreshInterval = defaultJWKSRefreshInterval
+	}
+
+	verifier := &JWKSVerifier{config: config}
+	if config.JWKS != nil {
+		if err := verifier.setKeys(*config.JWKS); err != nil {
+			return nil, err
+		}
+		return verifier, nil
+	}
+	if err := verifier.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return verifier, nil
+}
+
+func (v *JWKSVerifier) ValidateToken(tokenString string, opts ...ValidateOption) (*Claims, error) {
+	defaults := validateOptions{
+		issuer:   v.config.Issuer,
+		audience: v.config.Audience,
+		leeway:   v.config.Leeway,
+	}
+	return parseToken(tokenString, v.lookupKey, newValidateOptions(defaults, opts))
+}
+
+// Refresh заново загружает JWKS по JWKSURL.
+func (v *JWKSVerifier) Refresh(ctx context.Context) error {
+	v.mu.Lock()
+	v.lastRefresh = time.Now()
+	v.mu.Unlock()
+
+	jwks, err := FetchJWKS(ctx, v.config.HTTPClient, v.config.JWKSURL)
+	if err != nil {
+		return err
+	}
+	return v.setKeys(jwks)
+}
+
+// FetchJWKS загружает JWKS по адресу url.
+func FetchJWKS(ctx context.Context, client *http.Client, url string) (JWKS, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return JWKS{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return JWKS{}, fmt.Errorf("fetch JWKS '%s': %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return JWKS{}, fmt.Errorf("fetch JWKS '%s': unexpected status %d", url, resp.StatusCode)
+	}
+	var jwks JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return JWKS{}, fmt.Errorf("decode JWKS '%s': %w", url, err)
+	}
+	return jwks, nil
+}
+
+func (v *JWKSVerifier) setKeys(jwks JWKS) error {
+	keys := make(map[string]*verificationKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if jwk.Algorithm == "" {
+			return fmt.Errorf("JWK '%s' has no 'alg'", jwk.KeyID)
+		}
+		publicKey, err := jwk.PublicKey()
+		if err != nil {
+			return fmt.Errorf("JWK '%s': %w", jwk.KeyID, err)
+		}
+		keys[jwk.KeyID] = &verificationKey{algorithm: jwk.Algorithm, key: publicKey}
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.mu.Unlock()
+	return nil
+}
+
+// lookupKey ищет ключ по kid. Неизвестный kid приводит к повторной загрузке JWKS,
+// но не чаще, чем раз в MinRefreshInterval.
+func (v *JWKSVerifier) lookupKey(kid string) (*verificationKey, error) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	canRefresh := v.config.JWKSURL != "" && time.Since(v.lastRefresh) >= v.config.MinRefreshInterval
+	v.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	if !canRefresh {
+		return nil, ErrUnknownKey
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultJWKSFetchTimeout)
+	defer cancel()
+	if err := v.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	v.mu.RLock()
+	key, ok = v.keys[kid]
+	v.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
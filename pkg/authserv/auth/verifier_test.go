@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testJWKSServer раздает изменяемый JWKS и считает число загрузок.
+type testJWKSServer struct {
+	mu      sync.Mutex
+	jwks    JWKS
+	fetches int
+}
+
+func (s *testJWKSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetches++
+	_ = json.NewEncoder(w).Encode(s.jwks)
+}
+
+func (s *testJWKSServer) setKeys(keys ...JWK) {
+	s.mu.Lock()
+	s.jwks = JWKS{Keys: keys}
+	s.mu.Unlock()
+}
+
+func (s *testJWKSServer) fetchCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+type testSigner struct {
+	kid string
+	key *ecdsa.PrivateKey
+	jwk JWK
+}
+
+func newTestSigner(t *testing.T, kid string) *testSigner {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := NewJWK(kid, "ES256", &key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSigner{kid: kid, key: key, jwk: jwk}
+}
+
+func (s *testSigner) token(t *testing.T) string {
+	t.Helper()
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, &Claims{
+		Username: "alice",
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	})
+	token.Header["kid"] = s.kid
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestJWKSVerifierCache(t *testing.T) {
+	first := newTestSigner(t, "key-1")
+	second := newTestSigner(t, "key-2")
+	unknown := newTestSigner(t, "key-3")
+
+	jwks := &testJWKSServer{}
+	jwks.setKeys(first.jwk)
+	server := httptest.NewServer(jwks)
+	defer server.Close()
+
+	verifier, err := NewJWKSVerifier(context.Background(), VerifierConfig{
+		JWKSURL:            server.URL,
+		MinRefreshInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks.setKeys(first.jwk, second.jwk)
+
+	// allowRefresh имитирует истечение MinRefreshInterval с последней загрузки.
+	allowRefresh := func() {
+		verifier.mu.Lock()
+		verifier.lastRefresh = time.Now().Add(-time.Hour)
+		verifier.mu.Unlock()
+	}
+
+	steps := []struct {
+		name        string
+		before      func()
+		token       string
+		wantErr     bool
+		wantFetches int
+	}{
+		{name: "cached key", token: first.token(t), wantFetches: 1},
+		{name: "new key before refresh interval", token: second.token(t), wantErr: true, wantFetches: 1},
+		{name: "new key after refresh interval", before: allowRefresh, token: second.token(t), wantFetches: 2},
+		{name: "refreshed key is cached", token: second.token(t), wantFetches: 2},
+		{name: "unknown key is rate limited", token: unknown.token(t), wantErr: true, wantFetches: 2},
+		{name: "unknown key after refresh interval", before: allowRefresh, token: unknown.token(t), wantErr: true, wantFetches: 3},
+	}
+	for _, step := range steps {
+		if step.before != nil {
+			step.before()
+		}
+		_, err := verifier.ValidateToken(step.token)
+		if (err != nil) != step.wantErr {
+			t.Errorf("%s: ValidateToken err = %v, want error %v", step.name, err, step.wantErr)
+		}
+		if got := jwks.fetchCount(); got != step.wantFetches {
+			t.Errorf("%s: JWKS fetched %d times, want %d", step.name, got, step.wantFetches)
+		}
+	}
+}
+
+func TestJWKSVerifierStatic(t *testing.T) {
+	signer := newTestSigner(t, "key-1")
+	encryption := newTestSigner(t, "key-2")
+	encryption.jwk.Use = "enc"
+
+	verifier, err := NewJWKSVerifier(context.Background(), VerifierConfig{
+		JWKS: &JWKS{Keys: []JWK{signer.jwk, encryption.jwk}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"signing key", signer.token(t), false},
+		{"encryption key is skipped", encryption.token(t), true},
+		{"unknown key without URL", newTestSigner(t, "key-3").token(t), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.ValidateToken(tt.token)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("ValidateToken accepted the token")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateToken: %v", err)
+			}
+			if claims.Username != "alice" {
+				t.Errorf("username = %q, want alice", claims.Username)
+			}
+		})
+	}
+}
+
+func TestNewJWKSVerifierInvalidJWKS(t *testing.T) {
+	signer := newTestSigner(t, "key-1")
+	withoutAlg := signer.jwk
+	withoutAlg.Algorithm = ""
+
+	tests := []struct {
+		name   string
+		config VerifierConfig
+	}{
+		{"no source", VerifierConfig{}},
+		{"key without alg", VerifierConfig{JWKS: &JWKS{Keys: []JWK{withoutAlg}}}},
+		{"invalid key", VerifierConfig{JWKS: &JWKS{Keys: []JWK{{KeyType: "EC", Curve: "P-256", Algorithm: "ES256"}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewJWKSVerifier(context.Background(), tt.config); err == nil {
+				t.Error("NewJWKSVerifier accepted an invalid configuration")
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package auth
+
+import "fmt"
+
+// TokenVersions хранит версии токенов пользователей, например repository.AuthRepository.
+// Увеличение версии пользователя делает недействительными все выпущенные ему ранее токены.
+// Для неизвестного пользователя GetTokenVersion возвращает ErrTokenRevoked.
+type TokenVersions interface {
+	GetTokenVersion(username string) (int64, error)
+}
+
+// tokenVersion возвращает текущую версию токенов username или 0, если версии не ведутся.
+func (i *Issuer) tokenVersion(username string) (int64, error) {
+	if i.versions == nil || username == "" {
+		return 0, nil
+	}
+	version, err := i.versions.GetTokenVersion(username)
+	if err != nil {
+		return 0, fmt.Errorf("load token version of '%s': %w", username, err)
+	}
+	return version, nil
+}
+
+// checkTokenVersion отклоняет токены пользователя, выпущенные до последнего увеличения его версии.
+func (i *Issuer) checkTokenVersion(claims *Claims) error {
+	version, err := i.tokenVersion(claims.Username)
+	if err != nil {
+		return err
+	}
+	if claims.TokenVersion < version {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// TokenVersionsEnabled сообщает, проверяются ли версии токенов пользователей (задан ли Config.TokenVersions).
+func (i *Issuer) TokenVersionsEnabled() bool {
+	return i.versions != nil
+}
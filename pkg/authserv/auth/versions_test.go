@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+// memoryTokenVersions - TokenVersions в памяти.
+type memoryTokenVersions map[string]int64
+
+func (v memoryTokenVersions) GetTokenVersion(username string) (int64, error) {
+	version, ok := v[username]
+	if !ok {
+		return 0, ErrTokenRevoked
+	}
+	return version, nil
+}
+
+func TestTokenVersions(t *testing.T) {
+	versions := memoryTokenVersions{"alice": 1}
+	issuer := newTestIssuer(t, Config{TokenVersions: versions})
+	old := generateTokens(t, issuer)
+	if old.AccessClaims.TokenVersion != 1 || old.RefreshClaims.TokenVersion != 1 {
+		t.Fatalf("token versions = %d, %d, want 1", old.AccessClaims.TokenVersion, old.RefreshClaims.TokenVersion)
+	}
+	if _, err := issuer.ValidateToken(old.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+
+	// Увеличение версии отзывает ранее выпущенные токены, но не новые.
+	versions["alice"] = 2
+	for name, token := range map[string]string{"access": old.AccessToken, "refresh": old.RefreshToken} {
+		if _, err := issuer.ValidateToken(token); !errors.Is(err, ErrTokenRevoked) {
+			t.Errorf("old %s token: err = %v, want %v", name, err, ErrTokenRevoked)
+		}
+	}
+	if _, err := issuer.ValidateToken(generateTokens(t, issuer).AccessToken); err != nil {
+		t.Errorf("new token: %v", err)
+	}
+
+	// Токены клиентов не имеют пользователя и версий.
+	clientToken, _, err := issuer.GenerateAccessToken("billing", WithClientID("billing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issuer.ValidateToken(clientToken); err != nil {
+		t.Errorf("client token: %v", err)
+	}
+
+	delete(versions, "alice")
+	if _, err := issuer.GenerateToken("alice"); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("GenerateToken for unknown user: err = %v, want %v", err, ErrTokenRevoked)
+	}
+}
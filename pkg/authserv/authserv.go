@@ -2,10 +2,15 @@ package authserv
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
 	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/handlers"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/middleware"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/notify"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/password"
 	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
 	log "github.com/SergeyIvanovDevelop/tss-tools/pkg/logger"
 
@@ -16,26 +21,96 @@ var pkgLog log.Log
 
 const pkgName string = "tss-tools/pkg/authserv"
 
+// ErrNoTokenVersions возвращается Run, если issuer создан без auth.Config.TokenVersions.
+var ErrNoTokenVersions = errors.New("issuer must be configured with token versions")
+
 // ServerConfig содержит параметры для настройки сервера.
 type ServerConfig struct {
 	Addr         string
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
+	// KeyRotationCheckInterval - период синхронизации и ротации ключей подписи (по умолчанию 1 минута).
+	// Должен быть меньше auth.RotationConfig.ActivationDelay.
+	KeyRotationCheckInterval time.Duration
+	// DPoPRequired запрещает доступ к защищенным ресурсам с токенами, не привязанными к ключу DPoP.
+	// Токены привязываются к ключу DPoP proof запроса на их выдачу: /oauth/token, а также
+	// регистрации, входа, подтверждения MFA и обновления в /api/user.
+	DPoPRequired bool
+	// PasswordPolicy проверяет пароли при регистрации и смене пароля, по умолчанию password.DefaultPolicy.
+	PasswordPolicy *password.Policy
+	// Notifier доставляет пользователям токены сброса пароля и подтверждения адреса.
+	// Если не задан, сброс пароля отключен, а адреса не подтверждаются.
+	Notifier notify.Notifier
+	// PasswordReset - срок действия токенов сброса пароля, адрес страницы сброса и ограничения частоты запросов.
+	PasswordReset handlers.PasswordResetConfig
+	// EmailVerification - срок действия токенов подтверждения адреса, адрес страницы подтверждения
+	// и запрет входа до подтверждения.
+	EmailVerification handlers.EmailVerificationConfig
+	// TOTP - параметры двухфакторной аутентификации. Подключение TOTP доступно, только если задан TOTP.Cipher.
+	TOTP handlers.TOTPConfig
 }
 
 // Run запускает HTTP сервер в отдельной горутине с поддержкой graceful-shutdown.
-func Run(ctx context.Context, db repository.AuthRepository, config ServerConfig) error {
+// Токены выпускаются и проверяются переданным issuer, который должен проверять версии
+// токенов пользователей (auth.Config.TokenVersions, обычно сам db).
+func Run(ctx context.Context, db repository.AuthRepository, issuer *auth.Issuer, config ServerConfig) error {
 	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
 		"func": "Run",
 	})
+	if !issuer.TokenVersionsEnabled() {
+		return ErrNoTokenVersions
+	}
 
 	r := mux.NewRouter()
-
-	r.HandleFunc("/api/user/register", handlers.Register(db)).Methods("POST")
-	r.HandleFunc("/api/user/login", handlers.Login(db)).Methods("POST")
-	r.HandleFunc("/api/user/revoke", handlers.Revoke(db)).Methods("POST")
-	r.HandleFunc("/api/user/validate", handlers.Validate(db)).Methods("POST")
+	dpopPolicy := middleware.DPoPOptional
+	if config.DPoPRequired {
+		dpopPolicy = middleware.DPoPRequired
+	}
+	authenticated := middleware.JWTAuthentication(issuer,
+		middleware.WithBlacklist(db), middleware.WithTokenFamilies(db), middleware.WithDPoP(dpopPolicy, nil),
+		middleware.WithAPIKeys(db))
+
+	login := handlers.LoginConfig{RequireVerifiedEmail: config.EmailVerification.Required, TOTP: config.TOTP}
+	r.HandleFunc("/api/user/register",
+		handlers.Register(db, issuer, config.PasswordPolicy, config.Notifier, config.EmailVerification)).Methods("POST")
+	r.HandleFunc("/api/user/login", handlers.Login(db, issuer, login)).Methods("POST")
+	r.HandleFunc("/api/user/login/mfa", handlers.VerifyMFA(db, issuer, config.TOTP)).Methods("POST")
+	r.HandleFunc("/api/user/refresh", handlers.Refresh(db, issuer)).Methods("POST")
+	r.HandleFunc("/api/user/revoke", handlers.Revoke(db, issuer)).Methods("POST")
+	r.HandleFunc("/api/user/validate", handlers.Validate(db, issuer)).Methods("POST")
+	r.HandleFunc("/.well-known/jwks.json", handlers.JWKS(issuer)).Methods("GET")
+	r.HandleFunc("/oauth/token", handlers.Token(db, issuer)).Methods("POST")
+	r.HandleFunc("/oauth/authorize", handlers.Authorize(db, issuer, login)).Methods("GET", "POST")
+	r.HandleFunc("/oauth/introspect", handlers.Introspect(db, issuer)).Methods("POST")
+	r.HandleFunc("/oauth/revoke", handlers.RevokeToken(db, issuer)).Methods("POST")
+	if issuer.OpenIDEnabled() {
+		r.HandleFunc("/.well-known/openid-configuration", handlers.Discovery(issuer)).Methods("GET")
+		r.Handle("/userinfo", chain(handlers.UserInfo(db), authenticated, middleware.RequireScopes(auth.ScopeOpenID))).
+			Methods("GET", "POST")
+	}
+	r.Handle("/api/user/sessions", chain(handlers.ListSessions(db), authenticated)).Methods("GET")
+	r.Handle("/api/user/sessions", chain(handlers.RevokeOtherSessions(db), authenticated)).Methods("DELETE")
+	r.Handle("/api/user/sessions/{id}", chain(handlers.RevokeSession(db), authenticated)).Methods("DELETE")
+	r.Handle("/api/user/password", chain(handlers.ChangePassword(db, config.PasswordPolicy), authenticated)).Methods("POST")
+	if config.Notifier != nil {
+		r.HandleFunc("/api/user/password/reset", handlers.RequestPasswordReset(db, config.Notifier, config.PasswordReset)).
+			Methods("POST")
+		r.HandleFunc("/api/user/password/reset/confirm", handlers.ConfirmPasswordReset(db, config.PasswordPolicy)).
+			Methods("POST")
+	}
+	r.Handle("/api/user/email", chain(handlers.SetEmail(db, config.Notifier, config.EmailVerification), authenticated)).
+		Methods("POST")
+	r.HandleFunc("/api/user/email/verify", handlers.VerifyEmail(db)).Methods("POST")
+	if config.TOTP.Cipher != nil {
+		r.Handle("/api/user/mfa/totp", chain(handlers.EnrollTOTP(db, config.TOTP), authenticated)).Methods("POST")
+		r.Handle("/api/user/mfa/totp", chain(handlers.DisableTOTP(db, config.TOTP), authenticated)).Methods("DELETE")
+		r.Handle("/api/user/mfa/totp/confirm", chain(handlers.ConfirmTOTP(db, config.TOTP), authenticated)).Methods("POST")
+	}
+	r.Handle("/api/user/logout-all", chain(handlers.RevokeAllTokens(db), authenticated)).Methods("POST")
+	r.Handle("/api/user/api-keys", chain(handlers.CreateAPIKey(db), authenticated)).Methods("POST")
+	r.Handle("/api/user/api-keys", chain(handlers.ListAPIKeys(db), authenticated)).Methods("GET")
+	r.Handle("/api/user/api-keys/{id}", chain(handlers.RevokeAPIKey(db), authenticated)).Methods("DELETE")
 
 	srv := &http.Server{
 		Addr:         config.Addr,
@@ -46,6 +121,9 @@ func Run(ctx context.Context, db repository.AuthRepository, config ServerConfig)
 	}
 
 	startBlacklistCleaner(db)
+	if issuer.KeyRotationEnabled() {
+		startKeyRotation(ctx, issuer, config.KeyRotationCheckInterval)
+	}
 
 	serverErrors := make(chan error, 1)
 	go func() {
@@ -71,6 +149,14 @@ func Run(ctx context.Context, db repository.AuthRepository, config ServerConfig)
 	}
 }
 
+// chain оборачивает handler в middlewares так, что первый из них выполняется первым.
+func chain(handler http.Handler, middlewares ...func(http.Handler) http.Handler) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
 func startBlacklistCleaner(repo repository.AuthRepository) {
 	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
 		"func": "startBlacklistCleaner",
@@ -87,3 +173,27 @@ func startBlacklistCleaner(repo repository.AuthRepository) {
 		}
 	}()
 }
+
+// startKeyRotation периодически перечитывает ключи подписи из хранилища и выполняет плановую ротацию.
+func startKeyRotation(ctx context.Context, issuer *auth.Issuer, interval time.Duration) {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "startKeyRotation",
+	})
+	if interval <= 0 {
+		interval = 1 * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := issuer.RotateKeysIfDue(); err != nil {
+					fncLogger.Errorf("Ошибка ротации ключей подписи: %v", err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
+	log "github.com/SergeyIvanovDevelop/tss-tools/pkg/logger"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// MaxAPIKeyTTL - наибольший срок действия API-ключа, который можно запросить.
+const MaxAPIKeyTTL = 10 * 365 * 24 * time.Hour
+
+// CreateAPIKeyRequest - параметры нового API-ключа. Scopes по умолчанию - разрешения токена запроса,
+// ExpiresIn - срок действия в секундах не больше MaxAPIKeyTTL, 0 - бессрочный ключ.
+type CreateAPIKeyRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn int64    `json:"expires_in"`
+}
+
+// APIKeyResponse - API-ключ в ответах обработчиков. Key заполняется только при создании ключа.
+type APIKeyResponse struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Key       string     `json:"key,omitempty"`
+	Prefix    string     `json:"prefix"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreateAPIKey выпускает API-ключ пользователю, которому выдан access-токен. Ключ не может
+// получить разрешений, которых нет у токена. Сам ключ возвращается только в этом ответе.
+// Обработчики API-ключей должны располагаться после middleware.JWTAuthentication.
+func CreateAPIKey(repo repository.AuthRepository) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "CreateAPIKey",
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		fncLogger.Debug("Start")
+		claims, ok := accountClaims(w, r)
+		if !ok {
+			return
+		}
+
+		var request CreateAPIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			fncLogger.Error("Bad request:", err)
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		if request.ExpiresIn < 0 {
+			http.Error(w, "expires_in must not be negative", http.StatusBadRequest)
+			return
+		}
+		// Большее значение переполнило бы time.Duration и дало ключ с прошедшим сроком действия.
+		if request.ExpiresIn > int64(MaxAPIKeyTTL/time.Second) {
+			http.Error(w, "expires_in is too large", http.StatusBadRequest)
+			return
+		}
+		scopes := request.Scopes
+		if len(scopes) == 0 {
+			scopes = claims.Scopes()
+		}
+		for _, scope := range scopes {
+			if !claims.HasScope(scope) {
+				fncLogger.Errorf("User '%s' requested scope '%s' for API key", claims.Username, scope)
+				http.Error(w, "Scope '"+scope+"' is not granted to the token", http.StatusForbidden)
+				return
+			}
+		}
+
+		key, apiKey, err := auth.GenerateAPIKey(uuid.NewString(), claims.Username)
+		if err != nil {
+			fncLogger.Error("Could not generate API key:", err)
+			http.Error(w, "Could not generate API key", http.StatusInternalServerError)
+			return
+		}
+		apiKey.Name = request.Name
+		apiKey.Scopes = scopes
+		apiKey.TokenVersion = claims.TokenVersion
+		apiKey.CreatedAt = time.Now()
+		if request.ExpiresIn > 0 {
+			apiKey.ExpiresAt = apiKey.CreatedAt.Add(time.Duration(request.ExpiresIn) * time.Second)
+		}
+		if err := repo.CreateAPIKey(*apiKey); err != nil {
+			fncLogger.Error("Could not save API key:", err)
+			http.Error(w, "Could not save API key", http.StatusInternalServerError)
+			return
+		}
+
+		response := apiKeyResponse(apiKey)
+		response.Key = key
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			fncLogger.Error("Error encoding json:", err)
+			return
+		}
+		fncLogger.Debug("Finished")
+	}
+}
+
+// ListAPIKeys возвращает API-ключи пользователя без самих ключей.
+func ListAPIKeys(repo repository.AuthRepository) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "ListAPIKeys",
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		fncLogger.Debug("Start")
+		claims, ok := accountClaims(w, r)
+		if !ok {
+			return
+		}
+
+		keys, err := repo.GetUserAPIKeys(claims.Username)
+		if err != nil {
+			fncLogger.Errorf("Could not load API keys of user '%s': %v", claims.Username, err)
+			http.Error(w, "Could not load API keys", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]APIKeyResponse, 0, len(keys))
+		for i := range keys {
+			response = append(response, apiKeyResponse(&keys[i]))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			fncLogger.Error("Error encoding json:", err)
+			return
+		}
+		fncLogger.Debug("Finished")
+	}
+}
+
+// RevokeAPIKey удаляет API-ключ {id} пользователя. Ключ перестает действовать сразу.
+func RevokeAPIKey(repo repository.AuthRepository) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "RevokeAPIKey",
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		fncLogger.Debug("Start")
+		claims, ok := accountClaims(w, r)
+		if !ok {
+			return
+		}
+
+		keyID := mux.Vars(r)["id"]
+		err := repo.RevokeAPIKey(claims.Username, keyID)
+		if errors.Is(err, auth.ErrAPIKeyNotFound) {
+			fncLogger.Errorf("User '%s' has no API key '%s'", claims.Username, keyID)
+			http.Error(w, "API key not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			fncLogger.Error("Failed to revoke API key:", err)
+			http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		fncLogger.Debug("Finished")
+	}
+}
+
+func apiKeyResponse(key *auth.APIKey) APIKeyResponse {
+	response := APIKeyResponse{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+	}
+	if response.Scopes == nil {
+		response.Scopes = []string{}
+	}
+	if !key.ExpiresAt.IsZero() {
+		expiresAt := key.ExpiresAt
+		response.ExpiresAt = &expiresAt
+	}
+	return response
+}
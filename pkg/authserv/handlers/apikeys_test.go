@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/middleware"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository/mocks"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+)
+
+// serveAPIKeys вызывает handler после middleware.JWTAuthentication с поддержкой API-ключей
+// и заголовком Authorization authorization.
+func serveAPIKeys(issuer *auth.Issuer, repo *mocks.MockAuthRepository, handler http.HandlerFunc,
+	method, pattern, target, authorization, body string) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	router.Handle(pattern, middleware.JWTAuthentication(issuer, middleware.WithAPIKeys(repo))(handler)).Methods(method)
+	request := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+	request.Header.Set("Authorization", authorization)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, request)
+	return rec
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	issuer := newTestIssuer(t)
+	tokens, err := issuer.GenerateToken("alice", auth.WithScopes("orders:read", "orders:write"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bearer := "Bearer " + tokens.AccessToken
+
+	tests := []struct {
+		name          string
+		authorization string
+		body          string
+		setup         func(repo *mocks.MockAuthRepository)
+		wantStatus    int
+		wantScopes    []string
+		wantExpiry    bool
+	}{
+		{
+			name:          "token scopes by default",
+			authorization: bearer,
+			body:          `{"name":"ci"}`,
+			wantStatus:    http.StatusCreated,
+			wantScopes:    []string{"orders:read", "orders:write"},
+		},
+		{
+			name:          "subset of scopes with expiry",
+			authorization: bearer,
+			body:          `{"name":"ci","scopes":["orders:read"],"expires_in":3600}`,
+			wantStatus:    http.StatusCreated,
+			wantScopes:    []string{"orders:read"},
+			wantExpiry:    true,
+		},
+		{
+			name:          "scope not granted to the token",
+			authorization: bearer,
+			body:          `{"name":"ci","scopes":["users:write"]}`,
+			wantStatus:    http.StatusForbidden,
+		},
+		{
+			name:          "negative expires_in",
+			authorization: bearer,
+			body:          `{"name":"ci","expires_in":-1}`,
+			wantStatus:    http.StatusBadRequest,
+		},
+		{
+			// Без ограничения срок переполнил бы time.Duration.
+			name:          "expires_in overflow",
+			authorization: bearer,
+			body:          `{"name":"ci","expires_in":9223372036854775807}`,
+			wantStatus:    http.StatusBadRequest,
+		},
+		{
+			name:          "invalid json",
+			authorization: bearer,
+			body:          `{`,
+			wantStatus:    http.StatusBadRequest,
+		},
+		{
+			name:          "authenticated with api key",
+			authorization: "ApiKey " + auth.APIKeyPrefix + "key",
+			body:          `{"name":"ci"}`,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetAPIKey(auth.HashAPIKey(auth.APIKeyPrefix+"key")).
+					Return(&auth.APIKey{ID: "key-1", Username: "alice", Scopes: []string{"orders:read"}}, nil)
+				repo.EXPECT().GetTokenVersion("alice").Return(int64(0), nil)
+			},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mocks.NewMockAuthRepository(ctrl)
+			if tt.setup != nil {
+				tt.setup(repo)
+			}
+			var saved auth.APIKey
+			if tt.wantStatus == http.StatusCreated {
+				repo.EXPECT().CreateAPIKey(gomock.Any()).DoAndReturn(func(key auth.APIKey) error {
+					saved = key
+					return nil
+				})
+			}
+
+			rec := serveAPIKeys(issuer, repo, CreateAPIKey(repo), http.MethodPost,
+				"/api/user/api-keys", "/api/user/api-keys", tt.authorization, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+
+			var response APIKeyResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Key == "" || auth.HashAPIKey(response.Key) != saved.Hash || saved.Username != "alice" {
+				t.Errorf("response key does not match saved record %+v", saved)
+			}
+			if len(response.Scopes) != len(tt.wantScopes) || len(saved.Scopes) != len(tt.wantScopes) {
+				t.Errorf("scopes = %v, saved %v, want %v", response.Scopes, saved.Scopes, tt.wantScopes)
+			}
+			if tt.wantExpiry != (response.ExpiresAt != nil) {
+				t.Errorf("expires_at = %v, want expiry %v", response.ExpiresAt, tt.wantExpiry)
+			}
+		})
+	}
+}
+
+func TestListAPIKeys(t *testing.T) {
+	issuer := newTestIssuer(t)
+	tokens, err := issuer.GenerateToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	ctrl := gomock.NewController(t)
+	repo := mocks.NewMockAuthRepository(ctrl)
+	repo.EXPECT().GetUserAPIKeys("alice").Return([]auth.APIKey{
+		{ID: "key-1", Username: "alice", Name: "ci", Prefix: "tss_abcdefgh", Hash: "hash", ExpiresAt: expiresAt},
+		{ID: "key-2", Username: "alice", Name: "backup", Prefix: "tss_ijklmnop", Hash: "hash", Scopes: []string{"orders:read"}},
+	}, nil)
+
+	rec := serveAPIKeys(issuer, repo, ListAPIKeys(repo), http.MethodGet,
+		"/api/user/api-keys", "/api/user/api-keys", "Bearer "+tokens.AccessToken, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if bytes.Contains(rec.Body.Bytes(), []byte("hash")) {
+		t.Error("response contains key hashes")
+	}
+	var keys []APIKeyResponse
+	if err := json.NewDecoder(rec.Body).Decode(&keys); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].Key != "" || keys[0].ExpiresAt == nil || !keys[0].ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("keys = %+v", keys)
+	}
+	if keys[0].Scopes == nil || keys[1].ExpiresAt != nil {
+		t.Errorf("keys = %+v, want empty scopes list and no expiry for the second key", keys)
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	issuer := newTestIssuer(t)
+	tokens, err := issuer.GenerateToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"revoked", nil, http.StatusNoContent},
+		{"not found", auth.ErrAPIKeyNotFound, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mocks.NewMockAuthRepository(ctrl)
+			repo.EXPECT().RevokeAPIKey("alice", "key-1").Return(tt.err)
+
+			rec := serveAPIKeys(issuer, repo, RevokeAPIKey(repo), http.MethodDelete,
+				"/api/user/api-keys/{id}", "/api/user/api-keys/key-1", "Bearer "+tokens.AccessToken, "")
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
+	log "github.com/SergeyIvanovDevelop/tss-tools/pkg/logger"
+)
+
+const (
+	authorizationCodeTTL = time.Minute
+	pkceMethodS256       = "S256"
+)
+
+// authorizeRequest - параметры запроса авторизации (RFC 6749, 4.1.1; RFC 7636, 4.3;
+// OpenID Connect Core 1.0, 3.1.2.1).
+type authorizeRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+}
+
+func parseAuthorizeRequest(values url.Values) authorizeRequest {
+	return authorizeRequest{
+		ClientID:            values.Get("client_id"),
+		RedirectURI:         values.Get("redirect_uri"),
+		ResponseType:        values.Get("response_type"),
+		Scope:               values.Get("scope"),
+		State:               values.Get("state"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+		Nonce:               values.Get("nonce"),
+	}
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in</title></head>
+<body>
+<h1>Sign in to {{.Request.ClientID}}</h1>
+{{if .Error}}<p>{{.Error}}</p>{{end}}
+<form method="POST" action="">
+<input type="hidden" name="client_id" value="{{.Request.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+<input type="hidden" name="scope" value="{{.Request.Scope}}">
+<input type="hidden" name="state" value="{{.Request.State}}">
+<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+<input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+<label>Login <input name="login" autocomplete="username" required></label>
+<label>Password <input name="password" type="password" autocomplete="current-password" required></label>
+<label>One-time code, if two-factor authentication is enabled <input name="otp" inputmode="numeric" autocomplete="one-time-code"></label>
+<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`))
+
+// Authorize - OAuth 2.0 authorization endpoint для authorization code flow с обязательным PKCE (S256).
+// GET показывает форму входа, POST проверяет логин и пароль и перенаправляет на redirect_uri с кодом.
+// Если у пользователя включен TOTP, форма должна содержать и код из приложения.
+// Разрешение openid выдается, только если issuer выпускает ID Token.
+func Authorize(repo repository.AuthRepository, issuer *auth.Issuer, config LoginConfig) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "Authorize",
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		fncLogger.Debug("Start")
+		if err := r.ParseForm(); err != nil {
+			fncLogger.Error("Bad request:", err)
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		req := parseAuthorizeRequest(r.Form)
+
+		// Пока redirect_uri не проверен, ошибки возвращаются пользователю, а не клиенту (RFC 6749, 4.1.2.1).
+		client, err := repo.GetClient(req.ClientID)
+		if err != nil {
+			fncLogger.Errorf("Unknown client '%s': %v", req.ClientID, err)
+			http.Error(w, "Unknown client", http.StatusBadRequest)
+			return
+		}
+		if !slices.Contains(client.RedirectURIs, req.RedirectURI) {
+			fncLogger.Errorf("Redirect URI '%s' is not registered for client '%s'", req.RedirectURI, client.ID)
+			http.Error(w, "Invalid redirect_uri", http.StatusBadRequest)
+			return
+		}
+
+		if req.ResponseType != "code" {
+			redirectWithError(w, r, req, "unsupported_response_type", "")
+			return
+		}
+		if req.CodeChallengeMethod != pkceMethodS256 || !validPKCEValue(req.CodeChallenge) {
+			redirectWithError(w, r, req, oauthInvalidRequest, "PKCE with code_challenge_method=S256 is required")
+			return
+		}
+		scopes, ok := grantScopes(req.Scope, client.Scopes)
+		if !ok || slices.Contains(scopes, auth.ScopeOpenID) && !issuer.OpenIDEnabled() {
+			redirectWithError(w, r, req, oauthInvalidScope, "")
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			renderLoginPage(w, http.StatusOK, req, "")
+			return
+		}
+
+		username := r.PostForm.Get("login")
+		err = checkCredentials(repo, username, r.PostForm.Get("password"))
+		if err != nil {
+			fncLogger.Error("Unauthorized:", err)
+			renderLoginPage(w, http.StatusUnauthorized, req, "Invalid login or password")
+			return
+		}
+		if config.RequireVerifiedEmail {
+			if err := checkEmailVerified(repo, username); err != nil {
+				fncLogger.Error("Forbidden:", err)
+				renderLoginPage(w, http.StatusForbidden, req, "Email address is not verified")
+				return
+			}
+		}
+		mfaRequired, err := totpEnabled(repo, username)
+		if err == nil && mfaRequired {
+			err = checkTOTPCode(repo, config.TOTP.Cipher, username, r.PostForm.Get("otp"))
+		}
+		if errors.Is(err, repository.ErrTOTPLocked) {
+			fncLogger.Errorf("TOTP of user '%s' is locked: %v", username, err)
+			renderLoginPage(w, http.StatusTooManyRequests, req, "Too many attempts, try again later")
+			return
+		}
+		if errors.Is(err, errInvalidTOTPCode) || errors.Is(err, repository.ErrTOTPCodeUsed) {
+			fncLogger.Errorf("Wrong TOTP code of user '%s': %v", username, err)
+			renderLoginPage(w, http.StatusUnauthorized, req, "Invalid one-time code")
+			return
+		}
+		if err != nil {
+			fncLogger.Error("Could not check TOTP:", err)
+			redirectWithError(w, r, req, oauthServerError, "")
+			return
+		}
+
+		code, err := generateRandomToken()
+		if err != nil {
+			fncLogger.Error("Could not generate authorization code:", err)
+			redirectWithError(w, r, req, oauthServerError, "")
+			return
+		}
+		err = repo.SaveAuthorizationCode(repository.AuthorizationCode{
+			CodeHash:      hashToken(code),
+			ClientID:      client.ID,
+			Username:      username,
+			RedirectURI:   req.RedirectURI,
+			Scopes:        scopes,
+			CodeChallenge: req.CodeChallenge,
+			Nonce:         req.Nonce,
+			AuthTime:      time.Now(),
+			ExpiresAt:     time.Now().Add(authorizationCodeTTL),
+		})
+		if err != nil {
+			fncLogger.Error("Could not save authorization code:", err)
+			redirectWithError(w, r, req, oauthServerError, "")
+			return
+		}
+
+		redirectWithParams(w, r, req.RedirectURI, url.Values{"code": {code}, "state": {req.State}})
+		fncLogger.Debug("Finished")
+	}
+}
+
+func renderLoginPage(w http.ResponseWriter, status int, req authorizeRequest, message string) {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "renderLoginPage",
+	})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(status)
+	err := loginPage.Execute(w, struct {
+		Request authorizeRequest
+		Error   string
+	}{req, message})
+	if err != nil {
+		fncLogger.Error("Error rendering login page:", err)
+	}
+}
+
+func redirectWithError(w http.ResponseWriter, r *http.Request, req authorizeRequest, code, description string) {
+	params := url.Values{"error": {code}, "state": {req.State}}
+	if description != "" {
+		params.Set("error_description", description)
+	}
+	redirectWithParams(w, r, req.RedirectURI, params)
+}
+
+// redirectWithParams добавляет params к query-строке redirectURI и перенаправляет на него.
+func redirectWithParams(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "Invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	query := target.Query()
+	for key, values := range params {
+		if len(values) == 0 || values[0] == "" {
+			continue
+		}
+		query.Set(key, values[0])
+	}
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// verifyPKCE проверяет code_verifier по сохраненному code_challenge методом S256 (RFC 7636, 4.6).
+func verifyPKCE(verifier, challenge string) bool {
+	if !validPKCEValue(verifier) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// validPKCEValue проверяет длину и алфавит code_verifier/code_challenge (RFC 7636, 4.1).
+func validPKCEValue(value string) bool {
+	if len(value) < 43 || len(value) > 128 {
+		return false
+	}
+	return strings.Trim(value, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-._~") == ""
+}
+
+// generateRandomToken возвращает случайную строку из 256 бит энтропии.
+func generateRandomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken возвращает SHA-256 хеш секрета для хранения в репозитории.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
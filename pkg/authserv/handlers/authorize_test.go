@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository/mocks"
+
+	"github.com/golang/mock/gomock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Пример из RFC 7636, приложение B.
+const (
+	testVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	const (
+		verifier  = testVerifier
+		challenge = testChallenge
+	)
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{"rfc 7636 example", verifier, challenge, true},
+		{"other verifier", strings.Replace(verifier, "d", "e", 1), challenge, false},
+		{"plain method", verifier, verifier, false},
+		{"padded challenge", verifier, challenge + "=", false},
+		{"empty challenge", verifier, "", false},
+		{"empty verifier", "", challenge, false},
+		{"short verifier", strings.Repeat("a", 42), challenge, false},
+		{"long verifier", strings.Repeat("a", 129), challenge, false},
+		{"invalid character", verifier[:42] + "+", challenge, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyPKCE(tt.verifier, tt.challenge); got != tt.want {
+				t.Errorf("verifyPKCE = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidPKCEValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{strings.Repeat("a", 43), true},
+		{strings.Repeat("Z", 128), true},
+		{"AZaz09-._~" + strings.Repeat("x", 33), true},
+		{strings.Repeat("a", 42), false},
+		{strings.Repeat("a", 129), false},
+		{strings.Repeat("a", 42) + "/", false},
+		{strings.Repeat("a", 42) + " ", false},
+		{strings.Repeat("а", 43), false},
+	}
+	for _, tt := range tests {
+		if got := validPKCEValue(tt.value); got != tt.want {
+			t.Errorf("validPKCEValue(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+// publicClient - публичный клиент SPA с одним адресом возврата.
+var publicClient = &repository.OAuthClient{
+	ID:           "spa",
+	Scopes:       []string{auth.ScopeOpenID, "profile", "orders:read"},
+	RedirectURIs: []string{"https://spa.example.com/callback"},
+}
+
+func authorizeForm(overrides url.Values) url.Values {
+	form := url.Values{
+		"client_id":             {"spa"},
+		"redirect_uri":          {"https://spa.example.com/callback"},
+		"response_type":         {"code"},
+		"scope":                 {"profile"},
+		"state":                 {"xyz"},
+		"code_challenge":        {testChallenge},
+		"code_challenge_method": {"S256"},
+		"login":                 {"alice"},
+		"password":              {"secret password"},
+	}
+	for key, values := range overrides {
+		form[key] = values
+	}
+	return form
+}
+
+func TestAuthorize(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// codeIssued ожидает вход alice и сохранение кода с разрешениями scopes.
+	codeIssued := func(scopes ...string) func(repo *mocks.MockAuthRepository) {
+		return func(repo *mocks.MockAuthRepository) {
+			repo.EXPECT().GetUser("alice").Return(string(hash), nil)
+			repo.EXPECT().GetTOTPSecret("alice").Return(nil, repository.ErrTOTPNotFound)
+			repo.EXPECT().SaveAuthorizationCode(gomock.Any()).DoAndReturn(func(code repository.AuthorizationCode) error {
+				if code.ClientID != "spa" || code.Username != "alice" || code.CodeChallenge != testChallenge ||
+					strings.Join(code.Scopes, " ") != strings.Join(scopes, " ") {
+					t.Errorf("saved code = %+v", code)
+				}
+				return nil
+			})
+		}
+	}
+
+	tests := []struct {
+		name         string
+		issuer       *auth.Issuer
+		form         url.Values
+		setup        func(repo *mocks.MockAuthRepository)
+		wantStatus   int
+		wantRedirect url.Values
+	}{
+		{
+			name:         "code issued",
+			form:         authorizeForm(nil),
+			setup:        codeIssued("profile"),
+			wantStatus:   http.StatusFound,
+			wantRedirect: url.Values{"state": {"xyz"}},
+		},
+		{
+			name:         "openid code issued",
+			issuer:       newOIDCIssuer(t),
+			form:         authorizeForm(url.Values{"scope": {"openid profile"}}),
+			setup:        codeIssued(auth.ScopeOpenID, "profile"),
+			wantStatus:   http.StatusFound,
+			wantRedirect: url.Values{"state": {"xyz"}},
+		},
+		{
+			// ID Token, подписанный HMAC-ключом, клиент не проверит по JWKS.
+			name:         "openid without OpenID Connect",
+			form:         authorizeForm(url.Values{"scope": {"openid profile"}}),
+			wantStatus:   http.StatusFound,
+			wantRedirect: url.Values{"error": {oauthInvalidScope}, "state": {"xyz"}},
+		},
+		{
+			name: "wrong password",
+			form: authorizeForm(url.Values{"password": {"guess"}}),
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetUser("alice").Return(string(hash), nil)
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "unregistered redirect uri",
+			form:       authorizeForm(url.Values{"redirect_uri": {"https://evil.example.com/"}}),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "pkce required",
+			form:         authorizeForm(url.Values{"code_challenge_method": {"plain"}}),
+			wantStatus:   http.StatusFound,
+			wantRedirect: url.Values{"error": {oauthInvalidRequest}, "state": {"xyz"}},
+		},
+		{
+			name:         "scope not allowed",
+			form:         authorizeForm(url.Values{"scope": {"admin"}}),
+			wantStatus:   http.StatusFound,
+			wantRedirect: url.Values{"error": {oauthInvalidScope}, "state": {"xyz"}},
+		},
+		{
+			name:         "unsupported response type",
+			form:         authorizeForm(url.Values{"response_type": {"token"}}),
+			wantStatus:   http.StatusFound,
+			wantRedirect: url.Values{"error": {"unsupported_response_type"}, "state": {"xyz"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mocks.NewMockAuthRepository(ctrl)
+			repo.EXPECT().GetClient("spa").Return(publicClient, nil)
+			if tt.setup != nil {
+				tt.setup(repo)
+			}
+
+			issuer := tt.issuer
+			if issuer == nil {
+				issuer = newTestIssuer(t)
+			}
+
+			rec := serveForm(Authorize(repo, issuer, LoginConfig{}), "/oauth/authorize", tt.form, "", "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantRedirect == nil {
+				return
+			}
+			location, err := url.Parse(rec.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(location.String(), "https://spa.example.com/callback?") {
+				t.Errorf("redirected to %s", location)
+			}
+			query := location.Query()
+			for key := range tt.wantRedirect {
+				if query.Get(key) != tt.wantRedirect.Get(key) {
+					t.Errorf("redirect %s = %q, want %q", key, query.Get(key), tt.wantRedirect.Get(key))
+				}
+			}
+			if _, ok := tt.wantRedirect["error"]; !ok && query.Get("code") == "" {
+				t.Error("redirect has no code")
+			}
+		})
+	}
+}
+
+func TestAuthorizationCodeGrant(t *testing.T) {
+	issuer := newTestIssuer(t)
+	const code = "authorization-code"
+	stored := func(overrides func(code *repository.AuthorizationCode)) *repository.AuthorizationCode {
+		authorizationCode := &repository.AuthorizationCode{
+			CodeHash:      hashToken(code),
+			ClientID:      "spa",
+			Username:      "alice",
+			RedirectURI:   "https://spa.example.com/callback",
+			Scopes:        []string{"profile"},
+			CodeChallenge: testChallenge,
+			ExpiresAt:     time.Now().Add(time.Minute),
+		}
+		if overrides != nil {
+			overrides(authorizationCode)
+		}
+		return authorizationCode
+	}
+	form := func(overrides url.Values) url.Values {
+		values := url.Values{
+			"grant_type":    {"authorization_code"},
+			"client_id":     {"spa"},
+			"code":          {code},
+			"redirect_uri":  {"https://spa.example.com/callback"},
+			"code_verifier": {testVerifier},
+		}
+		for key, value := range overrides {
+			values[key] = value
+		}
+		return values
+	}
+
+	tests := []struct {
+		name       string
+		form       url.Values
+		stored     *repository.AuthorizationCode
+		storedErr  error
+		wantStatus int
+		wantError  string
+	}{
+		{name: "exchange", form: form(nil), stored: stored(nil), wantStatus: http.StatusOK},
+		{
+			name:       "wrong verifier",
+			form:       form(url.Values{"code_verifier": {strings.Repeat("a", 43)}}),
+			stored:     stored(nil),
+			wantStatus: http.StatusBadRequest,
+			wantError:  oauthInvalidGrant,
+		},
+		{
+			name:       "redirect uri mismatch",
+			form:       form(url.Values{"redirect_uri": {"https://spa.example.com/other"}}),
+			stored:     stored(nil),
+			wantStatus: http.StatusBadRequest,
+			wantError:  oauthInvalidGrant,
+		},
+		{
+			name:       "issued to other client",
+			form:       form(nil),
+			stored:     stored(func(code *repository.AuthorizationCode) { code.ClientID = "billing" }),
+			wantStatus: http.StatusBadRequest,
+			wantError:  oauthInvalidGrant,
+		},
+		{
+			name:       "expired code",
+			form:       form(nil),
+			stored:     stored(func(code *repository.AuthorizationCode) { code.ExpiresAt = time.Now().Add(-time.Second) }),
+			wantStatus: http.StatusBadRequest,
+			wantError:  oauthInvalidGrant,
+		},
+		{
+			name:       "used code",
+			form:       form(nil),
+			storedErr:  errors.New("no rows"),
+			wantStatus: http.StatusBadRequest,
+			wantError:  oauthInvalidGrant,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mocks.NewMockAuthRepository(ctrl)
+			repo.EXPECT().GetClient("spa").Return(publicClient, nil)
+			repo.EXPECT().ConsumeAuthorizationCode(hashToken(code)).Return(tt.stored, tt.storedErr)
+			if tt.wantStatus == http.StatusOK {
+				repo.EXPECT().GetUserRoles("alice").Return(nil, nil)
+				repo.EXPECT().GetUserProfile("alice").Return(&repository.UserProfile{Username: "alice"}, nil)
+				repo.EXPECT().CreateTokenFamily(gomock.Any(), "alice", gomock.Any(), gomock.Any()).Return(nil)
+				repo.EXPECT().CreateSession(gomock.Any()).Return(nil)
+			}
+
+			rec := serveForm(Token(repo, issuer), "/oauth/token", tt.form, "", "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantError != "" {
+				var response oauthError
+				if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+					t.Fatal(err)
+				}
+				if response.Error != tt.wantError {
+					t.Errorf("error = %q, want %q", response.Error, tt.wantError)
+				}
+				return
+			}
+
+			var response TokenResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			claims, err := issuer.ValidateToken(response.RefreshToken, auth.WithTokenType(auth.TokenTypeRefresh))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Subject != "alice" || claims.ClientID != "spa" || claims.Scope != "profile" {
+				t.Errorf("sub = %q, client_id = %q, scope = %q", claims.Subject, claims.ClientID, claims.Scope)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenGrantClient(t *testing.T) {
+	issuer := newTestIssuer(t)
+	tokens, err := issuer.GenerateToken("alice", auth.WithClientID("billing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Refresh-токен другого клиента отклоняется до ротации семейства.
+	ctrl := gomock.NewController(t)
+	repo := mocks.NewMockAuthRepository(ctrl)
+	repo.EXPECT().GetClient("spa").Return(publicClient, nil)
+	repo.EXPECT().IsInBlacklist(tokens.RefreshToken).Return(false)
+	form := url.Values{"grant_type": {"refresh_token"}, "client_id": {"spa"}, "refresh_token": {tokens.RefreshToken}}
+	rec := serveForm(Token(repo, issuer), "/oauth/token", form, "", "")
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), oauthInvalidGrant) {
+		t.Errorf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+}
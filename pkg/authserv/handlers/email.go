@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"time"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/notify"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
+	log "github.com/SergeyIvanovDevelop/tss-tools/pkg/logger"
+)
+
+// DefaultEmailVerificationTTL - время жизни токена подтверждения адреса по умолчанию.
+const DefaultEmailVerificationTTL = 24 * time.Hour
+
+var errEmailNotVerified = errors.New("email is not verified")
+
+// EmailVerificationConfig - параметры подтверждения адреса. Если задан URL, письмо содержит ссылку
+// с токеном в параметре token, иначе сам токен. Required запрещает вход, пока адрес не подтвержден.
+type EmailVerificationConfig struct {
+	TTL      time.Duration
+	URL      string
+	Required bool
+}
+
+type SetEmailRequest struct {
+	Email           string `json:"email"`
+	CurrentPassword string `json:"current_password"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// SetEmail задает адрес пользователя, которому выдан access-токен, после проверки текущего
+// пароля и отправляет на адрес токен подтверждения через notifier. До подтверждения адрес
+// считается неподтвержденным. Пароль требуется, потому что на подтвержденный адрес приходят
+// токены сброса пароля: иначе украденный access-токен позволял бы захватить учетную запись.
+// Обработчик должен располагаться после middleware.JWTAuthentication.
+func SetEmail(repo repository.AuthRepository, notifier notify.Notifier, config EmailVerificationConfig) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "SetEmail",
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		fncLogger.Debug("Start")
+		claims, ok := accountClaims(w, r)
+		if !ok {
+			return
+		}
+
+		var request SetEmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			fncLogger.Error("Bad request:", err)
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		if !validEmail(request.Email) {
+			http.Error(w, "Invalid email", http.StatusBadRequest)
+			return
+		}
+		if request.CurrentPassword == "" {
+			http.Error(w, "Empty current password", http.StatusBadRequest)
+			return
+		}
+		if err := checkCredentials(repo, claims.Username, request.CurrentPassword); err != nil {
+			fncLogger.Errorf("Wrong current password of user '%s': %v", claims.Username, err)
+			http.Error(w, "Wrong current password", http.StatusForbidden)
+			return
+		}
+
+		err := repo.SetUserEmail(claims.Username, request.Email)
+		if err != nil {
+			fncLogger.Errorf("Could not set email of user '%s': %v", claims.Username, err)
+			http.Error(w, "Could not set email", http.StatusInternalServerError)
+			return
+		}
+
+		if notifier != nil {
+			if err := sendEmailVerification(repo, notifier, config, claims.Username, request.Email); err != nil {
+				fncLogger.Errorf("Could not send verification to user '%s': %v", claims.Username, err)
+				http.Error(w, "Could not send verification email", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		fncLogger.Debug("Finished")
+	}
+}
+
+// VerifyEmail подтверждает адрес пользователя по одноразовому токену из письма.
+// Токен, выпущенный для прежнего адреса, новый адрес не подтверждает. Адрес, уже подтвержденный
+// другим пользователем, не подтверждается.
+func VerifyEmail(repo repository.AuthRepository) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "VerifyEmail",
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		fncLogger.Debug("Start")
+		var request VerifyEmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			fncLogger.Error("Bad request:", err)
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		if request.Token == "" {
+			http.Error(w, "Empty token", http.StatusBadRequest)
+			return
+		}
+
+		verification, err := repo.ConsumeEmailVerification(hashToken(request.Token))
+		if err == nil && !time.Now().Before(verification.ExpiresAt) {
+			err = repository.ErrVerificationNotFound
+		}
+		if err == nil {
+			err = repo.MarkEmailVerified(verification.Username, verification.Email)
+		}
+		if errors.Is(err, repository.ErrVerificationNotFound) {
+			fncLogger.Error("Invalid verification token:", err)
+			http.Error(w, "Invalid or expired verification token", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, repository.ErrEmailTaken) {
+			// Ответ получает только владелец адреса, предъявивший токен из письма.
+			fncLogger.Errorf("Email of user '%s' is already verified by another user", verification.Username)
+			http.Error(w, "Email is already taken", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			fncLogger.Error("Could not verify email:", err)
+			http.Error(w, "Could not verify email", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		fncLogger.Debug("Finished")
+	}
+}
+
+// sendEmailVerification сохраняет новый токен подтверждения адреса email пользователя username,
+// заменяя предыдущий, и отправляет его на этот адрес.
+func sendEmailVerification(repo repository.AuthRepository, notifier notify.Notifier, config EmailVerificationConfig, username, email string) error {
+	ttl := config.TTL
+	if ttl <= 0 {
+		ttl = DefaultEmailVerificationTTL
+	}
+	token, err := generateRandomToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	verification := repository.EmailVerification{
+		TokenHash: hashToken(token),
+		Username:  username,
+		Email:     email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := repo.SaveEmailVerification(verification); err != nil {
+		return fmt.Errorf("save verification token: %w", err)
+	}
+
+	return notifier.Notify(notify.Message{
+		To:      email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Confirm this address for account '%s'.\n\n%s\n\nIt expires at %s.",
+			username, tokenLink(config.URL, token, "Verification"), verification.ExpiresAt.UTC().Format(time.RFC1123)),
+	})
+}
+
+// checkEmailVerified возвращает errEmailNotVerified, если адрес пользователя не подтвержден.
+func checkEmailVerified(repo repository.AuthRepository, username string) error {
+	profile, err := repo.GetUserProfile(username)
+	if err != nil {
+		return err
+	}
+	if !profile.EmailVerified {
+		return errEmailNotVerified
+	}
+	return nil
+}
+
+// userTokenOptions возвращает параметры токенов пользователя из репозитория: роли и адрес.
+func userTokenOptions(repo repository.AuthRepository, username string) ([]auth.TokenOption, error) {
+	roles, err := repo.GetUserRoles(username)
+	if err != nil {
+		return nil, fmt.Errorf("load user roles: %w", err)
+	}
+	profile, err := repo.GetUserProfile(username)
+	if err != nil {
+		return nil, fmt.Errorf("load user profile: %w", err)
+	}
+	return []auth.TokenOption{auth.WithRoles(roles...), auth.WithEmail(profile.Email, profile.EmailVerified)}, nil
+}
+
+// tokenLink возвращает строку уведомления с токеном: ссылку baseURL с параметром token
+// или, если baseURL не задан, сам токен.
+func tokenLink(baseURL, token, kind string) string {
+	link, err := url.Parse(baseURL)
+	if err != nil || baseURL == "" {
+		return kind + " token: " + token
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return kind + " link: " + link.String()
+}
+
+// validEmail принимает только голый адрес вида user@example.com, без имени и угловых скобок.
+func validEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email && len(email) <= 254
+}
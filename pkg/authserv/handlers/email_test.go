@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/notify"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository/mocks"
+
+	"github.com/golang/mock/gomock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// sentToken возвращает токен из уведомления message, отправленного с tokenLink без URL.
+func sentToken(t *testing.T, message notify.Message, kind string) string {
+	t.Helper()
+	_, token, ok := strings.Cut(message.Body, kind+" token: ")
+	if !ok {
+		t.Fatalf("message %q has no %s token", message.Body, kind)
+	}
+	token, _, _ = strings.Cut(token, "\n")
+	return token
+}
+
+func TestSetEmail(t *testing.T) {
+	issuer := newTestIssuer(t)
+	tokens, err := issuer.GenerateToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		setup      func(repo *mocks.MockAuthRepository)
+		wantStatus int
+		wantSent   bool
+	}{
+		{
+			name: "verification sent",
+			body: `{"email":"alice@example.com","current_password":"secret password"}`,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetUser("alice").Return(string(hash), nil)
+				repo.EXPECT().SetUserEmail("alice", "alice@example.com").Return(nil)
+				repo.EXPECT().SaveEmailVerification(gomock.Any()).Return(nil)
+			},
+			wantStatus: http.StatusAccepted,
+			wantSent:   true,
+		},
+		{
+			name: "wrong current password",
+			body: `{"email":"alice@example.com","current_password":"guess"}`,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetUser("alice").Return(string(hash), nil)
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "empty current password",
+			body:       `{"email":"alice@example.com"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "display name is not accepted",
+			body:       `{"email":"Alice <alice@example.com>"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "verification not saved",
+			body: `{"email":"alice@example.com","current_password":"secret password"}`,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetUser("alice").Return(string(hash), nil)
+				repo.EXPECT().SetUserEmail("alice", "alice@example.com").Return(nil)
+				repo.EXPECT().SaveEmailVerification(gomock.Any()).Return(errors.New("db is down"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mocks.NewMockAuthRepository(ctrl)
+			if tt.setup != nil {
+				tt.setup(repo)
+			}
+			notifier := make(channelNotifier, 1)
+
+			rec := serveAuthenticatedJSON(issuer, SetEmail(repo, notifier, EmailVerificationConfig{}), "/api/user/email", tokens.AccessToken, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if sent := len(notifier) == 1; sent != tt.wantSent {
+				t.Fatalf("verification sent = %v, want %v", sent, tt.wantSent)
+			}
+			if tt.wantSent {
+				if message := <-notifier; message.To != "alice@example.com" {
+					t.Errorf("verification sent to %q", message.To)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	tokenHash := hashToken("verification-token")
+	valid := &repository.EmailVerification{TokenHash: tokenHash, Username: "alice", Email: "alice@example.com", ExpiresAt: time.Now().Add(time.Hour)}
+	expired := &repository.EmailVerification{TokenHash: tokenHash, Username: "alice", Email: "alice@example.com", ExpiresAt: time.Now().Add(-time.Minute)}
+
+	tests := []struct {
+		name       string
+		body       string
+		setup      func(repo *mocks.MockAuthRepository)
+		wantStatus int
+	}{
+		{
+			name: "verified",
+			body: `{"token":"verification-token"}`,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().ConsumeEmailVerification(tokenHash).Return(valid, nil)
+				repo.EXPECT().MarkEmailVerified("alice", "alice@example.com").Return(nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name: "unknown token",
+			body: `{"token":"verification-token"}`,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().ConsumeEmailVerification(tokenHash).Return(nil, repository.ErrVerificationNotFound)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "expired token",
+			body: `{"token":"verification-token"}`,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().ConsumeEmailVerification(tokenHash).Return(expired, nil)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			// Адрес пользователя изменился после выпуска токена.
+			name: "token for previous address",
+			body: `{"token":"verification-token"}`,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().ConsumeEmailVerification(tokenHash).Return(valid, nil)
+				repo.EXPECT().MarkEmailVerified("alice", "alice@example.com").Return(repository.ErrVerificationNotFound)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			// Адрес уже подтвердил другой пользователь.
+			name: "email taken",
+			body: `{"token":"verification-token"}`,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().ConsumeEmailVerification(tokenHash).Return(valid, nil)
+				repo.EXPECT().MarkEmailVerified("alice", "alice@example.com").Return(repository.ErrEmailTaken)
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "empty token",
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mocks.NewMockAuthRepository(ctrl)
+			if tt.setup != nil {
+				tt.setup(repo)
+			}
+
+			rec := serveJSON(VerifyEmail(repo), "/api/user/email/verify", tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRegisterRequiresVerifiedEmail(t *testing.T) {
+	issuer := newTestIssuer(t)
+	config := EmailVerificationConfig{Required: true}
+
+	ctrl := gomock.NewController(t)
+	repo := mocks.NewMockAuthRepository(ctrl)
+	notifier := make(channelNotifier, 1)
+	repo.EXPECT().CreateUser("alice", gomock.Any(), "alice@example.com").Return(nil)
+	var saved repository.EmailVerification
+	repo.EXPECT().SaveEmailVerification(gomock.Any()).DoAndReturn(func(verification repository.EmailVerification) error {
+		saved = verification
+		return nil
+	})
+
+	// Токены не выдаются до подтверждения адреса.
+	rec := serveJSON(Register(repo, issuer, nil, notifier, config), "/api/user/register",
+		`{"login":"alice","password":"Correct-Horse-42","email":"alice@example.com"}`)
+	if rec.Code != http.StatusCreated || strings.Contains(rec.Body.String(), "access_token") ||
+		!strings.Contains(rec.Body.String(), `"email_verification_required":true`) {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if token := sentToken(t, <-notifier, "Verification"); hashToken(token) != saved.TokenHash || saved.Email != "alice@example.com" {
+		t.Errorf("sent token does not match saved verification %+v", saved)
+	}
+
+	rec = serveJSON(Register(repo, issuer, nil, notifier, config), "/api/user/register",
+		`{"login":"bob","password":"Correct-Horse-42"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status without email = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestLoginRequiresVerifiedEmail(t *testing.T) {
+	issuer := newTestIssuer(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctrl := gomock.NewController(t)
+	repo := mocks.NewMockAuthRepository(ctrl)
+	repo.EXPECT().GetUser("alice").Return(string(hash), nil)
+	repo.EXPECT().GetUserProfile("alice").Return(&repository.UserProfile{Username: "alice", Email: "alice@example.com"}, nil)
+
+	rec := serveJSON(Login(repo, issuer, LoginConfig{RequireVerifiedEmail: true}), "/api/user/login", `{"login":"alice","password":"secret password"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusForbidden, rec.Body.String())
+	}
+}
+
+func TestValidEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		want  bool
+	}{
+		{"alice@example.com", true},
+		{"Alice <alice@example.com>", false},
+		{"alice", false},
+		{"alice@example.com\r\nBcc: mallory@example.com", false},
+		{strings.Repeat("a", 250) + "@example.com", false},
+	}
+	for _, tt := range tests {
+		if got := validEmail(tt.email); got != tt.want {
+			t.Errorf("validEmail(%q) = %v, want %v", tt.email, got, tt.want)
+		}
+	}
+}
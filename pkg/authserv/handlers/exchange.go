@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
+	log "github.com/SergeyIvanovDevelop/tss-tools/pkg/logger"
+)
+
+// tokenExchangeGrant выпускает access-токен субъекта subject_token для клиента, действующего
+// от его имени (RFC 8693, 2.1). Обмен доступен только конфиденциальным клиентам и только для
+// токенов из OAuthClient.ExchangeSubjects. Новый токен содержит act с клиентом или субъектом
+// actor_token, выданного этому же клиенту, и не больше разрешений, чем есть одновременно
+// у subject_token и у клиента. audience ограничены OAuthClient.ExchangeAudiences, а токены,
+// привязанные к ключу DPoP, обмениваются только с DPoP proof этого ключа.
+// Каждый обмен записывается в журнал, и без записи токен не выдается.
+func tokenExchangeGrant(w http.ResponseWriter, r *http.Request, repo repository.AuthRepository, issuer *auth.Issuer, jkt string) {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "tokenExchangeGrant",
+	})
+
+	client, err := authenticateClient(r, repo)
+	if err != nil {
+		fncLogger.Error("Client authentication failed:", err)
+		writeInvalidClient(w, r)
+		return
+	}
+	if client.SecretHash == "" || len(client.ExchangeSubjects) == 0 {
+		fncLogger.Errorf("Client '%s' is not allowed to exchange tokens", client.ID)
+		writeOAuthError(w, http.StatusBadRequest, oauthUnauthorizedClient, "Client is not allowed to exchange tokens")
+		return
+	}
+
+	if requested := r.PostForm.Get("requested_token_type"); requested != "" && requested != auth.TokenTypeURIAccessToken {
+		writeOAuthError(w, http.StatusBadRequest, oauthInvalidRequest, "Unsupported requested_token_type")
+		return
+	}
+	subject, ok := exchangedTokenClaims(w, r, repo, issuer, "subject_token", jkt)
+	if !ok {
+		return
+	}
+	if !client.MayExchange(subject) {
+		fncLogger.Errorf("Client '%s' may not exchange tokens of '%s'", client.ID, subject.Subject)
+		writeOAuthError(w, http.StatusBadRequest, oauthUnauthorizedClient, "Client may not exchange this subject_token")
+		return
+	}
+
+	actor := auth.Actor{Subject: auth.ClientSubject(client.ID), ClientID: client.ID}
+	if r.PostForm.Get("actor_token") != "" || r.PostForm.Get("actor_token_type") != "" {
+		actorClaims, ok := exchangedTokenClaims(w, r, repo, issuer, "actor_token", jkt)
+		if !ok {
+			return
+		}
+		if actorClaims.ClientID != client.ID {
+			// Иначе клиент мог бы выдать себя за любого, чей токен у него оказался.
+			fncLogger.Errorf("Client '%s' presented actor_token of client '%s'", client.ID, actorClaims.ClientID)
+			writeOAuthError(w, http.StatusBadRequest, oauthInvalidGrant, "actor_token was not issued to the client")
+			return
+		}
+		actor = auth.Actor{Subject: actorClaims.Subject, ClientID: client.ID}
+	}
+
+	allowed := make([]string, 0, len(client.Scopes))
+	for _, scope := range subject.Scopes() {
+		if slices.Contains(client.Scopes, scope) {
+			allowed = append(allowed, scope)
+		}
+	}
+	scopes, ok := grantScopes(r.PostForm.Get("scope"), allowed)
+	if !ok {
+		fncLogger.Errorf("Client '%s' requested not allowed scope '%s'", client.ID, r.PostForm.Get("scope"))
+		writeOAuthError(w, http.StatusBadRequest, oauthInvalidScope, "")
+		return
+	}
+	audience := r.PostForm["audience"]
+	if !client.MayRequestAudience(audience) {
+		fncLogger.Errorf("Client '%s' requested not allowed audience %v", client.ID, audience)
+		writeOAuthError(w, http.StatusBadRequest, oauthInvalidTarget, "")
+		return
+	}
+
+	accessToken, claims, err := issuer.ExchangeToken(subject, actor,
+		auth.WithClientID(client.ID), auth.WithScopes(scopes...), auth.WithTokenAudience(audience...), auth.WithDPoPKey(jkt))
+	if err != nil {
+		fncLogger.Error("Could not generate token:", err)
+		writeOAuthError(w, http.StatusInternalServerError, oauthServerError, "")
+		return
+	}
+
+	err = repo.AuditTokenExchange(repository.TokenExchange{
+		ClientID:  client.ID,
+		Subject:   subject.Subject,
+		Actor:     actor.Subject,
+		Scopes:    scopes,
+		Audience:  append([]string{}, audience...),
+		TokenID:   claims.ID,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		fncLogger.Error("Could not audit token exchange:", err)
+		writeOAuthError(w, http.StatusInternalServerError, oauthServerError, "")
+		return
+	}
+	fncLogger.Infof("Client '%s' received token '%s' of '%s' acting as '%s'", client.ID, claims.ID, subject.Subject, actor.Subject)
+
+	writeTokenResponse(w, TokenResponse{
+		AccessToken:     accessToken,
+		TokenType:       tokenType(claims),
+		ExpiresIn:       expiresIn(claims),
+		Scope:           claims.Scope,
+		IssuedTokenType: auth.TokenTypeURIAccessToken,
+	})
+}
+
+// exchangedTokenClaims проверяет subject_token или actor_token запроса обмена и его тип из
+// параметра <param>_type. Принимаются только действующие access-токены этого сервера.
+// Токен, привязанный к ключу DPoP, принимается только с DPoP proof того же ключа jkt.
+func exchangedTokenClaims(w http.ResponseWriter, r *http.Request, repo repository.AuthRepository, issuer *auth.Issuer,
+	param, jkt string) (*auth.Claims, bool) {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "exchangedTokenClaims",
+	})
+
+	token := r.PostForm.Get(param)
+	tokenType := r.PostForm.Get(param + "_type")
+	if token == "" || tokenType == "" {
+		writeOAuthError(w, http.StatusBadRequest, oauthInvalidRequest, "Missing "+param+" or "+param+"_type")
+		return nil, false
+	}
+	if tokenType != auth.TokenTypeURIAccessToken && tokenType != auth.TokenTypeURIJWT {
+		writeOAuthError(w, http.StatusBadRequest, oauthInvalidRequest, "Unsupported "+param+"_type")
+		return nil, false
+	}
+
+	claims, err := issuer.ValidateToken(token, auth.WithTokenType(auth.TokenTypeAccess))
+	if err == nil && isTokenRevoked(repo, token, claims) {
+		err = auth.ErrTokenRevoked
+	}
+	if err == nil && claims.DPoPKey() != "" && claims.DPoPKey() != jkt {
+		err = auth.ErrDPoPKeyMismatch
+	}
+	if err != nil {
+		fncLogger.Errorf("Invalid %s: %v", param, err)
+		writeOAuthError(w, http.StatusBadRequest, oauthInvalidGrant, "Invalid "+param)
+		return nil, false
+	}
+	return claims, true
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository/mocks"
+
+	"github.com/golang/mock/gomock"
+)
+
+// exchangeForm возвращает форму обмена subject_token с заменой параметров из overrides.
+func exchangeForm(subjectToken string, overrides url.Values) url.Values {
+	form := url.Values{
+		"grant_type":         {grantTypeTokenExchange},
+		"subject_token":      {subjectToken},
+		"subject_token_type": {auth.TokenTypeURIAccessToken},
+	}
+	for key, values := range overrides {
+		form[key] = values
+	}
+	return form
+}
+
+func TestTokenExchange(t *testing.T) {
+	issuer := newTestIssuer(t)
+	user, err := issuer.GenerateToken("alice", auth.WithScopes("orders:read", "orders:write", "profile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Токен сервиса gateway, выданный обменивающему клиенту, и токен другого клиента.
+	actorToken, _, err := issuer.GenerateAccessToken("gateway", auth.WithClientID("billing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreignActorToken, _, err := issuer.GenerateAccessToken("gateway", auth.WithClientID("gateway"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := testClient(t, "orders:read", "orders:write")
+	client.ExchangeSubjects = []string{repository.ExchangeSubjectUsers}
+	// Клиент без права обмена.
+	plain := testClient(t, "orders:read")
+
+	tests := []struct {
+		name       string
+		form       url.Values
+		setup      func(repo *mocks.MockAuthRepository)
+		wantStatus int
+		wantError  string
+		wantScope  string
+		wantActor  string
+	}{
+		{
+			name:       "client acts for the user",
+			form:       exchangeForm(user.AccessToken, nil),
+			wantStatus: http.StatusOK,
+			wantScope:  "orders:read orders:write",
+			wantActor:  auth.ClientSubject("billing"),
+		},
+		{
+			name:       "narrower scope",
+			form:       exchangeForm(user.AccessToken, url.Values{"scope": {"orders:read"}}),
+			wantStatus: http.StatusOK,
+			wantScope:  "orders:read",
+			wantActor:  auth.ClientSubject("billing"),
+		},
+		{
+			name: "actor token",
+			form: exchangeForm(user.AccessToken, url.Values{
+				"actor_token":      {actorToken},
+				"actor_token_type": {auth.TokenTypeURIJWT},
+			}),
+			wantStatus: http.StatusOK,
+			wantScope:  "orders:read orders:write",
+			wantActor:  "gateway",
+		},
+		{
+			name: "actor token of another client",
+			form: exchangeForm(user.AccessToken, url.Values{
+				"actor_token":      {foreignActorToken},
+				"actor_token_type": {auth.TokenTypeURIAccessToken},
+			}),
+			wantStatus: http.StatusBadRequest,
+			wantError:  oauthInvalidGrant,
+		},
+		{
+			// profile есть у пользователя, но не у клиента.
+			name:       "scope not allowed to the client",
+			form:       exchangeForm(user.AccessToken, url.Values{"scope": {"profile"}}),
+			wantStatus: http.StatusBadRequest,
+			wantError:  oauthInvalidScope,
+		},
+		{
+			name:       "refresh token as subject",
+			form:       exchangeForm(user.RefreshToken, nil),
+			wantStatus: http.StatusBadRequest,
+			wantError:  oauthInvalidGrant,
+		},
+		{
+			name: "revoked subject token",
+			form: exchangeForm(user.AccessToken, nil),
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().IsInBlacklist(user.AccessToken).Return(true)
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  oauthInvalidGrant,
+		},
+		{
+			name:       "unsupported subject token type",
+			form:       exchangeForm(user.AccessToken, url.Values{"subject_token_type": {"urn:ietf:params:oauth:token-type:saml2"}}),
+			wantStatus: http.StatusBadRequest,
+			wantError:  oauthInvalidRequest,
+		},
+		{
+			name:       "unsupported requested token type",
+			form:       exchangeForm(user.AccessToken, url.Values{"requested_token_type": {"urn:ietf:params:oauth:token-type:refresh_token"}}),
+			wantStatus: http.StatusBadRequest,
+			wantError:  oauthInvalidRequest,
+		},
+		{
+			name: "audit failure",
+			form: exchangeForm(user.AccessToken, nil),
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().AuditTokenExchange(gomock.Any()).Return(errors.New("db is down"))
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantError:  oauthServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mocks.NewMockAuthRepository(ctrl)
+			if tt.setup != nil {
+				tt.setup(repo)
+			}
+			repo.EXPECT().GetClient("billing").Return(client, nil)
+			repo.EXPECT().IsInBlacklist(gomock.Any()).Return(false).AnyTimes()
+			repo.EXPECT().IsTokenFamilyRevoked(gomock.Any()).Return(false).AnyTimes()
+			var audit repository.TokenExchange
+			if tt.wantStatus == http.StatusOK {
+				repo.EXPECT().AuditTokenExchange(gomock.Any()).DoAndReturn(func(exchange repository.TokenExchange) error {
+					audit = exchange
+					return nil
+				})
+			}
+
+			rec := serveForm(Token(repo, issuer), "/oauth/token", tt.form, "billing", "client secret")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantError != "" {
+				var response oauthError
+				if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+					t.Fatal(err)
+				}
+				if response.Error != tt.wantError {
+					t.Errorf("error = %q, want %q", response.Error, tt.wantError)
+				}
+				return
+			}
+
+			var response TokenResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if response.IssuedTokenType != auth.TokenTypeURIAccessToken || response.RefreshToken != "" || response.Scope != tt.wantScope {
+				t.Errorf("response = %+v, want an access token with scope %q", response, tt.wantScope)
+			}
+			claims, err := issuer.ValidateToken(response.AccessToken, auth.WithTokenType(auth.TokenTypeAccess))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Subject != "alice" || claims.ClientID != "billing" || claims.Actor == nil || claims.Actor.Subject != tt.wantActor {
+				t.Errorf("sub = %q, client_id = %q, act = %+v", claims.Subject, claims.ClientID, claims.Actor)
+			}
+			if audit.TokenID != claims.ID || audit.Subject != "alice" || audit.Actor != tt.wantActor || audit.ClientID != "billing" {
+				t.Errorf("audit = %+v, want the issued token", audit)
+			}
+		})
+	}
+
+	// Клиенту без ExchangeSubjects обмен недоступен.
+	ctrl := gomock.NewController(t)
+	repo := mocks.NewMockAuthRepository(ctrl)
+	repo.EXPECT().GetClient("billing").Return(plain, nil)
+	rec := serveForm(Token(repo, issuer), "/oauth/token", exchangeForm(user.AccessToken, nil), "billing", "client secret")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status without exchange rights = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
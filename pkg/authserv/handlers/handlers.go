@@ -2,10 +2,16 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/notify"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/password"
 	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
 	log "github.com/SergeyIvanovDevelop/tss-tools/pkg/logger"
 
@@ -19,6 +25,13 @@ const pkgName string = "tss-tools/pkg/authserv/handlers"
 type Credentials struct {
 	Username string `json:"login"`
 	Password string `json:"password"`
+	// Email - адрес пользователя, необязателен при регистрации.
+	Email string `json:"email,omitempty"`
+}
+
+// RegisterResponse возвращается регистрацией вместо токенов, если вход требует подтвержденного адреса.
+type RegisterResponse struct {
+	EmailVerificationRequired bool `json:"email_verification_required"`
 }
 
 type ValidateRequest struct {
@@ -29,10 +42,19 @@ type RevokeRequest struct {
 	Token string `json:"token"`
 }
 
-func Register(repo repository.AuthRepository) http.HandlerFunc {
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Register создает пользователя, если его пароль проходит policy (при nil - password.DefaultPolicy).
+// На указанный адрес отправляется токен подтверждения через notifier, если он задан.
+// Если verification.Required, адрес обязателен, а токены не выдаются до его подтверждения.
+func Register(repo repository.AuthRepository, issuer *auth.Issuer, policy *password.Policy,
+	notifier notify.Notifier, verification EmailVerificationConfig) http.HandlerFunc {
 	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
 		"func": "Register",
 	})
+	dpop := auth.NewDPoPVerifier(auth.NewMemoryReplayCache())
 	return func(w http.ResponseWriter, r *http.Request) {
 		fncLogger.Debug("Start")
 		var creds Credentials
@@ -42,12 +64,31 @@ func Register(repo repository.AuthRepository) http.HandlerFunc {
 			http.Error(w, "Bad request", http.StatusBadRequest)
 			return
 		}
+		jkt, ok := requestDPoPKey(w, r, issuer, dpop)
+		if !ok {
+			return
+		}
 
 		if creds.Password == "" || creds.Username == "" {
 			fncLogger.Error("Empty username or password:", err)
 			http.Error(w, "Empty username or password", http.StatusBadRequest)
 			return
 		}
+		if strings.HasPrefix(creds.Username, auth.ClientSubjectPrefix) {
+			http.Error(w, "Invalid username", http.StatusBadRequest)
+			return
+		}
+		if creds.Email != "" && !validEmail(creds.Email) {
+			http.Error(w, "Invalid email", http.StatusBadRequest)
+			return
+		}
+		if creds.Email == "" && verification.Required {
+			http.Error(w, "Empty email", http.StatusBadRequest)
+			return
+		}
+		if !checkPasswordPolicy(w, policy, creds.Username, creds.Password) {
+			return
+		}
 
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(creds.Password), bcrypt.DefaultCost)
 		if err != nil {
@@ -56,14 +97,28 @@ func Register(repo repository.AuthRepository) http.HandlerFunc {
 			return
 		}
 
-		err = repo.CreateUser(creds.Username, string(hashedPassword))
+		err = repo.CreateUser(creds.Username, string(hashedPassword), creds.Email)
 		if err != nil {
 			fncLogger.Error("Could not register user:", err)
 			http.Error(w, "Could not register user", http.StatusConflict)
 			return
 		}
 
-		accessToken, refreshToken, err := auth.GenerateToken(creds.Username)
+		if creds.Email != "" && notifier != nil {
+			// Пользователь уже создан: при ошибке отправки токен можно запросить заново через SetEmail.
+			if err := sendEmailVerification(repo, notifier, verification, creds.Username, creds.Email); err != nil {
+				fncLogger.Errorf("Could not send verification to user '%s': %v", creds.Username, err)
+			}
+		}
+		if verification.Required {
+			w.WriteHeader(http.StatusCreated)
+			if err := json.NewEncoder(w).Encode(RegisterResponse{EmailVerificationRequired: true}); err != nil {
+				fncLogger.Error("Error encoding json:", err)
+			}
+			return
+		}
+
+		tokens, err := issueTokens(repo, issuer, r, creds.Username, auth.WithDPoPKey(jkt))
 		if err != nil {
 			fncLogger.Error("Could not generate token:", err)
 			http.Error(w, "Could not generate token", http.StatusInternalServerError)
@@ -71,10 +126,7 @@ func Register(repo repository.AuthRepository) http.HandlerFunc {
 		}
 
 		w.WriteHeader(http.StatusCreated)
-		err = json.NewEncoder(w).Encode(map[string]string{
-			"access_token":  accessToken,
-			"refresh_token": refreshToken,
-		})
+		err = json.NewEncoder(w).Encode(tokenResponse(tokens))
 		if err != nil {
 			fncLogger.Error("Error encoding json:", err)
 			return
@@ -84,10 +136,13 @@ func Register(repo repository.AuthRepository) http.HandlerFunc {
 	}
 }
 
-func Login(repo repository.AuthRepository) http.HandlerFunc {
+// Login выдает пару токенов по логину и паролю. Если у пользователя включен TOTP, вместо
+// токенов возвращается MFAChallengeResponse, который вместе с кодом обменивается на токены в VerifyMFA.
+func Login(repo repository.AuthRepository, issuer *auth.Issuer, config LoginConfig) http.HandlerFunc {
 	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
 		"func": "Login",
 	})
+	dpop := auth.NewDPoPVerifier(auth.NewMemoryReplayCache())
 	return func(w http.ResponseWriter, r *http.Request) {
 		fncLogger.Debug("Start")
 		var creds Credentials
@@ -97,25 +152,53 @@ func Login(repo repository.AuthRepository) http.HandlerFunc {
 			http.Error(w, "Bad request", http.StatusBadRequest)
 			return
 		}
+		jkt, ok := requestDPoPKey(w, r, issuer, dpop)
+		if !ok {
+			return
+		}
 
-		storedPasswordHash, err := repo.GetUser(creds.Username)
-		if err != nil || bcrypt.CompareHashAndPassword([]byte(storedPasswordHash), []byte(creds.Password)) != nil {
+		err = checkCredentials(repo, creds.Username, creds.Password)
+		if err != nil {
 			fncLogger.Error("Unauthorized:", err)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
+		if config.RequireVerifiedEmail {
+			if err := checkEmailVerified(repo, creds.Username); err != nil {
+				fncLogger.Error("Forbidden:", err)
+				http.Error(w, "Email is not verified", http.StatusForbidden)
+				return
+			}
+		}
 
-		accessToken, refreshToken, err := auth.GenerateToken(creds.Username)
+		mfaRequired, err := totpEnabled(repo, creds.Username)
+		if err != nil {
+			fncLogger.Error("Could not check TOTP:", err)
+			http.Error(w, "Could not check two-factor authentication", http.StatusInternalServerError)
+			return
+		}
+		if mfaRequired {
+			challenge, err := startMFAChallenge(repo, config.TOTP, creds.Username)
+			if err != nil {
+				fncLogger.Error("Could not start MFA challenge:", err)
+				http.Error(w, "Could not start two-factor authentication", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Cache-Control", "no-store")
+			if err := json.NewEncoder(w).Encode(challenge); err != nil {
+				fncLogger.Error("Error encoding json:", err)
+			}
+			return
+		}
+
+		tokens, err := issueTokens(repo, issuer, r, creds.Username, auth.WithDPoPKey(jkt))
 		if err != nil {
 			fncLogger.Error("Could not generate token:", err)
 			http.Error(w, "Could not generate token", http.StatusInternalServerError)
 			return
 		}
 
-		err = json.NewEncoder(w).Encode(map[string]string{
-			"access_token":  accessToken,
-			"refresh_token": refreshToken,
-		})
+		err = json.NewEncoder(w).Encode(tokenResponse(tokens))
 		if err != nil {
 			fncLogger.Error("Error encoding json:", err)
 			return
@@ -125,7 +208,48 @@ func Login(repo repository.AuthRepository) http.HandlerFunc {
 	}
 }
 
-func Revoke(repo repository.AuthRepository) http.HandlerFunc {
+func Refresh(repo repository.AuthRepository, issuer *auth.Issuer) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "Refresh",
+	})
+	dpop := auth.NewDPoPVerifier(auth.NewMemoryReplayCache())
+	return func(w http.ResponseWriter, r *http.Request) {
+		fncLogger.Debug("Start")
+		var refreshReq RefreshRequest
+		err := json.NewDecoder(r.Body).Decode(&refreshReq)
+		if err != nil || refreshReq.RefreshToken == "" {
+			fncLogger.Error("Invalid request:", err)
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		jkt, ok := requestDPoPKey(w, r, issuer, dpop)
+		if !ok {
+			return
+		}
+
+		tokens, _, err := refreshTokens(repo, issuer, r, refreshReq.RefreshToken, "", jkt)
+		if errors.Is(err, auth.ErrInvalidToken) {
+			fncLogger.Error("Invalid token:", err)
+			http.Error(w, tokenErrorMessage(err), http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			fncLogger.Error("Could not generate token:", err)
+			http.Error(w, "Could not generate token", http.StatusInternalServerError)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(tokenResponse(tokens))
+		if err != nil {
+			fncLogger.Error("Error encoding json:", err)
+			return
+		}
+
+		fncLogger.Debug("Finished")
+	}
+}
+
+func Revoke(repo repository.AuthRepository, issuer *auth.Issuer) http.HandlerFunc {
 	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
 		"func": "Revoke",
 	})
@@ -138,14 +262,14 @@ func Revoke(repo repository.AuthRepository) http.HandlerFunc {
 			return
 		}
 
-		claims, err := auth.ValidateToken(revokeReq.Token)
+		claims, err := issuer.ValidateToken(revokeReq.Token)
 		if err != nil {
 			fncLogger.Error("Invalid token:", err)
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			http.Error(w, tokenErrorMessage(err), http.StatusUnauthorized)
 			return
 		}
 
-		err = repo.AddToBlacklist(revokeReq.Token, time.Unix(claims.ExpiresAt.Unix(), 0))
+		err = revokeToken(repo, issuer, revokeReq.Token, claims)
 		if err != nil {
 			fncLogger.Error("Failed to revoke token:", err)
 			http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
@@ -161,7 +285,7 @@ func Revoke(repo repository.AuthRepository) http.HandlerFunc {
 	}
 }
 
-func Validate(repo repository.AuthRepository) http.HandlerFunc {
+func Validate(repo repository.AuthRepository, issuer *auth.Issuer) http.HandlerFunc {
 	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
 		"func": "Validate",
 	})
@@ -175,23 +299,23 @@ func Validate(repo repository.AuthRepository) http.HandlerFunc {
 			return
 		}
 
-		if repo.IsInBlacklist(validateReq.Token) {
-			fncLogger.Error("Token is revoked", err)
-			http.Error(w, "Token is revoked", http.StatusUnauthorized)
+		claims, err := issuer.ValidateToken(validateReq.Token, auth.WithTokenType(auth.TokenTypeAccess))
+		if err != nil {
+			fncLogger.Error("Invalid token:", err)
+			http.Error(w, tokenErrorMessage(err), http.StatusUnauthorized)
 			return
 		}
 
-		claims, err := repo.ValidateToken(validateReq.Token)
-		if err != nil {
-			fncLogger.Error("Invalid token:", err)
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+		if isTokenRevoked(repo, validateReq.Token, claims) {
+			fncLogger.Error("Token is revoked")
+			http.Error(w, "Token is revoked", http.StatusUnauthorized)
 			return
 		}
 
 		w.WriteHeader(http.StatusOK)
 		err = json.NewEncoder(w).Encode(map[string]string{
 			"message": "Token is valid",
-			"userID":  claims.Username,
+			"userID":  claims.Subject,
 		})
 		if err != nil {
 			fncLogger.Error("Error encoding json:", err)
@@ -200,3 +324,192 @@ func Validate(repo repository.AuthRepository) http.HandlerFunc {
 		fncLogger.Debug("Finished")
 	}
 }
+
+func JWKS(issuer *auth.Issuer) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "JWKS",
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		err := json.NewEncoder(w).Encode(issuer.JWKS())
+		if err != nil {
+			fncLogger.Error("Error encoding json:", err)
+			return
+		}
+	}
+}
+
+var errInvalidCredentials = errors.New("invalid username or password")
+
+// checkCredentials сверяет пароль с bcrypt-хешем, сохраненным для пользователя.
+func checkCredentials(repo repository.AuthRepository, username, password string) error {
+	storedPasswordHash, err := repo.GetUser(username)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidCredentials, err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(storedPasswordHash), []byte(password)) != nil {
+		return errInvalidCredentials
+	}
+	return nil
+}
+
+// issueTokens выпускает пару токенов с ролями и адресом пользователя в новом семействе,
+// регистрирует семейство в репозитории и открывает для него сессию с адресом и User-Agent запроса r.
+func issueTokens(repo repository.AuthRepository, issuer *auth.Issuer, r *http.Request, username string, opts ...auth.TokenOption) (*auth.TokenPair, error) {
+	userOpts, err := userTokenOptions(repo, username)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := issuer.GenerateToken(username, append(opts, userOpts...)...)
+	if err != nil {
+		return nil, err
+	}
+	refreshClaims := tokens.RefreshClaims
+	err = repo.CreateTokenFamily(refreshClaims.FamilyID, username, refreshClaims.ID, refreshClaims.ExpiresAt.Time)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	err = repo.CreateSession(repository.Session{
+		ID:         refreshClaims.FamilyID,
+		Username:   username,
+		IP:         clientIP(r),
+		UserAgent:  r.UserAgent(),
+		CreatedAt:  now,
+		LastUsedAt: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// refreshTokens обменивает refresh-токен на новую пару в том же семействе. Повторное предъявление
+// уже обменянного токена отзывает все семейство. Ошибки, связанные с самим токеном, оборачивают
+// auth.ErrInvalidToken. Возвращаются также claims предъявленного токена.
+// dpopJKT - thumbprint ключа из DPoP proof запроса: привязанный refresh-токен принимается
+// только с proof того же ключа, а новые токены привязываются к нему.
+func refreshTokens(repo repository.AuthRepository, issuer *auth.Issuer, r *http.Request, refreshToken, clientID, dpopJKT string) (*auth.TokenPair, *auth.Claims, error) {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "refreshTokens",
+	})
+
+	if repo.IsInBlacklist(refreshToken) {
+		return nil, nil, auth.ErrTokenRevoked
+	}
+
+	claims, err := issuer.ValidateToken(refreshToken, auth.WithTokenType(auth.TokenTypeRefresh))
+	if err != nil {
+		return nil, nil, err
+	}
+	if claims.FamilyID == "" {
+		return nil, nil, auth.ErrTokenMalformed
+	}
+	if claims.ClientID != clientID {
+		// Токены клиента обновляет только он сам, токены первой стороны - только /api/user/refresh.
+		return nil, nil, auth.ErrWrongClient
+	}
+	if bound := claims.DPoPKey(); bound != "" && bound != dpopJKT {
+		return nil, nil, auth.ErrDPoPKeyMismatch
+	}
+	if repo.IsTokenFamilyRevoked(claims.FamilyID) {
+		return nil, nil, auth.ErrTokenRevoked
+	}
+
+	userOpts, err := userTokenOptions(repo, claims.Username)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := append([]auth.TokenOption{auth.WithFamily(claims.FamilyID)}, userOpts...)
+	if claims.ClientID != "" {
+		// Разрешения, выданные OAuth-клиенту, сохраняются при обновлении.
+		opts = append(opts, auth.WithClientID(claims.ClientID), auth.WithScopes(claims.Scopes()...))
+	}
+	if dpopJKT != "" {
+		opts = append(opts, auth.WithDPoPKey(dpopJKT))
+	}
+
+	tokens, err := issuer.GenerateToken(claims.Username, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = repo.RotateTokenFamily(claims.FamilyID, claims.ID, tokens.RefreshClaims.ID, tokens.RefreshClaims.ExpiresAt.Time)
+	if err != nil {
+		// Новая пара не выдается, но opaque-токены уже сохранены при выпуске: удаляем их,
+		// иначе при повторном предъявлении они остались бы действительными в хранилище.
+		discardTokens(issuer, tokens)
+	}
+	if errors.Is(err, repository.ErrTokenReused) {
+		// Повторное предъявление refresh-токена означает его утечку: отзываем все семейство.
+		fncLogger.Errorf("Refresh token reuse detected, revoking token family '%s'", claims.FamilyID)
+		if err := repo.RevokeTokenFamily(claims.FamilyID); err != nil {
+			fncLogger.Error("Failed to revoke token family:", err)
+		}
+		return nil, nil, auth.ErrTokenRevoked
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("rotate refresh token: %w", err)
+	}
+	if err := repo.TouchSession(claims.FamilyID, clientIP(r), time.Now()); err != nil {
+		fncLogger.Error("Failed to update session:", err)
+	}
+	return tokens, claims, nil
+}
+
+// discardTokens удаляет из хранилища выпущенные, но не выданные opaque-токены.
+func discardTokens(issuer *auth.Issuer, tokens *auth.TokenPair) {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "discardTokens",
+	})
+	for _, token := range []string{tokens.AccessToken, tokens.RefreshToken} {
+		if _, err := issuer.RevokeOpaqueToken(token); err != nil {
+			fncLogger.Error("Failed to delete unissued token:", err)
+		}
+	}
+}
+
+// clientIP возвращает адрес клиента из r.RemoteAddr без порта.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// requestDPoPKey проверяет DPoP proof запроса на выдачу токенов, если он есть, и возвращает
+// thumbprint его ключа, к которому привязываются выдаваемые токены (RFC 9449, 5).
+// Без proof возвращается пустая строка, при неверном proof отвечает 400.
+func requestDPoPKey(w http.ResponseWriter, r *http.Request, issuer *auth.Issuer, dpop *auth.DPoPVerifier) (string, bool) {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "requestDPoPKey",
+	})
+	proof := r.Header.Get(auth.DPoPHeader)
+	if proof == "" {
+		return "", true
+	}
+	jkt, err := dpop.Verify(proof, r.Method, tokenEndpointURL(r, issuer), "")
+	if err != nil {
+		fncLogger.Error("Invalid DPoP proof:", err)
+		http.Error(w, "Invalid DPoP proof", http.StatusBadRequest)
+		return "", false
+	}
+	return jkt, true
+}
+
+func tokenResponse(tokens *auth.TokenPair) map[string]string {
+	return map[string]string{
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+	}
+}
+
+// tokenErrorMessage возвращает причину отказа в проверке токена, которую можно показать клиенту.
+func tokenErrorMessage(err error) string {
+	if errors.Is(err, auth.ErrInvalidToken) {
+		return auth.ErrorDescription(err)
+	}
+	return "Invalid token"
+}
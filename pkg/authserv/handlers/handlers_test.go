@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository/mocks"
+	log "github.com/SergeyIvanovDevelop/tss-tools/pkg/logger"
+
+	"github.com/golang/mock/gomock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMain(m *testing.M) {
+	log.Initialize(os.Stderr, "error")
+	os.Exit(m.Run())
+}
+
+func newTestIssuer(t *testing.T) *auth.Issuer {
+	t.Helper()
+	issuer, err := auth.NewIssuer(auth.Config{Secret: auth.StaticSecret(bytes.Repeat([]byte("k"), 32))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issuer
+}
+
+// serveJSON вызывает handler с POST-запросом к target с телом body.
+func serveJSON(handler http.HandlerFunc, target, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, target, bytes.NewBufferString(body)))
+	return rec
+}
+
+func TestRefresh(t *testing.T) {
+	issuer := newTestIssuer(t)
+	tokens, err := issuer.GenerateToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientTokens, err := issuer.GenerateToken("alice", auth.WithClientID("billing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := tokens.RefreshClaims
+	body := `{"refresh_token":"` + tokens.RefreshToken + `"}`
+
+	// rotation ожидает обмен refresh-токена на новый в том же семействе с результатом err.
+	rotation := func(err error) func(repo *mocks.MockAuthRepository) {
+		return func(repo *mocks.MockAuthRepository) {
+			repo.EXPECT().IsInBlacklist(tokens.RefreshToken).Return(false)
+			repo.EXPECT().IsTokenFamilyRevoked(claims.FamilyID).Return(false)
+			repo.EXPECT().GetUserRoles("alice").Return(nil, nil)
+			repo.EXPECT().GetUserProfile("alice").Return(&repository.UserProfile{Username: "alice"}, nil)
+			repo.EXPECT().RotateTokenFamily(claims.FamilyID, claims.ID, gomock.Any(), claims.ExpiresAt.Time).
+				DoAndReturn(func(_, _, newJTI string, _ time.Time) error {
+					if newJTI == claims.ID {
+						t.Error("refresh token was not rotated")
+					}
+					return err
+				})
+			if err == nil {
+				repo.EXPECT().TouchSession(claims.FamilyID, "192.0.2.1", gomock.Any()).Return(nil)
+			}
+		}
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		setup      func(repo *mocks.MockAuthRepository)
+		wantStatus int
+	}{
+		{"rotation", body, rotation(nil), http.StatusOK},
+		{
+			name: "reuse revokes the family",
+			body: body,
+			setup: func(repo *mocks.MockAuthRepository) {
+				rotation(repository.ErrTokenReused)(repo)
+				repo.EXPECT().RevokeTokenFamily(claims.FamilyID).Return(nil)
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{"rotation failure", body, rotation(errors.New("db is down")), http.StatusInternalServerError},
+		{
+			name: "revoked family",
+			body: body,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().IsInBlacklist(tokens.RefreshToken).Return(false)
+				repo.EXPECT().IsTokenFamilyRevoked(claims.FamilyID).Return(true)
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "revoked token",
+			body: body,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().IsInBlacklist(tokens.RefreshToken).Return(true)
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "access token",
+			body: `{"refresh_token":"` + tokens.AccessToken + `"}`,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().IsInBlacklist(tokens.AccessToken).Return(false)
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			// Токены OAuth-клиента обновляются только через token endpoint.
+			name: "client refresh token",
+			body: `{"refresh_token":"` + clientTokens.RefreshToken + `"}`,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().IsInBlacklist(clientTokens.RefreshToken).Return(false)
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{"empty token", `{"refresh_token":""}`, func(*mocks.MockAuthRepository) {}, http.StatusBadRequest},
+		{"invalid json", `{`, func(*mocks.MockAuthRepository) {}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mocks.NewMockAuthRepository(ctrl)
+			tt.setup(repo)
+
+			rec := serveJSON(Refresh(repo, issuer), "/api/user/refresh", tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response map[string]string
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			fresh, err := issuer.ValidateToken(response["refresh_token"], auth.WithTokenType(auth.TokenTypeRefresh))
+			if err != nil {
+				t.Fatalf("refresh token: %v", err)
+			}
+			if fresh.FamilyID != claims.FamilyID || fresh.ID == claims.ID {
+				t.Errorf("refresh claims %+v, want a new token in family %q", fresh, claims.FamilyID)
+			}
+			if _, err := issuer.ValidateToken(response["access_token"], auth.WithTokenType(auth.TokenTypeAccess)); err != nil {
+				t.Errorf("access token: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoginCreatesTokenFamily(t *testing.T) {
+	issuer := newTestIssuer(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctrl := gomock.NewController(t)
+	repo := mocks.NewMockAuthRepository(ctrl)
+	repo.EXPECT().GetUser("alice").Return(string(hash), nil)
+	repo.EXPECT().GetUserRoles("alice").Return([]string{"admin"}, nil)
+	repo.EXPECT().GetUserProfile("alice").
+		Return(&repository.UserProfile{Username: "alice", Email: "alice@example.com", EmailVerified: true}, nil)
+	repo.EXPECT().GetTOTPSecret("alice").Return(nil, repository.ErrTOTPNotFound)
+	var familyID, refreshJTI string
+	repo.EXPECT().CreateTokenFamily(gomock.Any(), "alice", gomock.Any(), gomock.Any()).
+		DoAndReturn(func(fid, _, jti string, _ time.Time) error {
+			familyID, refreshJTI = fid, jti
+			return nil
+		})
+	var session repository.Session
+	repo.EXPECT().CreateSession(gomock.Any()).DoAndReturn(func(s repository.Session) error {
+		session = s
+		return nil
+	})
+
+	rec := serveJSON(Login(repo, issuer, LoginConfig{}), "/api/user/login", `{"login":"alice","password":"secret password"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var response map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	claims, err := issuer.ValidateToken(response["refresh_token"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.FamilyID != familyID || claims.ID != refreshJTI {
+		t.Errorf("registered family %q with jti %q, token has %q and %q", familyID, refreshJTI, claims.FamilyID, claims.ID)
+	}
+	if !claims.HasRole("admin") {
+		t.Errorf("token roles = %v, want admin", claims.Roles)
+	}
+	if claims.Email != "alice@example.com" || !claims.EmailVerified {
+		t.Errorf("token email = %q, verified %v, want verified alice@example.com", claims.Email, claims.EmailVerified)
+	}
+	if session.ID != familyID || session.Username != "alice" || session.IP != "192.0.2.1" {
+		t.Errorf("session = %+v, want family %q of alice from 192.0.2.1", session, familyID)
+	}
+}
+
+func TestRegisterRejectsClientSubject(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repo := mocks.NewMockAuthRepository(ctrl)
+
+	// Имя пользователя не может совпасть с субъектом токенов OAuth-клиента.
+	rec := serveJSON(Register(repo, newTestIssuer(t), nil, nil, EmailVerificationConfig{}), "/api/user/register",
+		`{"login":"`+auth.ClientSubject("billing")+`","password":"Correct-Horse-42"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+	}
+}
+
+func TestRefreshReuseDiscardsOpaqueTokens(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repo := mocks.NewMockAuthRepository(ctrl)
+	stored := make(map[string]auth.OpaqueToken)
+	repo.EXPECT().SaveOpaqueToken(gomock.Any()).AnyTimes().DoAndReturn(func(token auth.OpaqueToken) error {
+		stored[token.Hash] = token
+		return nil
+	})
+	repo.EXPECT().GetOpaqueToken(gomock.Any()).AnyTimes().DoAndReturn(func(hash string) (*auth.OpaqueToken, error) {
+		token, ok := stored[hash]
+		if !ok {
+			return nil, auth.ErrTokenNotFound
+		}
+		return &token, nil
+	})
+	repo.EXPECT().DeleteOpaqueToken(gomock.Any()).AnyTimes().DoAndReturn(func(hash string) error {
+		delete(stored, hash)
+		return nil
+	})
+	issuer, err := auth.NewIssuer(auth.Config{
+		Secret:      auth.StaticSecret(bytes.Repeat([]byte("k"), 32)),
+		TokenFormat: auth.TokenFormatOpaque,
+		TokenStore:  repo,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := issuer.GenerateToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := tokens.RefreshClaims
+
+	// Повторно предъявленный refresh-токен отзывает семейство, а выпущенная для ответа пара
+	// не остается в хранилище.
+	repo.EXPECT().IsInBlacklist(tokens.RefreshToken).Return(false)
+	repo.EXPECT().IsTokenFamilyRevoked(claims.FamilyID).Return(false)
+	repo.EXPECT().GetUserRoles("alice").Return(nil, nil)
+	repo.EXPECT().GetUserProfile("alice").Return(&repository.UserProfile{Username: "alice"}, nil)
+	repo.EXPECT().RotateTokenFamily(claims.FamilyID, claims.ID, gomock.Any(), gomock.Any()).Return(repository.ErrTokenReused)
+	repo.EXPECT().RevokeTokenFamily(claims.FamilyID).Return(nil)
+
+	rec := serveJSON(Refresh(repo, issuer), "/api/user/refresh", `{"refresh_token":"`+tokens.RefreshToken+`"}`)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusUnauthorized, rec.Body.String())
+	}
+	if len(stored) != 2 {
+		t.Errorf("store has %d tokens, want only the original pair", len(stored))
+	}
+	for _, token := range []string{tokens.AccessToken, tokens.RefreshToken} {
+		if _, ok := stored[auth.HashOpaqueToken(token)]; !ok {
+			t.Error("original token was deleted")
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
+	log "github.com/SergeyIvanovDevelop/tss-tools/pkg/logger"
+)
+
+// IntrospectionResponse - ответ introspection endpoint (RFC 7662, 2.2).
+// Для недействительного токена заполняется только Active.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	JTI       string `json:"jti,omitempty"`
+	// Cnf - ключ DPoP, к которому привязан токен (RFC 9449, 6.2).
+	Cnf *auth.Confirmation `json:"cnf,omitempty"`
+	// Act - цепочка участников, действующих от имени субъекта (RFC 8693, 4.1).
+	Act *auth.Actor `json:"act,omitempty"`
+}
+
+// Introspect - OAuth 2.0 token introspection endpoint (RFC 7662). Доступен только
+// конфиденциальным клиентам. token_type в ответе - "Bearer" или "DPoP" для access-токенов
+// и "refresh_token" для refresh-токенов.
+func Introspect(repo repository.AuthRepository, issuer *auth.Issuer) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "Introspect",
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		fncLogger.Debug("Start")
+		if err := r.ParseForm(); err != nil {
+			fncLogger.Error("Bad request:", err)
+			writeOAuthError(w, http.StatusBadRequest, oauthInvalidRequest, "Malformed request body")
+			return
+		}
+
+		client, err := authenticateClient(r, repo)
+		if err == nil && client.SecretHash == "" {
+			err = errInvalidClient
+		}
+		if err != nil {
+			fncLogger.Error("Client authentication failed:", err)
+			writeInvalidClient(w, r)
+			return
+		}
+
+		token := r.PostForm.Get("token")
+		if token == "" {
+			writeOAuthError(w, http.StatusBadRequest, oauthInvalidRequest, "Missing token")
+			return
+		}
+
+		writeIntrospectionResponse(w, introspectToken(repo, issuer, token))
+		fncLogger.Debug("Finished")
+	}
+}
+
+// introspectToken проверяет access- или refresh-токен. token_type_hint не нужен: тип записан в самом токене.
+// Остальные токены, которые подписывает issuer, например ID Token, активными не считаются.
+func introspectToken(repo repository.AuthRepository, issuer *auth.Issuer, token string) IntrospectionResponse {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "introspectToken",
+	})
+	claims, err := issuer.ValidateToken(token)
+	if err != nil {
+		fncLogger.Debug("Invalid token:", err)
+		return IntrospectionResponse{}
+	}
+	var responseTokenType string
+	switch claims.TokenType {
+	case auth.TokenTypeAccess:
+		responseTokenType = tokenType(claims)
+	case auth.TokenTypeRefresh:
+		responseTokenType = "refresh_token"
+	default:
+		fncLogger.Debugf("Token type '%s' is not introspectable", claims.TokenType)
+		return IntrospectionResponse{}
+	}
+	if isTokenRevoked(repo, token, claims) {
+		fncLogger.Debug("Token is revoked")
+		return IntrospectionResponse{}
+	}
+
+	response := IntrospectionResponse{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		Username:  claims.Username,
+		Exp:       claims.ExpiresAt.Unix(),
+		Subject:   claims.Subject,
+		Issuer:    claims.Issuer,
+		JTI:       claims.ID,
+		Cnf:       claims.Confirmation,
+		Act:       claims.Actor,
+		TokenType: responseTokenType,
+	}
+	if claims.IssuedAt != nil {
+		response.Iat = claims.IssuedAt.Unix()
+	}
+	return response
+}
+
+func writeIntrospectionResponse(w http.ResponseWriter, response IntrospectionResponse) {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "writeIntrospectionResponse",
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		fncLogger.Error("Error encoding json:", err)
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository/mocks"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestIntrospect(t *testing.T) {
+	issuer := newOIDCIssuer(t)
+	client := testClient(t)
+	tokens, err := issuer.GenerateToken("alice", auth.WithScopes("orders:read"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idToken, err := issuer.GenerateIDToken("alice", "billing", "", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		token         string
+		blacklisted   bool
+		familyRevoked bool
+		wantActive    bool
+		wantTokenType string
+	}{
+		{name: "access token", token: tokens.AccessToken, wantActive: true, wantTokenType: "Bearer"},
+		{name: "refresh token", token: tokens.RefreshToken, wantActive: true, wantTokenType: "refresh_token"},
+		{name: "revoked token", token: tokens.AccessToken, blacklisted: true},
+		{name: "revoked family", token: tokens.AccessToken, familyRevoked: true},
+		{name: "malformed token", token: "not-a-token"},
+		// ID Token подписан тем же ключом, но не дает доступа к ресурсам.
+		{name: "id token", token: idToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mocks.NewMockAuthRepository(ctrl)
+			repo.EXPECT().GetClient("billing").Return(client, nil)
+			repo.EXPECT().IsInBlacklist(tt.token).Return(tt.blacklisted).AnyTimes()
+			repo.EXPECT().IsTokenFamilyRevoked(tokens.AccessClaims.FamilyID).Return(tt.familyRevoked).AnyTimes()
+
+			rec := serveForm(Introspect(repo, issuer), "/oauth/introspect", url.Values{"token": {tt.token}}, "billing", "client secret")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+			}
+			var response IntrospectionResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if !tt.wantActive {
+				if response != (IntrospectionResponse{}) {
+					t.Errorf("response = %+v, want only active=false", response)
+				}
+				return
+			}
+			if !response.Active || response.TokenType != tt.wantTokenType || response.Subject != "alice" || response.Scope != "orders:read" {
+				t.Errorf("response = %+v", response)
+			}
+		})
+	}
+}
+
+func TestIntrospectClientAuthentication(t *testing.T) {
+	issuer := newTestIssuer(t)
+
+	tests := []struct {
+		name       string
+		form       url.Values
+		clientID   string
+		secret     string
+		setup      func(repo *mocks.MockAuthRepository)
+		wantStatus int
+	}{
+		{
+			name:     "wrong secret",
+			form:     url.Values{"token": {"token"}},
+			clientID: "billing",
+			secret:   "guess",
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetClient("billing").Return(testClient(t), nil)
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "public client",
+			form: url.Values{"token": {"token"}, "client_id": {"spa"}},
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetClient("spa").Return(publicClient, nil)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:     "missing token",
+			form:     url.Values{},
+			clientID: "billing",
+			secret:   "client secret",
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetClient("billing").Return(testClient(t), nil)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mocks.NewMockAuthRepository(ctrl)
+			tt.setup(repo)
+
+			rec := serveForm(Introspect(repo, issuer), "/oauth/introspect", tt.form, tt.clientID, tt.secret)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,390 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/totp"
+	log "github.com/SergeyIvanovDevelop/tss-tools/pkg/logger"
+)
+
+// DefaultMFAChallengeTTL - время жизни MFA challenge по умолчанию.
+const DefaultMFAChallengeTTL = 5 * time.Minute
+
+// maxMFAAttempts - число неверных кодов, после которого MFA challenge аннулируется
+// и вход нужно начинать заново с пароля.
+const maxMFAAttempts = 5
+
+// maxTOTPFailures - число неверных кодов TOTP подряд, после которого проверка кодов
+// пользователя блокируется на totpLockout. Счетчик общий для всех способов входа,
+// поэтому новый MFA challenge или другой endpoint не дают новых попыток.
+const (
+	maxTOTPFailures = 5
+	totpLockout     = 15 * time.Minute
+)
+
+var (
+	errInvalidTOTPCode   = errors.New("invalid totp code")
+	errTOTPNotConfigured = errors.New("totp encryption key is not configured")
+)
+
+// TOTPConfig - параметры двухфакторной аутентификации TOTP. Issuer - название сервиса
+// в приложении-аутентификаторе. Cipher шифрует секреты в репозитории; без него подключить TOTP
+// нельзя, а пользователи, у которых TOTP уже включен, не смогут войти.
+type TOTPConfig struct {
+	Issuer       string
+	Cipher       *totp.Cipher
+	ChallengeTTL time.Duration
+}
+
+// LoginConfig - параметры входа по паролю в Login и Authorize. RequireVerifiedEmail запрещает
+// вход пользователя с неподтвержденным адресом.
+type LoginConfig struct {
+	RequireVerifiedEmail bool
+	TOTP                 TOTPConfig
+}
+
+// EnrollTOTPResponse содержит новый секрет и otpauth:// URI для приложения-аутентификатора.
+type EnrollTOTPResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// MFAChallengeResponse возвращается Login вместо токенов, если у пользователя включен TOTP.
+// MFAToken вместе с кодом обменивается на пару токенов в VerifyMFA.
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+type VerifyMFARequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+// EnrollTOTP начинает подключение TOTP пользователю, которому выдан access-токен: создает секрет
+// и возвращает его вместе с otpauth:// URI. TOTP включается после подтверждения кода в ConfirmTOTP,
+// до этого повторный вызов заменяет секрет.
+// Обработчик должен располагаться после middleware.JWTAuthentication.
+func EnrollTOTP(repo repository.AuthRepository, config TOTPConfig) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "EnrollTOTP",
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		fncLogger.Debug("Start")
+		claims, ok := accountClaims(w, r)
+		if !ok {
+			return
+		}
+		if config.Cipher == nil {
+			fncLogger.Error("Could not enroll TOTP:", errTOTPNotConfigured)
+			http.Error(w, "Two-factor authentication is not configured", http.StatusInternalServerError)
+			return
+		}
+
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			fncLogger.Error("Could not generate TOTP secret:", err)
+			http.Error(w, "Could not enroll TOTP", http.StatusInternalServerError)
+			return
+		}
+		encrypted, err := config.Cipher.Encrypt(claims.Username, secret)
+		if err != nil {
+			fncLogger.Error("Could not encrypt TOTP secret:", err)
+			http.Error(w, "Could not enroll TOTP", http.StatusInternalServerError)
+			return
+		}
+		err = repo.SaveTOTPSecret(repository.TOTPSecret{
+			Username:  claims.Username,
+			Secret:    encrypted,
+			CreatedAt: time.Now(),
+		})
+		if errors.Is(err, repository.ErrTOTPEnabled) {
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			fncLogger.Errorf("Could not save TOTP secret of user '%s': %v", claims.Username, err)
+			http.Error(w, "Could not enroll TOTP", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusCreated)
+		err = json.NewEncoder(w).Encode(EnrollTOTPResponse{
+			Secret: secret,
+			URI:    totp.URI(config.Issuer, claims.Username, secret),
+		})
+		if err != nil {
+			fncLogger.Error("Error encoding json:", err)
+			return
+		}
+		fncLogger.Debug("Finished")
+	}
+}
+
+// ConfirmTOTP включает TOTP, начатый в EnrollTOTP, если предъявлен верный код из приложения.
+// Обработчик должен располагаться после middleware.JWTAuthentication.
+func ConfirmTOTP(repo repository.AuthRepository, config TOTPConfig) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "ConfirmTOTP",
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		fncLogger.Debug("Start")
+		claims, ok := accountClaims(w, r)
+		if !ok {
+			return
+		}
+		var request TOTPCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			fncLogger.Error("Bad request:", err)
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+
+		secret, err := repo.GetTOTPSecret(claims.Username)
+		if errors.Is(err, repository.ErrTOTPNotFound) {
+			http.Error(w, "Two-factor authentication enrollment is not started", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			fncLogger.Errorf("Could not load TOTP secret of user '%s': %v", claims.Username, err)
+			http.Error(w, "Could not confirm TOTP", http.StatusInternalServerError)
+			return
+		}
+		if secret.Confirmed {
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+
+		step, err := validateTOTPCode(config.Cipher, secret, request.Code)
+		if errors.Is(err, errInvalidTOTPCode) {
+			http.Error(w, "Invalid code", http.StatusBadRequest)
+			return
+		}
+		if err == nil {
+			err = repo.ConfirmTOTPSecret(claims.Username, step)
+		}
+		if err != nil {
+			fncLogger.Errorf("Could not confirm TOTP of user '%s': %v", claims.Username, err)
+			http.Error(w, "Could not confirm TOTP", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		fncLogger.Debug("Finished")
+	}
+}
+
+// DisableTOTP отключает TOTP пользователя, которому выдан access-токен. Если TOTP включен,
+// нужен действующий код из приложения.
+// Обработчик должен располагаться после middleware.JWTAuthentication.
+func DisableTOTP(repo repository.AuthRepository, config TOTPConfig) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "DisableTOTP",
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		fncLogger.Debug("Start")
+		claims, ok := accountClaims(w, r)
+		if !ok {
+			return
+		}
+		var request TOTPCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			fncLogger.Error("Bad request:", err)
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+
+		err := checkTOTPCode(repo, config.Cipher, claims.Username, request.Code)
+		if errors.Is(err, repository.ErrTOTPLocked) {
+			fncLogger.Errorf("TOTP of user '%s' is locked: %v", claims.Username, err)
+			http.Error(w, "Too many attempts, try again later", http.StatusTooManyRequests)
+			return
+		}
+		if errors.Is(err, errInvalidTOTPCode) || errors.Is(err, repository.ErrTOTPCodeUsed) {
+			fncLogger.Errorf("Wrong TOTP code of user '%s': %v", claims.Username, err)
+			http.Error(w, "Invalid code", http.StatusForbidden)
+			return
+		}
+		// Неподтвержденный секрет удаляется без кода.
+		if err == nil || errors.Is(err, repository.ErrTOTPNotFound) {
+			err = repo.DeleteTOTPSecret(claims.Username)
+		}
+		if err != nil {
+			fncLogger.Errorf("Could not disable TOTP of user '%s': %v", claims.Username, err)
+			http.Error(w, "Could not disable TOTP", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		fncLogger.Debug("Finished")
+	}
+}
+
+// VerifyMFA - второй шаг входа: обменивает MFA challenge из Login и код TOTP на пару токенов.
+// После maxMFAAttempts неверных кодов challenge аннулируется; после maxTOTPFailures неверных
+// кодов подряд (в том числе в Authorize и DisableTOTP) ответ 429 до истечения totpLockout.
+func VerifyMFA(repo repository.AuthRepository, issuer *auth.Issuer, config TOTPConfig) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "VerifyMFA",
+	})
+	dpop := auth.NewDPoPVerifier(auth.NewMemoryReplayCache())
+	return func(w http.ResponseWriter, r *http.Request) {
+		fncLogger.Debug("Start")
+		var request VerifyMFARequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			fncLogger.Error("Bad request:", err)
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		if request.MFAToken == "" || request.Code == "" {
+			http.Error(w, "Empty MFA token or code", http.StatusBadRequest)
+			return
+		}
+		jkt, ok := requestDPoPKey(w, r, issuer, dpop)
+		if !ok {
+			return
+		}
+
+		tokenHash := hashToken(request.MFAToken)
+		challenge, err := repo.GetMFAChallenge(tokenHash)
+		if err == nil && !time.Now().Before(challenge.ExpiresAt) {
+			err = errors.New("mfa challenge is expired")
+		}
+		if err != nil {
+			fncLogger.Error("Invalid MFA token:", err)
+			http.Error(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+			return
+		}
+
+		err = checkTOTPCode(repo, config.Cipher, challenge.Username, request.Code)
+		if errors.Is(err, repository.ErrTOTPLocked) {
+			fncLogger.Errorf("TOTP of user '%s' is locked: %v", challenge.Username, err)
+			http.Error(w, "Too many attempts, try again later", http.StatusTooManyRequests)
+			return
+		}
+		if errors.Is(err, errInvalidTOTPCode) || errors.Is(err, repository.ErrTOTPCodeUsed) ||
+			errors.Is(err, repository.ErrTOTPNotFound) {
+			fncLogger.Errorf("Wrong TOTP code of user '%s': %v", challenge.Username, err)
+			attempts, failErr := repo.FailMFAChallenge(tokenHash)
+			if failErr == nil && attempts >= maxMFAAttempts {
+				_, failErr = repo.ConsumeMFAChallenge(tokenHash)
+			}
+			if failErr != nil {
+				fncLogger.Error("Could not record failed MFA attempt:", failErr)
+			}
+			http.Error(w, "Invalid code", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			fncLogger.Errorf("Could not check TOTP code of user '%s': %v", challenge.Username, err)
+			http.Error(w, "Could not check code", http.StatusInternalServerError)
+			return
+		}
+		if _, err := repo.ConsumeMFAChallenge(tokenHash); err != nil {
+			fncLogger.Error("MFA token is already used:", err)
+			http.Error(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+			return
+		}
+
+		tokens, err := issueTokens(repo, issuer, r, challenge.Username, auth.WithDPoPKey(jkt))
+		if err != nil {
+			fncLogger.Error("Could not generate token:", err)
+			http.Error(w, "Could not generate token", http.StatusInternalServerError)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(tokenResponse(tokens))
+		if err != nil {
+			fncLogger.Error("Error encoding json:", err)
+			return
+		}
+		fncLogger.Debug("Finished")
+	}
+}
+
+// totpEnabled сообщает, включен ли у пользователя TOTP.
+func totpEnabled(repo repository.AuthRepository, username string) (bool, error) {
+	secret, err := repo.GetTOTPSecret(username)
+	if errors.Is(err, repository.ErrTOTPNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return secret.Confirmed, nil
+}
+
+// startMFAChallenge сохраняет MFA challenge пользователя username и возвращает ответ с ним.
+func startMFAChallenge(repo repository.AuthRepository, config TOTPConfig, username string) (*MFAChallengeResponse, error) {
+	ttl := config.ChallengeTTL
+	if ttl <= 0 {
+		ttl = DefaultMFAChallengeTTL
+	}
+	token, err := generateRandomToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	err = repo.SaveMFAChallenge(repository.MFAChallenge{
+		TokenHash: hashToken(token),
+		Username:  username,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MFAChallengeResponse{MFARequired: true, MFAToken: token, ExpiresIn: int64(ttl.Seconds())}, nil
+}
+
+// checkTOTPCode проверяет код включенного TOTP пользователя и отмечает его использованным.
+// Повторно предъявленный код отклоняется с repository.ErrTOTPCodeUsed. Попытка учитывается
+// до проверки кода; после maxTOTPFailures неверных кодов возвращается repository.ErrTOTPLocked.
+func checkTOTPCode(repo repository.AuthRepository, cipher *totp.Cipher, username, code string) error {
+	secret, err := repo.GetTOTPSecret(username)
+	if err != nil {
+		return err
+	}
+	if !secret.Confirmed {
+		return repository.ErrTOTPNotFound
+	}
+	if err := repo.RecordTOTPAttempt(username, time.Now(), maxTOTPFailures, totpLockout); err != nil {
+		return err
+	}
+	step, err := validateTOTPCode(cipher, secret, code)
+	if err != nil {
+		return err
+	}
+	return repo.UseTOTPStep(username, step)
+}
+
+// validateTOTPCode расшифровывает секрет и возвращает шаг, которому соответствует code.
+func validateTOTPCode(cipher *totp.Cipher, secret *repository.TOTPSecret, code string) (int64, error) {
+	if cipher == nil {
+		return 0, errTOTPNotConfigured
+	}
+	key, err := cipher.Decrypt(secret.Username, secret.Secret)
+	if err != nil {
+		return 0, err
+	}
+	step, ok, err := totp.Validate(key, code, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, errInvalidTOTPCode
+	}
+	return step, nil
+}
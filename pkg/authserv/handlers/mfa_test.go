@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository/mocks"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/totp"
+
+	"github.com/golang/mock/gomock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func newTestCipher(t *testing.T) *totp.Cipher {
+	t.Helper()
+	cipher, err := totp.NewCipher(bytes.Repeat([]byte("c"), totp.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cipher
+}
+
+// confirmedTOTPSecret возвращает включенный TOTP пользователя alice и действующий код.
+func confirmedTOTPSecret(t *testing.T, cipher *totp.Cipher) (*repository.TOTPSecret, string, int64) {
+	t.Helper()
+	data, err := cipher.Encrypt("alice", testTOTPSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	step := totp.Step(time.Now())
+	code, err := totp.Code(testTOTPSecret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &repository.TOTPSecret{Username: "alice", Secret: data, Confirmed: true}, code, step
+}
+
+func TestCheckTOTPCode(t *testing.T) {
+	cipher := newTestCipher(t)
+	secret, code, step := confirmedTOTPSecret(t, cipher)
+	unconfirmed := *secret
+	unconfirmed.Confirmed = false
+
+	tests := []struct {
+		name    string
+		cipher  *totp.Cipher
+		code    string
+		setup   func(repo *mocks.MockAuthRepository)
+		wantErr error
+	}{
+		{
+			name: "valid code",
+			code: code,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetTOTPSecret("alice").Return(secret, nil)
+				repo.EXPECT().RecordTOTPAttempt("alice", gomock.Any(), maxTOTPFailures, totpLockout).Return(nil)
+				repo.EXPECT().UseTOTPStep("alice", step).Return(nil)
+			},
+		},
+		{
+			name: "replayed code",
+			code: code,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetTOTPSecret("alice").Return(secret, nil)
+				repo.EXPECT().RecordTOTPAttempt("alice", gomock.Any(), maxTOTPFailures, totpLockout).Return(nil)
+				repo.EXPECT().UseTOTPStep("alice", step).Return(repository.ErrTOTPCodeUsed)
+			},
+			wantErr: repository.ErrTOTPCodeUsed,
+		},
+		{
+			name: "wrong code",
+			code: "not-a-code",
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetTOTPSecret("alice").Return(secret, nil)
+				repo.EXPECT().RecordTOTPAttempt("alice", gomock.Any(), maxTOTPFailures, totpLockout).Return(nil)
+			},
+			wantErr: errInvalidTOTPCode,
+		},
+		{
+			name: "locked out",
+			code: code,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetTOTPSecret("alice").Return(secret, nil)
+				repo.EXPECT().RecordTOTPAttempt("alice", gomock.Any(), maxTOTPFailures, totpLockout).
+					Return(repository.ErrTOTPLocked)
+			},
+			wantErr: repository.ErrTOTPLocked,
+		},
+		{
+			name: "not confirmed",
+			code: code,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetTOTPSecret("alice").Return(&unconfirmed, nil)
+			},
+			wantErr: repository.ErrTOTPNotFound,
+		},
+		{
+			name: "not enrolled",
+			code: code,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetTOTPSecret("alice").Return(nil, repository.ErrTOTPNotFound)
+			},
+			wantErr: repository.ErrTOTPNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mocks.NewMockAuthRepository(ctrl)
+			tt.setup(repo)
+
+			err := checkTOTPCode(repo, cipher, "alice", tt.code)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkTOTPCode err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyMFA(t *testing.T) {
+	cipher := newTestCipher(t)
+	secret, code, step := confirmedTOTPSecret(t, cipher)
+	tokenHash := hashToken("mfa-token")
+	challenge := &repository.MFAChallenge{
+		TokenHash: tokenHash,
+		Username:  "alice",
+		ExpiresAt: time.Now().Add(time.Minute),
+	}
+
+	tests := []struct {
+		name       string
+		setup      func(repo *mocks.MockAuthRepository)
+		wantStatus int
+	}{
+		{
+			name: "valid code",
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().RecordTOTPAttempt("alice", gomock.Any(), maxTOTPFailures, totpLockout).Return(nil)
+				repo.EXPECT().UseTOTPStep("alice", step).Return(nil)
+				repo.EXPECT().ConsumeMFAChallenge(tokenHash).Return(challenge, nil)
+				repo.EXPECT().GetUserRoles("alice").Return(nil, nil)
+				repo.EXPECT().GetUserProfile("alice").Return(&repository.UserProfile{Username: "alice"}, nil)
+				repo.EXPECT().CreateTokenFamily(gomock.Any(), "alice", gomock.Any(), gomock.Any()).Return(nil)
+				repo.EXPECT().CreateSession(gomock.Any()).Return(nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "replayed code fails the challenge",
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().RecordTOTPAttempt("alice", gomock.Any(), maxTOTPFailures, totpLockout).Return(nil)
+				repo.EXPECT().UseTOTPStep("alice", step).Return(repository.ErrTOTPCodeUsed)
+				repo.EXPECT().FailMFAChallenge(tokenHash).Return(1, nil)
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "last attempt consumes the challenge",
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().RecordTOTPAttempt("alice", gomock.Any(), maxTOTPFailures, totpLockout).Return(nil)
+				repo.EXPECT().UseTOTPStep("alice", step).Return(repository.ErrTOTPCodeUsed)
+				repo.EXPECT().FailMFAChallenge(tokenHash).Return(maxMFAAttempts, nil)
+				repo.EXPECT().ConsumeMFAChallenge(tokenHash).Return(challenge, nil)
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "locked out",
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().RecordTOTPAttempt("alice", gomock.Any(), maxTOTPFailures, totpLockout).
+					Return(repository.ErrTOTPLocked)
+			},
+			wantStatus: http.StatusTooManyRequests,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mocks.NewMockAuthRepository(ctrl)
+			repo.EXPECT().GetMFAChallenge(tokenHash).Return(challenge, nil)
+			repo.EXPECT().GetTOTPSecret("alice").Return(secret, nil)
+			tt.setup(repo)
+
+			handler := VerifyMFA(repo, newTestIssuer(t), TOTPConfig{Cipher: cipher})
+			body := `{"mfa_token":"mfa-token","code":"` + code + `"}`
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodPost, "/api/user/mfa/verify", bytes.NewBufferString(body)))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestLoginMFAChallenge(t *testing.T) {
+	cipher := newTestCipher(t)
+	secret, _, _ := confirmedTOTPSecret(t, cipher)
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctrl := gomock.NewController(t)
+	repo := mocks.NewMockAuthRepository(ctrl)
+	repo.EXPECT().GetUser("alice").Return(string(hash), nil)
+	repo.EXPECT().GetTOTPSecret("alice").Return(secret, nil)
+	var saved repository.MFAChallenge
+	repo.EXPECT().SaveMFAChallenge(gomock.Any()).DoAndReturn(func(challenge repository.MFAChallenge) error {
+		saved = challenge
+		return nil
+	})
+
+	// Вместо токенов выдается MFA challenge.
+	rec := serveJSON(Login(repo, newTestIssuer(t), LoginConfig{TOTP: TOTPConfig{Cipher: cipher}}),
+		"/api/user/login", `{"login":"alice","password":"secret password"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var response MFAChallengeResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if !response.MFARequired || hashToken(response.MFAToken) != saved.TokenHash || saved.Username != "alice" {
+		t.Errorf("response = %+v does not match saved challenge %+v", response, saved)
+	}
+	if response.ExpiresIn != int64(DefaultMFAChallengeTTL.Seconds()) {
+		t.Errorf("expires_in = %d, want %v", response.ExpiresIn, DefaultMFAChallengeTTL)
+	}
+}
@@ -0,0 +1,374 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/middleware"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
+	log "github.com/SergeyIvanovDevelop/tss-tools/pkg/logger"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Коды ошибок OAuth 2.0 (RFC 6749, 5.2).
+const (
+	oauthInvalidRequest       = "invalid_request"
+	oauthInvalidClient        = "invalid_client"
+	oauthInvalidGrant         = "invalid_grant"
+	oauthUnauthorizedClient   = "unauthorized_client"
+	oauthUnsupportedGrantType = "unsupported_grant_type"
+	oauthInvalidScope         = "invalid_scope"
+	oauthServerError          = "server_error"
+	oauthInvalidDPoPProof     = "invalid_dpop_proof"
+	oauthInvalidTarget        = "invalid_target" // RFC 8693, 2.2.2
+)
+
+const (
+	grantTypeClientCredentials = "client_credentials"
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeRefreshToken      = "refresh_token"
+	grantTypeTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+)
+
+var errInvalidClient = errors.New("client authentication failed")
+
+// TokenResponse - успешный ответ token endpoint (RFC 6749, 5.1).
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	// IssuedTokenType - тип выданного токена при обмене токенов (RFC 8693, 2.2.1).
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
+
+type oauthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// HashClientSecret возвращает bcrypt-хеш секрета для repository.OAuthClient.SecretHash.
+func HashClientSecret(secret string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Token - OAuth 2.0 token endpoint. Поддерживаются grant_type client_credentials,
+// authorization_code (с PKCE), refresh_token и обмен токенов (RFC 8693). Если запрос содержит DPoP proof (RFC 9449, 5),
+// выданные токены привязываются к его ключу и имеют тип DPoP.
+func Token(repo repository.AuthRepository, issuer *auth.Issuer) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "Token",
+	})
+	dpop := auth.NewDPoPVerifier(auth.NewMemoryReplayCache())
+	return func(w http.ResponseWriter, r *http.Request) {
+		fncLogger.Debug("Start")
+		if err := r.ParseForm(); err != nil {
+			fncLogger.Error("Bad request:", err)
+			writeOAuthError(w, http.StatusBadRequest, oauthInvalidRequest, "Malformed request body")
+			return
+		}
+
+		var jkt string
+		if proof := r.Header.Get(auth.DPoPHeader); proof != "" {
+			var err error
+			jkt, err = dpop.Verify(proof, r.Method, tokenEndpointURL(r, issuer), "")
+			if err != nil {
+				fncLogger.Error("Invalid DPoP proof:", err)
+				writeOAuthError(w, http.StatusBadRequest, oauthInvalidDPoPProof, auth.DPoPErrorDescription(err))
+				return
+			}
+		}
+
+		grantType := r.PostForm.Get("grant_type")
+		switch grantType {
+		case grantTypeClientCredentials:
+			clientCredentialsGrant(w, r, repo, issuer, jkt)
+		case grantTypeAuthorizationCode:
+			authorizationCodeGrant(w, r, repo, issuer, jkt)
+		case grantTypeRefreshToken:
+			refreshTokenGrant(w, r, repo, issuer, jkt)
+		case grantTypeTokenExchange:
+			tokenExchangeGrant(w, r, repo, issuer, jkt)
+		case "":
+			writeOAuthError(w, http.StatusBadRequest, oauthInvalidRequest, "Missing grant_type")
+		default:
+			fncLogger.Errorf("Unsupported grant type '%s'", grantType)
+			writeOAuthError(w, http.StatusBadRequest, oauthUnsupportedGrantType, "")
+		}
+		fncLogger.Debug("Finished")
+	}
+}
+
+func clientCredentialsGrant(w http.ResponseWriter, r *http.Request, repo repository.AuthRepository, issuer *auth.Issuer, jkt string) {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "clientCredentialsGrant",
+	})
+
+	client, err := authenticateClient(r, repo)
+	if err != nil {
+		fncLogger.Error("Client authentication failed:", err)
+		writeInvalidClient(w, r)
+		return
+	}
+	if client.SecretHash == "" {
+		fncLogger.Errorf("Public client '%s' requested client_credentials", client.ID)
+		writeOAuthError(w, http.StatusBadRequest, oauthUnauthorizedClient, "Public clients cannot use client_credentials")
+		return
+	}
+
+	scopes, ok := grantScopes(r.PostForm.Get("scope"), client.Scopes)
+	if !ok {
+		fncLogger.Errorf("Client '%s' requested not allowed scope '%s'", client.ID, r.PostForm.Get("scope"))
+		writeOAuthError(w, http.StatusBadRequest, oauthInvalidScope, "")
+		return
+	}
+
+	accessToken, claims, err := issuer.GenerateAccessToken(auth.ClientSubject(client.ID),
+		auth.WithClientID(client.ID), auth.WithScopes(scopes...), auth.WithDPoPKey(jkt))
+	if err != nil {
+		fncLogger.Error("Could not generate token:", err)
+		writeOAuthError(w, http.StatusInternalServerError, oauthServerError, "")
+		return
+	}
+
+	writeTokenResponse(w, TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   tokenType(claims),
+		ExpiresIn:   expiresIn(claims),
+		Scope:       claims.Scope,
+	})
+}
+
+// authorizationCodeGrant обменивает код авторизации на пару токенов (RFC 6749, 4.1.3; RFC 7636, 4.5).
+// Код одноразовый: он удаляется из репозитория при первом предъявлении, даже неудачном.
+func authorizationCodeGrant(w http.ResponseWriter, r *http.Request, repo repository.AuthRepository, issuer *auth.Issuer, jkt string) {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "authorizationCodeGrant",
+	})
+
+	client, err := authenticateClient(r, repo)
+	if err != nil {
+		fncLogger.Error("Client authentication failed:", err)
+		writeInvalidClient(w, r)
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	verifier := r.PostForm.Get("code_verifier")
+	if code == "" || verifier == "" {
+		writeOAuthError(w, http.StatusBadRequest, oauthInvalidRequest, "Missing code or code_verifier")
+		return
+	}
+
+	stored, err := repo.ConsumeAuthorizationCode(hashToken(code))
+	if err != nil {
+		fncLogger.Error("Unknown authorization code:", err)
+		writeOAuthError(w, http.StatusBadRequest, oauthInvalidGrant, "")
+		return
+	}
+	switch {
+	case stored.ClientID != client.ID:
+		fncLogger.Errorf("Authorization code was issued to client '%s', presented by '%s'", stored.ClientID, client.ID)
+		writeOAuthError(w, http.StatusBadRequest, oauthInvalidGrant, "")
+		return
+	case stored.RedirectURI != r.PostForm.Get("redirect_uri"):
+		fncLogger.Errorf("Redirect URI mismatch for client '%s'", client.ID)
+		writeOAuthError(w, http.StatusBadRequest, oauthInvalidGrant, "redirect_uri does not match")
+		return
+	case !time.Now().Before(stored.ExpiresAt):
+		fncLogger.Errorf("Expired authorization code for client '%s'", client.ID)
+		writeOAuthError(w, http.StatusBadRequest, oauthInvalidGrant, "Authorization code expired")
+		return
+	case !verifyPKCE(verifier, stored.CodeChallenge):
+		fncLogger.Errorf("PKCE verification failed for client '%s'", client.ID)
+		writeOAuthError(w, http.StatusBadRequest, oauthInvalidGrant, "Invalid code_verifier")
+		return
+	}
+
+	tokens, err := issueTokens(repo, issuer, r, stored.Username,
+		auth.WithClientID(client.ID), auth.WithScopes(stored.Scopes...), auth.WithDPoPKey(jkt))
+	if err != nil {
+		fncLogger.Error("Could not generate tokens:", err)
+		writeOAuthError(w, http.StatusInternalServerError, oauthServerError, "")
+		return
+	}
+	response := TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    tokenType(tokens.AccessClaims),
+		ExpiresIn:    expiresIn(tokens.AccessClaims),
+		RefreshToken: tokens.RefreshToken,
+		Scope:        tokens.AccessClaims.Scope,
+	}
+
+	if slices.Contains(stored.Scopes, auth.ScopeOpenID) {
+		response.IDToken, err = issuer.GenerateIDToken(stored.Username, client.ID, stored.Nonce, stored.AuthTime)
+		if err != nil {
+			fncLogger.Error("Could not generate ID token:", err)
+			writeOAuthError(w, http.StatusInternalServerError, oauthServerError, "")
+			return
+		}
+	}
+
+	writeTokenResponse(w, response)
+}
+
+// refreshTokenGrant обновляет токены, выданные клиенту (RFC 6749, 6).
+func refreshTokenGrant(w http.ResponseWriter, r *http.Request, repo repository.AuthRepository, issuer *auth.Issuer, jkt string) {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "refreshTokenGrant",
+	})
+
+	client, err := authenticateClient(r, repo)
+	if err != nil {
+		fncLogger.Error("Client authentication failed:", err)
+		writeInvalidClient(w, r)
+		return
+	}
+
+	refreshToken := r.PostForm.Get("refresh_token")
+	if refreshToken == "" {
+		writeOAuthError(w, http.StatusBadRequest, oauthInvalidRequest, "Missing refresh_token")
+		return
+	}
+
+	tokens, _, err := refreshTokens(repo, issuer, r, refreshToken, client.ID, jkt)
+	if errors.Is(err, auth.ErrInvalidToken) {
+		fncLogger.Error("Invalid refresh token:", err)
+		writeOAuthError(w, http.StatusBadRequest, oauthInvalidGrant, tokenErrorMessage(err))
+		return
+	}
+	if err != nil {
+		fncLogger.Error("Could not refresh tokens:", err)
+		writeOAuthError(w, http.StatusInternalServerError, oauthServerError, "")
+		return
+	}
+
+	writeTokenResponse(w, TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    tokenType(tokens.AccessClaims),
+		ExpiresIn:    expiresIn(tokens.AccessClaims),
+		RefreshToken: tokens.RefreshToken,
+		Scope:        tokens.AccessClaims.Scope,
+	})
+}
+
+// authenticateClient проверяет учетные данные клиента из заголовка Authorization: Basic
+// (RFC 6749, 2.3.1) или из параметров client_id и client_secret. Публичный клиент
+// (без секрета) аутентифицируется одним client_id.
+func authenticateClient(r *http.Request, repo repository.AuthRepository) (*repository.OAuthClient, error) {
+	clientID, clientSecret, basic := r.BasicAuth()
+	if basic {
+		var err error
+		if clientID, err = url.QueryUnescape(clientID); err != nil {
+			return nil, errInvalidClient
+		}
+		if clientSecret, err = url.QueryUnescape(clientSecret); err != nil {
+			return nil, errInvalidClient
+		}
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+	if clientID == "" {
+		return nil, errInvalidClient
+	}
+
+	client, err := repo.GetClient(clientID)
+	if err != nil {
+		return nil, errInvalidClient
+	}
+	if client.SecretHash == "" {
+		if clientSecret != "" {
+			return nil, errInvalidClient
+		}
+		return client, nil
+	}
+	if bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(clientSecret)) != nil {
+		return nil, errInvalidClient
+	}
+	return client, nil
+}
+
+// grantScopes возвращает запрошенные разрешения, если все они разрешены клиенту.
+// Пустой запрос означает все разрешения клиента.
+func grantScopes(requested string, allowed []string) ([]string, bool) {
+	scopes := strings.Fields(requested)
+	if len(scopes) == 0 {
+		return allowed, true
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(allowed, scope) {
+			return nil, false
+		}
+	}
+	return scopes, true
+}
+
+// tokenType возвращает token_type ответа token endpoint: DPoP для привязанных токенов, иначе Bearer.
+func tokenType(claims *auth.Claims) string {
+	if claims.DPoPKey() != "" {
+		return "DPoP"
+	}
+	return "Bearer"
+}
+
+// tokenEndpointURL - адрес token endpoint для проверки htu. Если задано имя issuer,
+// адрес строится от него, как в документе discovery.
+func tokenEndpointURL(r *http.Request, issuer *auth.Issuer) string {
+	if issuer.Name() == "" {
+		return middleware.RequestURL(r)
+	}
+	return strings.TrimSuffix(issuer.Name(), "/") + r.URL.EscapedPath()
+}
+
+func expiresIn(claims *auth.Claims) int64 {
+	return int64(claims.ExpiresAt.Sub(claims.IssuedAt.Time).Seconds())
+}
+
+func writeTokenResponse(w http.ResponseWriter, response TokenResponse) {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "writeTokenResponse",
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		fncLogger.Error("Error encoding json:", err)
+	}
+}
+
+// writeInvalidClient отвечает invalid_client. При Basic-аутентификации ответ - 401 с WWW-Authenticate.
+func writeInvalidClient(w http.ResponseWriter, r *http.Request) {
+	if _, _, basic := r.BasicAuth(); basic {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		writeOAuthError(w, http.StatusUnauthorized, oauthInvalidClient, "")
+		return
+	}
+	writeOAuthError(w, http.StatusBadRequest, oauthInvalidClient, "")
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "writeOAuthError",
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(oauthError{Error: code, ErrorDescription: description}); err != nil {
+		fncLogger.Error("Error encoding json:", err)
+	}
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository/mocks"
+
+	"github.com/golang/mock/gomock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// serveForm вызывает handler с POST-запросом к target с формой form.
+// Непустой clientID передается в заголовке Authorization: Basic.
+func serveForm(handler http.HandlerFunc, target string, form url.Values, clientID, clientSecret string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" {
+		request.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, request)
+	return rec
+}
+
+// testClient возвращает конфиденциального клиента с секретом "client secret".
+func testClient(t *testing.T, scopes ...string) *repository.OAuthClient {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("client secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &repository.OAuthClient{ID: "billing", SecretHash: string(hash), Scopes: scopes}
+}
+
+func TestClientCredentials(t *testing.T) {
+	issuer := newTestIssuer(t)
+	client := testClient(t, "invoices:read", "invoices:write")
+
+	tests := []struct {
+		name         string
+		form         url.Values
+		clientID     string
+		clientSecret string
+		setup        func(repo *mocks.MockAuthRepository)
+		wantStatus   int
+		wantError    string
+		wantScope    string
+	}{
+		{
+			name:         "basic authentication",
+			form:         url.Values{"grant_type": {"client_credentials"}},
+			clientID:     "billing",
+			clientSecret: "client secret",
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetClient("billing").Return(client, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantScope:  "invoices:read invoices:write",
+		},
+		{
+			name: "credentials in form",
+			form: url.Values{
+				"grant_type":    {"client_credentials"},
+				"client_id":     {"billing"},
+				"client_secret": {"client secret"},
+				"scope":         {"invoices:read"},
+			},
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetClient("billing").Return(client, nil)
+			},
+			wantStatus: http.StatusOK,
+			wantScope:  "invoices:read",
+		},
+		{
+			name:         "wrong secret",
+			form:         url.Values{"grant_type": {"client_credentials"}},
+			clientID:     "billing",
+			clientSecret: "guess",
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetClient("billing").Return(client, nil)
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantError:  oauthInvalidClient,
+		},
+		{
+			name: "unknown client",
+			form: url.Values{"grant_type": {"client_credentials"}, "client_id": {"nobody"}},
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetClient("nobody").Return(nil, errors.New("no rows"))
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  oauthInvalidClient,
+		},
+		{
+			name: "public client",
+			form: url.Values{"grant_type": {"client_credentials"}, "client_id": {"spa"}},
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetClient("spa").Return(&repository.OAuthClient{ID: "spa"}, nil)
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  oauthUnauthorizedClient,
+		},
+		{
+			name:         "scope not allowed",
+			form:         url.Values{"grant_type": {"client_credentials"}, "scope": {"invoices:read users:write"}},
+			clientID:     "billing",
+			clientSecret: "client secret",
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetClient("billing").Return(client, nil)
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  oauthInvalidScope,
+		},
+		{
+			name:       "unsupported grant type",
+			form:       url.Values{"grant_type": {"password"}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  oauthUnsupportedGrantType,
+		},
+		{
+			name:       "missing grant type",
+			form:       url.Values{},
+			wantStatus: http.StatusBadRequest,
+			wantError:  oauthInvalidRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mocks.NewMockAuthRepository(ctrl)
+			if tt.setup != nil {
+				tt.setup(repo)
+			}
+
+			rec := serveForm(Token(repo, issuer), "/oauth/token", tt.form, tt.clientID, tt.clientSecret)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if rec.Header().Get("Cache-Control") != "no-store" {
+				t.Error("token response is cacheable")
+			}
+			if tt.wantError != "" {
+				var response oauthError
+				if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+					t.Fatal(err)
+				}
+				if response.Error != tt.wantError {
+					t.Errorf("error = %q, want %q", response.Error, tt.wantError)
+				}
+				return
+			}
+
+			var response TokenResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if response.TokenType != "Bearer" || response.RefreshToken != "" || response.Scope != tt.wantScope {
+				t.Errorf("response = %+v, want a Bearer token with scope %q and no refresh token", response, tt.wantScope)
+			}
+			claims, err := issuer.ValidateToken(response.AccessToken, auth.WithTokenType(auth.TokenTypeAccess))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Subject != auth.ClientSubject("billing") || claims.ClientID != "billing" || claims.Username != "" {
+				t.Errorf("sub = %q, client_id = %q, username = %q", claims.Subject, claims.ClientID, claims.Username)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
+	log "github.com/SergeyIvanovDevelop/tss-tools/pkg/logger"
+)
+
+// ProviderMetadata - документ OpenID Connect Discovery 1.0, 3.
+type ProviderMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	DPoPSigningAlgValuesSupported     []string `json:"dpop_signing_alg_values_supported"`
+}
+
+// UserInfoResponse - ответ userinfo endpoint (OpenID Connect Core 1.0, 5.3.2).
+type UserInfoResponse struct {
+	Subject           string `json:"sub"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Name              string `json:"name,omitempty"`
+	UpdatedAt         int64  `json:"updated_at,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+}
+
+// Discovery отдает метаданные OpenID Connect провайдера, если он включен (auth.Config.OpenIDConnect).
+// Адреса endpoint'ов строятся от Config.Issuer, поэтому он должен совпадать с внешним адресом authserv.
+func Discovery(issuer *auth.Issuer) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "Discovery",
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !issuer.OpenIDEnabled() {
+			fncLogger.Error("OpenID Connect is not enabled")
+			http.Error(w, "OpenID Connect is not configured", http.StatusNotFound)
+			return
+		}
+		base := strings.TrimSuffix(issuer.Name(), "/")
+		metadata := ProviderMetadata{
+			Issuer:                            issuer.Name(),
+			AuthorizationEndpoint:             base + "/oauth/authorize",
+			TokenEndpoint:                     base + "/oauth/token",
+			UserInfoEndpoint:                  base + "/userinfo",
+			JWKSURI:                           base + "/.well-known/jwks.json",
+			IntrospectionEndpoint:             base + "/oauth/introspect",
+			RevocationEndpoint:                base + "/oauth/revoke",
+			ScopesSupported:                   []string{auth.ScopeOpenID, auth.ScopeProfile, auth.ScopeEmail},
+			ResponseTypesSupported:            []string{"code"},
+			GrantTypesSupported:               []string{grantTypeAuthorizationCode, grantTypeRefreshToken, grantTypeClientCredentials, grantTypeTokenExchange},
+			SubjectTypesSupported:             []string{"public"},
+			IDTokenSigningAlgValuesSupported:  []string{issuer.SigningAlgorithm()},
+			TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+			CodeChallengeMethodsSupported:     []string{pkceMethodS256},
+			ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "preferred_username", "name", "updated_at", "email", "email_verified"},
+			DPoPSigningAlgValuesSupported:     auth.DPoPAlgorithms,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		if err := json.NewEncoder(w).Encode(metadata); err != nil {
+			fncLogger.Error("Error encoding json:", err)
+			return
+		}
+	}
+}
+
+// UserInfo возвращает claims профиля пользователя, которому выдан access-токен.
+// Должен располагаться после middleware.JWTAuthentication и middleware.RequireScopes(auth.ScopeOpenID).
+func UserInfo(repo repository.AuthRepository) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "UserInfo",
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		fncLogger.Debug("Start")
+		claims, ok := userClaims(w, r)
+		if !ok {
+			fncLogger.Error("Token was not issued to a user")
+			return
+		}
+
+		profile, err := repo.GetUserProfile(claims.Username)
+		if err != nil {
+			fncLogger.Errorf("Could not load profile of user '%s': %v", claims.Username, err)
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		response := UserInfoResponse{Subject: claims.Subject}
+		if claims.HasScope(auth.ScopeProfile) {
+			response.PreferredUsername = profile.Username
+			response.Name = profile.Name
+			response.UpdatedAt = profile.UpdatedAt.Unix()
+		}
+		if claims.HasScope(auth.ScopeEmail) && profile.Email != "" {
+			response.Email = profile.Email
+			response.EmailVerified = &profile.EmailVerified
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			fncLogger.Error("Error encoding json:", err)
+			return
+		}
+		fncLogger.Debug("Finished")
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/middleware"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository/mocks"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang/mock/gomock"
+)
+
+// newOIDCIssuer возвращает Issuer с OpenID Connect: с именем и асимметричным ключом.
+func newOIDCIssuer(t *testing.T) *auth.Issuer {
+	t.Helper()
+	key, err := auth.GenerateSigningKey(auth.AlgES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := auth.NewIssuer(auth.Config{SigningKey: key, Issuer: "https://auth.example.com/", OpenIDConnect: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issuer
+}
+
+func TestDiscovery(t *testing.T) {
+	issuer := newOIDCIssuer(t)
+	rec := httptest.NewRecorder()
+	Discovery(issuer)(rec, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var metadata ProviderMetadata
+	if err := json.NewDecoder(rec.Body).Decode(&metadata); err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Issuer != "https://auth.example.com/" || metadata.JWKSURI != "https://auth.example.com/.well-known/jwks.json" {
+		t.Errorf("issuer = %q, jwks_uri = %q", metadata.Issuer, metadata.JWKSURI)
+	}
+	if len(metadata.IDTokenSigningAlgValuesSupported) != 1 || metadata.IDTokenSigningAlgValuesSupported[0] != auth.AlgES256 {
+		t.Errorf("id_token_signing_alg_values_supported = %v", metadata.IDTokenSigningAlgValuesSupported)
+	}
+
+	// Без auth.Config.OpenIDConnect метаданные не публикуются.
+	rec = httptest.NewRecorder()
+	Discovery(newTestIssuer(t))(rec, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status without issuer name = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestAuthorizationCodeGrantIDToken(t *testing.T) {
+	issuer := newOIDCIssuer(t)
+	const code = "authorization-code"
+	authTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	ctrl := gomock.NewController(t)
+	repo := mocks.NewMockAuthRepository(ctrl)
+	repo.EXPECT().GetClient("spa").Return(publicClient, nil)
+	repo.EXPECT().ConsumeAuthorizationCode(hashToken(code)).Return(&repository.AuthorizationCode{
+		CodeHash:      hashToken(code),
+		ClientID:      "spa",
+		Username:      "alice",
+		RedirectURI:   "https://spa.example.com/callback",
+		Scopes:        []string{auth.ScopeOpenID},
+		CodeChallenge: testChallenge,
+		Nonce:         "n-0S6_WzA2Mj",
+		AuthTime:      authTime,
+		ExpiresAt:     time.Now().Add(time.Minute),
+	}, nil)
+	repo.EXPECT().GetUserRoles("alice").Return(nil, nil)
+	repo.EXPECT().GetUserProfile("alice").Return(&repository.UserProfile{Username: "alice"}, nil)
+	repo.EXPECT().CreateTokenFamily(gomock.Any(), "alice", gomock.Any(), gomock.Any()).Return(nil)
+	repo.EXPECT().CreateSession(gomock.Any()).Return(nil)
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"spa"},
+		"code":          {code},
+		"redirect_uri":  {"https://spa.example.com/callback"},
+		"code_verifier": {testVerifier},
+	}
+	rec := serveForm(Token(repo, issuer), "/oauth/token", form, "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var response TokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	// Клиент проверяет подпись ID Token ключом из опубликованного JWKS.
+	jwksServer := httptest.NewServer(JWKS(issuer))
+	defer jwksServer.Close()
+	jwks, err := auth.FetchJWKS(context.Background(), jwksServer.Client(), jwksServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := &auth.IDTokenClaims{}
+	_, err = jwt.ParseWithClaims(response.IDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		for _, key := range jwks.Keys {
+			if key.KeyID == token.Header["kid"] {
+				return key.PublicKey()
+			}
+		}
+		return nil, errors.New("no published key for the ID token")
+	}, jwt.WithValidMethods([]string{auth.AlgES256}), jwt.WithIssuer(issuer.Name()), jwt.WithAudience("spa"))
+	if err != nil {
+		t.Fatalf("ID token does not verify against JWKS: %v", err)
+	}
+	if claims.Subject != "alice" || claims.Nonce != "n-0S6_WzA2Mj" || !claims.AuthTime.Equal(authTime) {
+		t.Errorf("sub = %q, nonce = %q, auth_time = %v", claims.Subject, claims.Nonce, claims.AuthTime)
+	}
+	if len(claims.Audience) != 1 || claims.Audience[0] != "spa" {
+		t.Errorf("aud = %v, want [spa]", claims.Audience)
+	}
+}
+
+func TestUserInfo(t *testing.T) {
+	issuer := newOIDCIssuer(t)
+	updatedAt := time.Unix(1700000000, 0)
+	token := func(subject string, opts ...auth.TokenOption) string {
+		pair, err := issuer.GenerateToken(subject, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pair.AccessToken
+	}
+	clientToken, _, err := issuer.GenerateAccessToken("billing", auth.WithClientID("billing"), auth.WithScopes(auth.ScopeOpenID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verified := true
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+		want       UserInfoResponse
+	}{
+		{
+			name:       "profile scope",
+			token:      token("alice", auth.WithScopes(auth.ScopeOpenID, auth.ScopeProfile)),
+			wantStatus: http.StatusOK,
+			want:       UserInfoResponse{Subject: "alice", PreferredUsername: "alice", Name: "Alice", UpdatedAt: updatedAt.Unix()},
+		},
+		{
+			name:       "email scope",
+			token:      token("alice", auth.WithScopes(auth.ScopeOpenID, auth.ScopeEmail)),
+			wantStatus: http.StatusOK,
+			want:       UserInfoResponse{Subject: "alice", Email: "alice@example.com", EmailVerified: &verified},
+		},
+		{
+			name:       "openid only",
+			token:      token("alice", auth.WithScopes(auth.ScopeOpenID)),
+			wantStatus: http.StatusOK,
+			want:       UserInfoResponse{Subject: "alice"},
+		},
+		{name: "no openid scope", token: token("alice"), wantStatus: http.StatusForbidden},
+		{name: "client token", token: clientToken, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mocks.NewMockAuthRepository(ctrl)
+			repo.EXPECT().GetUserProfile("alice").
+				Return(&repository.UserProfile{Username: "alice", Name: "Alice", Email: "alice@example.com", EmailVerified: true, UpdatedAt: updatedAt}, nil).AnyTimes()
+
+			handler := middleware.JWTAuthentication(issuer)(middleware.RequireScopes(auth.ScopeOpenID)(UserInfo(repo)))
+			request := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+			request.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, request)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response UserInfoResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(response, tt.want) {
+				t.Errorf("userinfo = %+v, want %+v", response, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/password"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
+	log "github.com/SergeyIvanovDevelop/tss-tools/pkg/logger"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ChangePasswordRequest - запрос смены пароля. RevokeOtherSessions завершает все сессии
+// пользователя, кроме текущей: их токены отклоняются по отозванному семейству. API-ключи
+// при этом остаются действительными, их отзывает RevokeAllTokens.
+type ChangePasswordRequest struct {
+	CurrentPassword     string `json:"current_password"`
+	NewPassword         string `json:"new_password"`
+	RevokeOtherSessions bool   `json:"revoke_other_sessions"`
+}
+
+// PasswordPolicyResponse - ответ на пароль, не прошедший политику паролей.
+type PasswordPolicyResponse struct {
+	Error      string               `json:"error"`
+	Violations []password.Violation `json:"violations"`
+}
+
+// ChangePassword меняет пароль пользователя, которому выдан access-токен, после проверки
+// текущего пароля и политики policy (при nil - password.DefaultPolicy).
+// Обработчик должен располагаться после middleware.JWTAuthentication.
+func ChangePassword(repo repository.AuthRepository, policy *password.Policy) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "ChangePassword",
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		fncLogger.Debug("Start")
+		claims, ok := accountClaims(w, r)
+		if !ok {
+			return
+		}
+
+		var request ChangePasswordRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			fncLogger.Error("Bad request:", err)
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		if request.CurrentPassword == "" || request.NewPassword == "" {
+			http.Error(w, "Empty current or new password", http.StatusBadRequest)
+			return
+		}
+
+		if err := checkCredentials(repo, claims.Username, request.CurrentPassword); err != nil {
+			fncLogger.Errorf("Wrong current password of user '%s': %v", claims.Username, err)
+			http.Error(w, "Wrong current password", http.StatusForbidden)
+			return
+		}
+		if !checkPasswordPolicy(w, policy, claims.Username, request.NewPassword) {
+			return
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			fncLogger.Error("Error process password:", err)
+			http.Error(w, "Error process password", http.StatusInternalServerError)
+			return
+		}
+		if err := repo.UpdatePassword(claims.Username, string(hashedPassword)); err != nil {
+			fncLogger.Errorf("Could not update password of user '%s': %v", claims.Username, err)
+			http.Error(w, "Could not update password", http.StatusInternalServerError)
+			return
+		}
+
+		if request.RevokeOtherSessions {
+			if err := repo.RevokeOtherSessions(claims.Username, claims.FamilyID); err != nil {
+				fncLogger.Error("Failed to revoke sessions:", err)
+				http.Error(w, "Password changed, but failed to revoke sessions", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		fncLogger.Debug("Finished")
+	}
+}
+
+// checkPasswordPolicy проверяет новый пароль пользователя по policy. Если пароль не подходит,
+// отвечает 400 со списком нарушенных правил и возвращает false.
+func checkPasswordPolicy(w http.ResponseWriter, policy *password.Policy, username, newPassword string) bool {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "checkPasswordPolicy",
+	})
+	if policy == nil {
+		policy = password.DefaultPolicy()
+	}
+
+	err := policy.Validate(username, newPassword)
+	if err == nil {
+		return true
+	}
+	var policyErr *password.PolicyError
+	if !errors.As(err, &policyErr) {
+		fncLogger.Error("Could not check password:", err)
+		http.Error(w, "Could not check password", http.StatusInternalServerError)
+		return false
+	}
+
+	fncLogger.Errorf("Password of user '%s' violates policy: %v", username, err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	response := PasswordPolicyResponse{Error: "password_policy", Violations: policyErr.Violations}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		fncLogger.Error("Error encoding json:", err)
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/middleware"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/password"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository/mocks"
+
+	"github.com/golang/mock/gomock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// serveAuthenticatedJSON вызывает handler после middleware.JWTAuthentication с POST-запросом
+// к target с телом body и токеном token в заголовке Authorization.
+func serveAuthenticatedJSON(issuer *auth.Issuer, handler http.HandlerFunc, target, token, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, target, bytes.NewBufferString(body))
+	request.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	middleware.JWTAuthentication(issuer)(handler).ServeHTTP(rec, request)
+	return rec
+}
+
+func TestChangePassword(t *testing.T) {
+	issuer := newTestIssuer(t)
+	tokens, err := issuer.GenerateToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte("old password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const newPassword = "Correct-Horse-42"
+
+	tests := []struct {
+		name           string
+		body           string
+		setup          func(repo *mocks.MockAuthRepository)
+		wantStatus     int
+		wantViolations []string
+	}{
+		{
+			name: "changed",
+			body: `{"current_password":"old password","new_password":"` + newPassword + `"}`,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetUser("alice").Return(string(hash), nil)
+				repo.EXPECT().UpdatePassword("alice", gomock.Any()).DoAndReturn(func(username, hashedPassword string) error {
+					if bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(newPassword)) != nil {
+						t.Error("stored hash does not match the new password")
+					}
+					return nil
+				})
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name: "other sessions revoked",
+			body: `{"current_password":"old password","new_password":"` + newPassword + `","revoke_other_sessions":true}`,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetUser("alice").Return(string(hash), nil)
+				repo.EXPECT().UpdatePassword("alice", gomock.Any()).Return(nil)
+				repo.EXPECT().RevokeOtherSessions("alice", tokens.AccessClaims.FamilyID).Return(nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name: "wrong current password",
+			body: `{"current_password":"guess","new_password":"` + newPassword + `"}`,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetUser("alice").Return(string(hash), nil)
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "weak new password",
+			body: `{"current_password":"old password","new_password":"short"}`,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetUser("alice").Return(string(hash), nil)
+			},
+			wantStatus:     http.StatusBadRequest,
+			wantViolations: []string{password.RuleMinLength},
+		},
+		{
+			name:       "empty new password",
+			body:       `{"current_password":"old password"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "repository failure",
+			body: `{"current_password":"old password","new_password":"` + newPassword + `"}`,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetUser("alice").Return(string(hash), nil)
+				repo.EXPECT().UpdatePassword("alice", gomock.Any()).Return(errors.New("db is down"))
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mocks.NewMockAuthRepository(ctrl)
+			if tt.setup != nil {
+				tt.setup(repo)
+			}
+
+			rec := serveAuthenticatedJSON(issuer, ChangePassword(repo, nil), "/api/user/password", tokens.AccessToken, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantViolations == nil {
+				return
+			}
+			var response PasswordPolicyResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Error != "password_policy" || len(response.Violations) != len(tt.wantViolations) ||
+				response.Violations[0].Rule != tt.wantViolations[0] {
+				t.Errorf("response = %+v, want violations %v", response, tt.wantViolations)
+			}
+		})
+	}
+}
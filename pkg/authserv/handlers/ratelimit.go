@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter ограничивает число запросов с одним ключом (например, адресом клиента)
+// в фиксированном окне. Состояние хранится в памяти экземпляра.
+type rateLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	window  time.Duration
+	windows map[string]*rateWindow
+	sweepAt time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, windows: make(map[string]*rateWindow)}
+}
+
+// Allow учитывает запрос с ключом key в момент now и сообщает, не превышен ли лимит.
+func (l *rateLimiter) Allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Истекшие окна удаляются раз в окно, чтобы карта не росла без предела.
+	if now.After(l.sweepAt) {
+		for k, w := range l.windows {
+			if now.Sub(w.start) >= l.window {
+				delete(l.windows, k)
+			}
+		}
+		l.sweepAt = now.Add(l.window)
+	}
+
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		l.windows[key] = &rateWindow{start: now, count: 1}
+		return true
+	}
+	if w.count >= l.limit {
+		return false
+	}
+	w.count++
+	return true
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := newRateLimiter(2, time.Minute)
+
+	for i, want := range []bool{true, true, false} {
+		if got := limiter.Allow("192.0.2.1", now); got != want {
+			t.Errorf("request %d: Allow = %v, want %v", i+1, got, want)
+		}
+	}
+	// Лимиты разных ключей независимы.
+	if !limiter.Allow("198.51.100.7", now) {
+		t.Error("request from another address was limited")
+	}
+	// В новом окне счетчик начинается заново, а истекшие окна удаляются.
+	if !limiter.Allow("192.0.2.1", now.Add(time.Minute+time.Second)) {
+		t.Error("request in the next window was limited")
+	}
+	if len(limiter.windows) != 1 {
+		t.Errorf("limiter keeps %d windows, want 1", len(limiter.windows))
+	}
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/notify"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/password"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
+	log "github.com/SergeyIvanovDevelop/tss-tools/pkg/logger"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Параметры сброса пароля по умолчанию.
+const (
+	DefaultPasswordResetTTL       = 30 * time.Minute
+	DefaultPasswordResetCooldown  = 5 * time.Minute
+	DefaultPasswordResetUserLimit = 5
+	DefaultPasswordResetIPLimit   = 20
+)
+
+const (
+	// passwordResetLimitWindow - окно, в котором считаются запросы для UserLimit и IPLimit.
+	passwordResetLimitWindow = time.Hour
+	// maxPendingPasswordResets - сколько запросов сброса может обрабатываться одновременно.
+	maxPendingPasswordResets = 16
+)
+
+// PasswordResetConfig - параметры сброса пароля. Если задан URL, уведомление содержит ссылку
+// с токеном в параметре token, иначе сам токен.
+// Действующий токен не заменяется новым и новое уведомление не отправляется, пока не пройдет
+// Cooldown. UserLimit и IPLimit - сколько запросов в час принимается для одного имени
+// пользователя и с одного адреса. Нулевые значения заменяются значениями по умолчанию.
+type PasswordResetConfig struct {
+	TTL       time.Duration
+	URL       string
+	Cooldown  time.Duration
+	UserLimit int
+	IPLimit   int
+}
+
+type PasswordResetRequest struct {
+	Username string `json:"login"`
+}
+
+type ConfirmPasswordResetRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// RequestPasswordReset выпускает токен сброса пароля и отправляет его пользователю через notifier.
+// Новый токен заменяет ранее выпущенный, если с его выпуска прошло config.Cooldown. Ответ не зависит
+// от того, существует ли пользователь: поиск пользователя и отправка выполняются после ответа 202.
+// При превышении лимитов запросов отвечает 429, при перегрузке отправки - 503.
+func RequestPasswordReset(repo repository.AuthRepository, notifier notify.Notifier, config PasswordResetConfig) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "RequestPasswordReset",
+	})
+	if config.TTL <= 0 {
+		config.TTL = DefaultPasswordResetTTL
+	}
+	if config.Cooldown <= 0 {
+		config.Cooldown = DefaultPasswordResetCooldown
+	}
+	if config.UserLimit <= 0 {
+		config.UserLimit = DefaultPasswordResetUserLimit
+	}
+	if config.IPLimit <= 0 {
+		config.IPLimit = DefaultPasswordResetIPLimit
+	}
+	userLimiter := newRateLimiter(config.UserLimit, passwordResetLimitWindow)
+	ipLimiter := newRateLimiter(config.IPLimit, passwordResetLimitWindow)
+	pending := make(chan struct{}, maxPendingPasswordResets)
+	return func(w http.ResponseWriter, r *http.Request) {
+		fncLogger.Debug("Start")
+		var request PasswordResetRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			fncLogger.Error("Bad request:", err)
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		if request.Username == "" {
+			http.Error(w, "Empty username", http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+		if !ipLimiter.Allow(clientIP(r), now) || !userLimiter.Allow(request.Username, now) {
+			fncLogger.Errorf("Too many password reset requests for user '%s' from '%s'", request.Username, clientIP(r))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		select {
+		case pending <- struct{}{}:
+		default:
+			fncLogger.Error("Too many pending password resets")
+			http.Error(w, "Try again later", http.StatusServiceUnavailable)
+			return
+		}
+
+		go func() {
+			defer func() { <-pending }()
+			sendPasswordReset(repo, notifier, config, request.Username)
+		}()
+		w.WriteHeader(http.StatusAccepted)
+		fncLogger.Debug("Finished")
+	}
+}
+
+// sendPasswordReset сохраняет новый токен сброса пароля пользователя username и отправляет его
+// на подтвержденный адрес пользователя, а если его нет - на username.
+// Для неизвестного пользователя ничего не делает.
+func sendPasswordReset(repo repository.AuthRepository, notifier notify.Notifier, config PasswordResetConfig, username string) {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "sendPasswordReset",
+	})
+	profile, err := repo.GetUserProfile(username)
+	if err != nil {
+		fncLogger.Debugf("Password reset for unknown user '%s': %v", username, err)
+		return
+	}
+	// На неподтвержденный адрес токен не отправляется: его мог указать кто угодно.
+	recipient := username
+	if profile.Email != "" && profile.EmailVerified {
+		recipient = profile.Email
+	}
+
+	token, err := generateRandomToken()
+	if err != nil {
+		fncLogger.Error("Could not generate reset token:", err)
+		return
+	}
+	now := time.Now()
+	reset := repository.PasswordReset{
+		TokenHash: hashToken(token),
+		Username:  username,
+		CreatedAt: now,
+		ExpiresAt: now.Add(config.TTL),
+	}
+	err = repo.SavePasswordReset(reset, config.Cooldown)
+	if errors.Is(err, repository.ErrPasswordResetTooSoon) {
+		fncLogger.Infof("Password reset of user '%s' was requested again within cooldown", username)
+		return
+	}
+	if err != nil {
+		fncLogger.Errorf("Could not save reset token of user '%s': %v", username, err)
+		return
+	}
+
+	err = notifier.Notify(notify.Message{
+		To:      recipient,
+		Subject: "Password reset",
+		Body:    passwordResetBody(config, token, reset.ExpiresAt),
+	})
+	if err != nil {
+		fncLogger.Errorf("Could not send reset token to user '%s': %v", username, err)
+	}
+}
+
+func passwordResetBody(config PasswordResetConfig, token string, expiresAt time.Time) string {
+	return fmt.Sprintf("A password reset was requested for your account.\n\n%s\n\n"+
+		"It expires at %s. If you did not request a reset, ignore this message.",
+		tokenLink(config.URL, token, "Reset"), expiresAt.UTC().Format(time.RFC1123))
+}
+
+// ConfirmPasswordReset устанавливает новый пароль по токену сброса. Токен одноразовый.
+// После сброса все токены и сессии пользователя отзываются.
+func ConfirmPasswordReset(repo repository.AuthRepository, policy *password.Policy) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "ConfirmPasswordReset",
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		fncLogger.Debug("Start")
+		var request ConfirmPasswordResetRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			fncLogger.Error("Bad request:", err)
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		if request.Token == "" || request.NewPassword == "" {
+			http.Error(w, "Empty token or new password", http.StatusBadRequest)
+			return
+		}
+
+		tokenHash := hashToken(request.Token)
+		reset, err := repo.GetPasswordReset(tokenHash)
+		if err == nil && !time.Now().Before(reset.ExpiresAt) {
+			err = errors.New("reset token is expired")
+		}
+		if err != nil {
+			fncLogger.Error("Invalid reset token:", err)
+			http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+			return
+		}
+		// Политика проверяется до использования токена, чтобы неподходящий пароль не сжигал его.
+		if !checkPasswordPolicy(w, policy, reset.Username, request.NewPassword) {
+			return
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			fncLogger.Error("Error process password:", err)
+			http.Error(w, "Error process password", http.StatusInternalServerError)
+			return
+		}
+		if _, err := repo.ConsumePasswordReset(tokenHash); err != nil {
+			fncLogger.Error("Reset token is already used:", err)
+			http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+			return
+		}
+		if err := repo.UpdatePassword(reset.Username, string(hashedPassword)); err != nil {
+			fncLogger.Errorf("Could not update password of user '%s': %v", reset.Username, err)
+			http.Error(w, "Could not update password", http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := repo.BumpTokenVersion(reset.Username); err != nil {
+			fncLogger.Errorf("Failed to bump token version of user '%s': %v", reset.Username, err)
+			http.Error(w, "Password changed, but failed to revoke tokens", http.StatusInternalServerError)
+			return
+		}
+		if err := repo.RevokeOtherSessions(reset.Username, ""); err != nil {
+			fncLogger.Error("Failed to revoke sessions:", err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		fncLogger.Debug("Finished")
+	}
+}
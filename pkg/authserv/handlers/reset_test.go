@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/notify"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository/mocks"
+
+	"github.com/golang/mock/gomock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// channelNotifier передает уведомления в канал.
+type channelNotifier chan notify.Message
+
+func (n channelNotifier) Notify(message notify.Message) error {
+	n <- message
+	return nil
+}
+
+func TestRequestPasswordReset(t *testing.T) {
+	config := PasswordResetConfig{TTL: time.Hour, URL: "https://app.example.com/reset"}
+
+	t.Run("known user", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		repo := mocks.NewMockAuthRepository(ctrl)
+		notifier := make(channelNotifier, 1)
+		var saved repository.PasswordReset
+		// Токен отправляется на подтвержденный адрес пользователя.
+		repo.EXPECT().GetUserProfile("alice").
+			Return(&repository.UserProfile{Username: "alice", Email: "alice@example.com", EmailVerified: true}, nil)
+		repo.EXPECT().SavePasswordReset(gomock.Any(), DefaultPasswordResetCooldown).DoAndReturn(func(reset repository.PasswordReset, _ time.Duration) error {
+			saved = reset
+			return nil
+		})
+
+		rec := serveJSON(RequestPasswordReset(repo, notifier, config), "/api/password/reset", `{"login":"alice"}`)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var message notify.Message
+		select {
+		case message = <-notifier:
+		case <-time.After(5 * time.Second):
+			t.Fatal("reset token was not sent")
+		}
+		_, token, ok := strings.Cut(message.Body, "https://app.example.com/reset?token=")
+		if !ok || message.To != "alice@example.com" {
+			t.Fatalf("message = %+v, want a reset link to alice@example.com", message)
+		}
+		token, _, _ = strings.Cut(token, "\n")
+		if hashToken(token) != saved.TokenHash || saved.Username != "alice" {
+			t.Errorf("sent token does not match saved reset %+v", saved)
+		}
+		if got := saved.ExpiresAt.Sub(saved.CreatedAt); got != config.TTL {
+			t.Errorf("reset lifetime = %v, want %v", got, config.TTL)
+		}
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		repo := mocks.NewMockAuthRepository(ctrl)
+		done := make(chan struct{})
+		repo.EXPECT().GetUserProfile("nobody").DoAndReturn(func(username string) (*repository.UserProfile, error) {
+			close(done)
+			return nil, errors.New("no rows")
+		})
+
+		// Ответ не раскрывает, существует ли пользователь.
+		rec := serveJSON(RequestPasswordReset(repo, make(channelNotifier), config), "/api/password/reset", `{"login":"nobody"}`)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+		}
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("user was not looked up")
+		}
+	})
+
+	t.Run("too many requests for user", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		repo := mocks.NewMockAuthRepository(ctrl)
+		done := make(chan struct{})
+		repo.EXPECT().GetUserProfile("nobody").DoAndReturn(func(username string) (*repository.UserProfile, error) {
+			close(done)
+			return nil, errors.New("no rows")
+		})
+
+		handler := RequestPasswordReset(repo, make(channelNotifier), PasswordResetConfig{UserLimit: 1})
+		if rec := serveJSON(handler, "/api/password/reset", `{"login":"nobody"}`); rec.Code != http.StatusAccepted {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := serveJSON(handler, "/api/password/reset", `{"login":"nobody"}`); rec.Code != http.StatusTooManyRequests {
+			t.Errorf("status of the second request = %d, want %d", rec.Code, http.StatusTooManyRequests)
+		}
+		<-done
+	})
+
+	t.Run("empty login", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		repo := mocks.NewMockAuthRepository(ctrl)
+		rec := serveJSON(RequestPasswordReset(repo, make(channelNotifier), config), "/api/password/reset", `{}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestConfirmPasswordReset(t *testing.T) {
+	const newPassword = "Correct-Horse-42"
+	tokenHash := hashToken("reset-token")
+	valid := &repository.PasswordReset{TokenHash: tokenHash, Username: "alice", ExpiresAt: time.Now().Add(time.Hour)}
+	expired := &repository.PasswordReset{TokenHash: tokenHash, Username: "alice", ExpiresAt: time.Now().Add(-time.Minute)}
+
+	tests := []struct {
+		name       string
+		body       string
+		setup      func(repo *mocks.MockAuthRepository)
+		wantStatus int
+	}{
+		{
+			name: "password reset",
+			body: `{"token":"reset-token","new_password":"` + newPassword + `"}`,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetPasswordReset(tokenHash).Return(valid, nil)
+				repo.EXPECT().ConsumePasswordReset(tokenHash).Return(valid, nil)
+				repo.EXPECT().UpdatePassword("alice", gomock.Any()).DoAndReturn(func(username, hashedPassword string) error {
+					if bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(newPassword)) != nil {
+						t.Error("stored hash does not match the new password")
+					}
+					return nil
+				})
+				// Все токены и сессии пользователя отзываются.
+				repo.EXPECT().BumpTokenVersion("alice").Return(int64(2), nil)
+				repo.EXPECT().RevokeOtherSessions("alice", "").Return(nil)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name: "unknown token",
+			body: `{"token":"reset-token","new_password":"` + newPassword + `"}`,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetPasswordReset(tokenHash).Return(nil, repository.ErrResetNotFound)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "expired token",
+			body: `{"token":"reset-token","new_password":"` + newPassword + `"}`,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetPasswordReset(tokenHash).Return(expired, nil)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			// Неподходящий пароль не использует токен.
+			name: "weak password",
+			body: `{"token":"reset-token","new_password":"short"}`,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetPasswordReset(tokenHash).Return(valid, nil)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "token used concurrently",
+			body: `{"token":"reset-token","new_password":"` + newPassword + `"}`,
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetPasswordReset(tokenHash).Return(valid, nil)
+				repo.EXPECT().ConsumePasswordReset(tokenHash).Return(nil, repository.ErrResetNotFound)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "empty token",
+			body:       `{"new_password":"` + newPassword + `"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mocks.NewMockAuthRepository(ctrl)
+			if tt.setup != nil {
+				tt.setup(repo)
+			}
+
+			rec := serveJSON(ConfirmPasswordReset(repo, nil), "/api/password/reset/confirm", tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
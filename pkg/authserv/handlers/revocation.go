@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
+	log "github.com/SergeyIvanovDevelop/tss-tools/pkg/logger"
+)
+
+// RevokeToken - OAuth 2.0 revocation endpoint (RFC 7009). На любой корректный запрос отвечает 200,
+// в том числе для недействительного, уже отозванного или чужого токена (RFC 7009, 2.2).
+// Токены OAuth-клиентов может отозвать только аутентифицированный клиент-владелец,
+// токены пользователей - любой, кто их предъявил. token_type_hint принимается, но не нужен:
+// тип записан в самом токене.
+func RevokeToken(repo repository.AuthRepository, issuer *auth.Issuer) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "RevokeToken",
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		fncLogger.Debug("Start")
+		if err := r.ParseForm(); err != nil {
+			fncLogger.Error("Bad request:", err)
+			writeOAuthError(w, http.StatusBadRequest, oauthInvalidRequest, "Malformed request body")
+			return
+		}
+
+		var client *repository.OAuthClient
+		if _, _, basic := r.BasicAuth(); basic || r.PostForm.Get("client_id") != "" {
+			var err error
+			client, err = authenticateClient(r, repo)
+			if err != nil {
+				fncLogger.Error("Client authentication failed:", err)
+				writeInvalidClient(w, r)
+				return
+			}
+		}
+
+		token := r.PostForm.Get("token")
+		if token == "" {
+			writeOAuthError(w, http.StatusBadRequest, oauthInvalidRequest, "Missing token")
+			return
+		}
+
+		claims, err := issuer.ValidateToken(token)
+		if err != nil {
+			fncLogger.Debug("Invalid token, nothing to revoke:", err)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if claims.ClientID != "" && (client == nil || client.ID != claims.ClientID) {
+			fncLogger.Errorf("Token of client '%s' can only be revoked by its owner", claims.ClientID)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		if err := revokeToken(repo, issuer, token, claims); err != nil {
+			fncLogger.Error("Failed to revoke token:", err)
+			writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fncLogger.Debug("Finished")
+	}
+}
+
+// revokeToken удаляет opaque-токен из хранилища, а токен другого формата заносит в черный список:
+// сам opaque-токен нигде не хранится, только его хеш. Отзыв refresh-токена отзывает и его семейство,
+// то есть все access- и refresh-токены, полученные из того же входа.
+func revokeToken(repo repository.AuthRepository, issuer *auth.Issuer, token string, claims *auth.Claims) error {
+	if claims.TokenType == auth.TokenTypeRefresh && claims.FamilyID != "" {
+		if err := repo.RevokeTokenFamily(claims.FamilyID); err != nil {
+			return err
+		}
+	}
+	if opaque, err := issuer.RevokeOpaqueToken(token); opaque {
+		return err
+	}
+	return repo.AddToBlacklist(token, claims.ExpiresAt.Time)
+}
+
+// isTokenRevoked сообщает, отозван ли сам токен или его семейство.
+func isTokenRevoked(repo repository.AuthRepository, token string, claims *auth.Claims) bool {
+	if repo.IsInBlacklist(token) {
+		return true
+	}
+	return claims.FamilyID != "" && repo.IsTokenFamilyRevoked(claims.FamilyID)
+}
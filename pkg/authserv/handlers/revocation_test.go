@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository/mocks"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestRevokeToken(t *testing.T) {
+	issuer := newTestIssuer(t)
+	userTokens, err := issuer.GenerateToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientTokens, err := issuer.GenerateToken("alice", auth.WithClientID("billing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		form         url.Values
+		clientID     string
+		clientSecret string
+		setup        func(repo *mocks.MockAuthRepository)
+		wantStatus   int
+	}{
+		{
+			name: "access token",
+			form: url.Values{"token": {userTokens.AccessToken}},
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().AddToBlacklist(userTokens.AccessToken, userTokens.AccessClaims.ExpiresAt.Time).Return(nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "refresh token revokes the family",
+			form: url.Values{"token": {userTokens.RefreshToken}, "token_type_hint": {"refresh_token"}},
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().RevokeTokenFamily(userTokens.RefreshClaims.FamilyID).Return(nil)
+				repo.EXPECT().AddToBlacklist(userTokens.RefreshToken, userTokens.RefreshClaims.ExpiresAt.Time).Return(nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:         "client token by its owner",
+			form:         url.Values{"token": {clientTokens.AccessToken}},
+			clientID:     "billing",
+			clientSecret: "client secret",
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetClient("billing").Return(testClient(t), nil)
+				repo.EXPECT().AddToBlacklist(clientTokens.AccessToken, gomock.Any()).Return(nil)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			// Чужой токен не отзывается, но ответ не раскрывает это (RFC 7009, 2.2).
+			name:       "client token without authentication",
+			form:       url.Values{"token": {clientTokens.AccessToken}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid token",
+			form:       url.Values{"token": {"not-a-token"}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:         "wrong client secret",
+			form:         url.Values{"token": {clientTokens.AccessToken}},
+			clientID:     "billing",
+			clientSecret: "guess",
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().GetClient("billing").Return(testClient(t), nil)
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "missing token",
+			form:       url.Values{},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "repository failure",
+			form: url.Values{"token": {userTokens.AccessToken}},
+			setup: func(repo *mocks.MockAuthRepository) {
+				repo.EXPECT().AddToBlacklist(userTokens.AccessToken, gomock.Any()).Return(errors.New("db is down"))
+			},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mocks.NewMockAuthRepository(ctrl)
+			if tt.setup != nil {
+				tt.setup(repo)
+			}
+
+			rec := serveForm(RevokeToken(repo, issuer), "/oauth/revoke", tt.form, tt.clientID, tt.clientSecret)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRevokeOpaqueToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repo := mocks.NewMockAuthRepository(ctrl)
+	stored := make(map[string]auth.OpaqueToken)
+	repo.EXPECT().SaveOpaqueToken(gomock.Any()).Times(2).DoAndReturn(func(token auth.OpaqueToken) error {
+		stored[token.Hash] = token
+		return nil
+	})
+	issuer, err := auth.NewIssuer(auth.Config{
+		Secret:      auth.StaticSecret(bytes.Repeat([]byte("k"), 32)),
+		TokenFormat: auth.TokenFormatOpaque,
+		TokenStore:  repo,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := issuer.GenerateToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Отозванный opaque-токен удаляется из хранилища по хешу и не попадает в черный список.
+	hash := auth.HashOpaqueToken(tokens.AccessToken)
+	token := stored[hash]
+	repo.EXPECT().GetOpaqueToken(hash).Return(&token, nil)
+	repo.EXPECT().DeleteOpaqueToken(hash).Return(nil)
+
+	rec := serveForm(RevokeToken(repo, issuer), "/oauth/revoke", url.Values{"token": {tokens.AccessToken}}, "", "")
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/middleware"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
+	log "github.com/SergeyIvanovDevelop/tss-tools/pkg/logger"
+
+	"github.com/gorilla/mux"
+)
+
+// SessionResponse - сессия пользователя в ответе ListSessions. Current отмечает сессию,
+// которой принадлежит токен запроса.
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+// ListSessions возвращает активные сессии пользователя, которому выдан access-токен.
+// Обработчики сессий должны располагаться после middleware.JWTAuthentication.
+func ListSessions(repo repository.AuthRepository) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "ListSessions",
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		fncLogger.Debug("Start")
+		claims, ok := accountClaims(w, r)
+		if !ok {
+			return
+		}
+
+		sessions, err := repo.GetUserSessions(claims.Username)
+		if err != nil {
+			fncLogger.Errorf("Could not load sessions of user '%s': %v", claims.Username, err)
+			http.Error(w, "Could not load sessions", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]SessionResponse, 0, len(sessions))
+		for _, session := range sessions {
+			response = append(response, SessionResponse{
+				ID:         session.ID,
+				IP:         session.IP,
+				UserAgent:  session.UserAgent,
+				CreatedAt:  session.CreatedAt,
+				LastUsedAt: session.LastUsedAt,
+				Current:    session.ID == claims.FamilyID,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			fncLogger.Error("Error encoding json:", err)
+			return
+		}
+		fncLogger.Debug("Finished")
+	}
+}
+
+// RevokeSession завершает сессию {id} пользователя, в том числе текущую.
+func RevokeSession(repo repository.AuthRepository) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "RevokeSession",
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		fncLogger.Debug("Start")
+		claims, ok := accountClaims(w, r)
+		if !ok {
+			return
+		}
+
+		sessionID := mux.Vars(r)["id"]
+		err := repo.RevokeSession(claims.Username, sessionID)
+		if errors.Is(err, repository.ErrSessionNotFound) {
+			fncLogger.Errorf("User '%s' has no session '%s'", claims.Username, sessionID)
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			fncLogger.Error("Failed to revoke session:", err)
+			http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		fncLogger.Debug("Finished")
+	}
+}
+
+// RevokeOtherSessions завершает все сессии пользователя, кроме текущей.
+func RevokeOtherSessions(repo repository.AuthRepository) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "RevokeOtherSessions",
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		fncLogger.Debug("Start")
+		claims, ok := accountClaims(w, r)
+		if !ok {
+			return
+		}
+
+		if err := repo.RevokeOtherSessions(claims.Username, claims.FamilyID); err != nil {
+			fncLogger.Error("Failed to revoke sessions:", err)
+			http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		fncLogger.Debug("Finished")
+	}
+}
+
+// RevokeAllTokens ("выйти везде") увеличивает версию токенов пользователя, после чего все выпущенные
+// ему токены, включая токен запроса, перестают проходить проверку, и завершает все его сессии.
+func RevokeAllTokens(repo repository.AuthRepository) http.HandlerFunc {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "RevokeAllTokens",
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		fncLogger.Debug("Start")
+		claims, ok := accountClaims(w, r)
+		if !ok {
+			return
+		}
+
+		if _, err := repo.BumpTokenVersion(claims.Username); err != nil {
+			fncLogger.Errorf("Failed to bump token version of user '%s': %v", claims.Username, err)
+			http.Error(w, "Failed to revoke tokens", http.StatusInternalServerError)
+			return
+		}
+		// Токены уже недействительны; отзыв семейств нужен, чтобы сессии пропали из списка.
+		if err := repo.RevokeOtherSessions(claims.Username, ""); err != nil {
+			fncLogger.Error("Failed to revoke sessions:", err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		fncLogger.Debug("Finished")
+	}
+}
+
+// userClaims возвращает claims access-токена пользователя из контекста запроса.
+// Если токен выдан не пользователю, отвечает 401.
+func userClaims(w http.ResponseWriter, r *http.Request) (*auth.Claims, bool) {
+	claims, ok := middleware.ClaimsFromContext(r.Context())
+	if !ok || claims.Username == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	return claims, true
+}
+
+// accountClaims работает как userClaims, но принимает только токены, выданные самому
+// пользователю при входе: токены OAuth-клиентов, полученные обменом (с act) и API-ключи
+// управлять учетной записью не могут, какие бы разрешения им ни были выданы. Иначе утекший
+// ключ или токен можно было бы обменять на новый или закрепить доступ к учетной записи.
+func accountClaims(w http.ResponseWriter, r *http.Request) (*auth.Claims, bool) {
+	claims, ok := userClaims(w, r)
+	if !ok {
+		return nil, false
+	}
+	if claims.ClientID != "" || claims.Actor != nil || claims.TokenType == auth.TokenTypeAPIKey {
+		http.Error(w, "Account can only be managed with a first-party token", http.StatusForbidden)
+		return nil, false
+	}
+	return claims, true
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/middleware"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository/mocks"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+)
+
+// serveAuthenticated вызывает handler через маршрутизатор с шаблоном pattern
+// и middleware.JWTAuthentication, передавая token в заголовке Authorization.
+func serveAuthenticated(issuer *auth.Issuer, handler http.HandlerFunc, method, pattern, target, token string) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	router.Handle(pattern, middleware.JWTAuthentication(issuer)(handler)).Methods(method)
+	request := httptest.NewRequest(method, target, nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, request)
+	return rec
+}
+
+func TestListSessions(t *testing.T) {
+	issuer := newTestIssuer(t)
+	tokens, err := issuer.GenerateToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+
+	ctrl := gomock.NewController(t)
+	repo := mocks.NewMockAuthRepository(ctrl)
+	repo.EXPECT().GetUserSessions("alice").Return([]repository.Session{
+		{ID: tokens.AccessClaims.FamilyID, Username: "alice", IP: "192.0.2.1", UserAgent: "curl", CreatedAt: now, LastUsedAt: now},
+		{ID: "other", Username: "alice", IP: "198.51.100.7", UserAgent: "Firefox", CreatedAt: now, LastUsedAt: now},
+	}, nil)
+
+	rec := serveAuthenticated(issuer, ListSessions(repo), http.MethodGet, "/api/user/sessions", "/api/user/sessions", tokens.AccessToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var sessions []SessionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&sessions); err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || !sessions[0].Current || sessions[1].Current {
+		t.Fatalf("sessions = %+v, want the first one current", sessions)
+	}
+	if sessions[1].IP != "198.51.100.7" || sessions[1].UserAgent != "Firefox" || !sessions[1].LastUsedAt.Equal(now) {
+		t.Errorf("session = %+v", sessions[1])
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	issuer := newTestIssuer(t)
+	tokens, err := issuer.GenerateToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"revoked", nil, http.StatusNoContent},
+		{"not found", repository.ErrSessionNotFound, http.StatusNotFound},
+		{"repository failure", errors.New("db is down"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mocks.NewMockAuthRepository(ctrl)
+			repo.EXPECT().RevokeSession("alice", "session-1").Return(tt.err)
+
+			rec := serveAuthenticated(issuer, RevokeSession(repo), http.MethodDelete,
+				"/api/user/sessions/{id}", "/api/user/sessions/session-1", tokens.AccessToken)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	issuer := newTestIssuer(t)
+	tokens, err := issuer.GenerateToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctrl := gomock.NewController(t)
+	repo := mocks.NewMockAuthRepository(ctrl)
+	repo.EXPECT().RevokeOtherSessions("alice", tokens.AccessClaims.FamilyID).Return(nil)
+
+	rec := serveAuthenticated(issuer, RevokeOtherSessions(repo), http.MethodDelete,
+		"/api/user/sessions", "/api/user/sessions", tokens.AccessToken)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Токен OAuth-клиента не принадлежит пользователю и не имеет сессий.
+	clientToken, _, err := issuer.GenerateAccessToken("billing", auth.WithClientID("billing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = serveAuthenticated(issuer, RevokeOtherSessions(repo), http.MethodDelete,
+		"/api/user/sessions", "/api/user/sessions", clientToken)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status for client token = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestRevokeAllTokens(t *testing.T) {
+	issuer := newTestIssuer(t)
+	tokens, err := issuer.GenerateToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		bumpErr    error
+		wantStatus int
+	}{
+		{"revoked", nil, http.StatusNoContent},
+		{"repository failure", errors.New("db is down"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mocks.NewMockAuthRepository(ctrl)
+			repo.EXPECT().BumpTokenVersion("alice").Return(int64(2), tt.bumpErr)
+			if tt.bumpErr == nil {
+				// Завершаются все сессии, включая текущую.
+				repo.EXPECT().RevokeOtherSessions("alice", "").Return(nil)
+			}
+
+			rec := serveAuthenticated(issuer, RevokeAllTokens(repo), http.MethodPost,
+				"/api/user/logout-all", "/api/user/logout-all", tokens.AccessToken)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/SergeyIvanovDevelop/tss-tools/pkg/logger"
+)
+
+// RequireScopes пропускает дальше только запросы, токен которых содержит все разрешения scopes.
+// Должен располагаться после JWTAuthentication.
+func RequireScopes(scopes ...string) func(http.Handler) http.Handler {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "RequireScopes",
+	})
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				fncLogger.Error("No token claims in request context")
+				unauthorized(w, nil)
+				return
+			}
+
+			for _, scope := range scopes {
+				if !claims.HasScope(scope) {
+					fncLogger.Errorf("User '%s' has no scope '%s'", claims.Subject, scope)
+					w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, strings.Join(scopes, " ")))
+					http.Error(w, fmt.Sprintf("Forbidden: missing scope '%s'", scope), http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRoles пропускает дальше только запросы, токен которых содержит хотя бы одну из ролей roles.
+// Должен располагаться после JWTAuthentication.
+func RequireRoles(roles ...string) func(http.Handler) http.Handler {
+	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
+		"func": "RequireRoles",
+	})
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				fncLogger.Error("No token claims in request context")
+				unauthorized(w, nil)
+				return
+			}
+
+			for _, role := range roles {
+				if claims.HasRole(role) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			fncLogger.Errorf("User '%s' has none of roles %v", claims.Subject, roles)
+			http.Error(w, fmt.Sprintf("Forbidden: one of roles '%s' is required", strings.Join(roles, "', '")), http.StatusForbidden)
+		})
+	}
+}
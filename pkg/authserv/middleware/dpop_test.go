@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// dpopKey - ключ клиента DPoP и thumbprint его открытой части.
+type dpopKey struct {
+	private *ecdsa.PrivateKey
+	jwk     map[string]interface{}
+	jkt     string
+}
+
+func newDPoPKey(t *testing.T) *dpopKey {
+	t.Helper()
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := auth.NewJWK("", "", &private.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jkt, err := public.Thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(auth.JWK{KeyType: public.KeyType, Curve: public.Curve, X: public.X, Y: public.Y})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jwk map[string]interface{}
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		t.Fatal(err)
+	}
+	return &dpopKey{private: private, jwk: jwk, jkt: jkt}
+}
+
+// proof возвращает DPoP proof для GET-запроса к корню httptest-сервера с access-токеном accessToken.
+func (k *dpopKey) proof(t *testing.T, accessToken string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"jti": uuid.NewString(),
+		"htm": http.MethodGet,
+		"htu": "http://example.com/",
+		"iat": time.Now().Unix(),
+		"ath": auth.AccessTokenHash(accessToken),
+	})
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = k.jwk
+	proof, err := token.SignedString(k.private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
+
+func TestJWTAuthenticationDPoP(t *testing.T) {
+	issuer := newTestIssuer(t)
+	key := newDPoPKey(t)
+	other := newDPoPKey(t)
+	bound, err := issuer.GenerateToken("alice", auth.WithDPoPKey(key.jkt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bearer, err := issuer.GenerateToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed := key.proof(t, bound.AccessToken)
+
+	tests := []struct {
+		name       string
+		policy     DPoPPolicy
+		scheme     string
+		token      string
+		proof      string
+		wantStatus int
+		wantError  string
+	}{
+		{"bound token with proof", DPoPOptional, "DPoP", bound.AccessToken, replayed, http.StatusOK, ""},
+		{"replayed proof", DPoPOptional, "DPoP", bound.AccessToken, replayed, http.StatusUnauthorized, "invalid_dpop_proof"},
+		{"bound token without proof", DPoPOptional, "DPoP", bound.AccessToken, "", http.StatusUnauthorized, "invalid_dpop_proof"},
+		{"bound token as bearer", DPoPOptional, "Bearer", bound.AccessToken, "", http.StatusUnauthorized, "invalid_token"},
+		{"proof of other key", DPoPOptional, "DPoP", bound.AccessToken, other.proof(t, bound.AccessToken), http.StatusUnauthorized, "invalid_token"},
+		{"proof for other token", DPoPOptional, "DPoP", bound.AccessToken, key.proof(t, bearer.AccessToken), http.StatusUnauthorized, "invalid_dpop_proof"},
+		{"bearer token", DPoPOptional, "Bearer", bearer.AccessToken, "", http.StatusOK, ""},
+		{"bearer token as dpop", DPoPOptional, "DPoP", bearer.AccessToken, key.proof(t, bearer.AccessToken), http.StatusUnauthorized, "invalid_token"},
+		{"bearer token when dpop is required", DPoPRequired, "Bearer", bearer.AccessToken, "", http.StatusUnauthorized, "invalid_dpop_proof"},
+	}
+	// Один verifier на все случаи, чтобы кэш повторов сохранялся между запросами.
+	verifier := auth.NewDPoPVerifier(auth.NewMemoryReplayCache())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := JWTAuthentication(issuer, WithDPoP(tt.policy, verifier))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.Header.Set("Authorization", tt.scheme+" "+tt.token)
+			if tt.proof != "" {
+				request.Header.Set(auth.DPoPHeader, tt.proof)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, request)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantError == "" {
+				return
+			}
+			header := rec.Header().Get("WWW-Authenticate")
+			if !strings.HasPrefix(header, "DPoP ") || !strings.Contains(header, `error="`+tt.wantError+`"`) {
+				t.Errorf("WWW-Authenticate = %q, want DPoP error %q", header, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestRequestURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		proto  string
+		want   string
+	}{
+		{"plain http", "http://auth.example.com/userinfo", "", "http://auth.example.com/userinfo"},
+		{"query is dropped", "http://auth.example.com/userinfo?x=1", "", "http://auth.example.com/userinfo"},
+		{"forwarded https", "http://auth.example.com/userinfo", "https", "https://auth.example.com/userinfo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.proto != "" {
+				request.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if got := RequestURL(request); got != tt.want {
+				t.Errorf("RequestURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,8 +1,12 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
 	log "github.com/SergeyIvanovDevelop/tss-tools/pkg/logger"
@@ -12,26 +16,217 @@ var pkgLog log.Log
 
 const pkgName string = "tss-tools/pkg/authserv/middleware"
 
-func JWTAuthentication(next http.Handler) http.Handler {
+type contextKey string
+
+const claimsKey = contextKey("claims")
+
+// Blacklist - хранилище отозванных токенов, например repository.AuthRepository.
+type Blacklist interface {
+	IsInBlacklist(token string) bool
+}
+
+// TokenFamilies сообщает об отзыве семейств токенов, например repository.AuthRepository.
+type TokenFamilies interface {
+	IsTokenFamilyRevoked(familyID string) bool
+}
+
+// DPoPPolicy определяет, принимает ли JWTAuthentication токены, не привязанные к ключу DPoP.
+// Привязанные токены (с claim cnf.jkt) принимаются только с действительным DPoP proof при любой политике.
+type DPoPPolicy int
+
+const (
+	// DPoPOptional принимает и Bearer-, и DPoP-токены.
+	DPoPOptional DPoPPolicy = iota
+	// DPoPRequired принимает только токены, привязанные к ключу DPoP.
+	DPoPRequired
+)
+
+// Option задает дополнительные проверки JWTAuthentication.
+type Option func(*options)
+
+type options struct {
+	blacklist  Blacklist
+	families   TokenFamilies
+	dpopPolicy DPoPPolicy
+	dpop       *auth.DPoPVerifier
+	apiKeys    auth.APIKeyStore
+}
+
+// WithBlacklist отклоняет токены, находящиеся в черном списке blacklist.
+func WithBlacklist(blacklist Blacklist) Option {
+	return func(o *options) {
+		o.blacklist = blacklist
+	}
+}
+
+// WithTokenFamilies отклоняет токены, семейство которых отозвано в families
+// (например, после отзыва refresh-токена, из которого они получены).
+func WithTokenFamilies(families TokenFamilies) Option {
+	return func(o *options) {
+		o.families = families
+	}
+}
+
+// WithDPoP задает политику DPoP и проверку proof. При verifier == nil используется
+// auth.DPoPVerifier с кэшем повторов в памяти.
+func WithDPoP(policy DPoPPolicy, verifier *auth.DPoPVerifier) Option {
+	return func(o *options) {
+		o.dpopPolicy = policy
+		o.dpop = verifier
+	}
+}
+
+// WithAPIKeys разрешает аутентификацию по схеме ApiKey ключами из store. Claims такого запроса
+// имеют token_type auth.TokenTypeAPIKey и разрешения ключа.
+func WithAPIKeys(store auth.APIKeyStore) Option {
+	return func(o *options) {
+		o.apiKeys = store
+	}
+}
+
+// ClaimsFromContext возвращает claims токена, проверенного JWTAuthentication.
+func ClaimsFromContext(ctx context.Context) (*auth.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey).(*auth.Claims)
+	return claims, ok
+}
+
+// JWTAuthentication пропускает дальше только запросы с access-токеном, который принимает validator.
+// Токен предъявляется по схеме Bearer или, если привязан к ключу клиента, DPoP (см. WithDPoP).
+// С WithAPIKeys вместо токена принимается API-ключ по схеме ApiKey.
+// Claims проверенного токена доступны обработчикам через ClaimsFromContext.
+func JWTAuthentication(validator auth.Validator, opts ...Option) func(http.Handler) http.Handler {
 	fncLogger := log.AddLoggerFields(pkgLog, pkgName, log.Fields{
 		"func": "JWTAuthentication",
 	})
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			fncLogger.Error("No header 'Authorization'")
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
+	config := &options{}
+	for _, opt := range opts {
+		opt(config)
+	}
+	if config.dpop == nil {
+		config.dpop = auth.NewDPoPVerifier(auth.NewMemoryReplayCache())
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				fncLogger.Error("No header 'Authorization'")
+				unauthorized(w, nil)
+				return
+			}
+
+			if key, ok := strings.CutPrefix(authHeader, "ApiKey "); ok && config.apiKeys != nil {
+				claims, err := auth.AuthenticateAPIKey(config.apiKeys, key, time.Now())
+				if err != nil {
+					fncLogger.Errorf("Not valid API key: %v", err)
+					unauthorized(w, err)
+					return
+				}
+				if config.dpopPolicy == DPoPRequired {
+					// API-ключ нельзя привязать к ключу DPoP.
+					fncLogger.Errorf("API key of user '%s' is not DPoP-bound", claims.Username)
+					dpopUnauthorized(w, auth.ErrDPoPBindingRequired)
+					return
+				}
+				ctx := context.WithValue(r.Context(), claimsKey, claims)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			token, dpopScheme := strings.CutPrefix(authHeader, "DPoP ")
+			if !dpopScheme {
+				token = strings.TrimPrefix(authHeader, "Bearer ")
+			}
+			claims, err := validator.ValidateToken(token, auth.WithTokenType(auth.TokenTypeAccess))
+			if err != nil {
+				fncLogger.Errorf("Not valid token '%s': %v", token, err)
+				unauthorized(w, err)
+				return
+			}
+
+			if config.blacklist != nil && config.blacklist.IsInBlacklist(token) {
+				fncLogger.Errorf("Token of user '%s' is revoked", claims.Subject)
+				unauthorized(w, auth.ErrTokenRevoked)
+				return
+			}
+			if config.families != nil && claims.FamilyID != "" && config.families.IsTokenFamilyRevoked(claims.FamilyID) {
+				fncLogger.Errorf("Token family '%s' of user '%s' is revoked", claims.FamilyID, claims.Subject)
+				unauthorized(w, auth.ErrTokenRevoked)
+				return
+			}
+
+			if err := config.checkDPoP(r, token, claims, dpopScheme); err != nil {
+				fncLogger.Errorf("DPoP check failed for '%s': %v", claims.Subject, err)
+				dpopUnauthorized(w, err)
+				return
+			}
 
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-		_, err := auth.ValidateToken(token)
-		if err != nil {
-			fncLogger.Errorf("Not valid token '%s'", token)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
+			ctx := context.WithValue(r.Context(), claimsKey, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// checkDPoP проверяет привязку токена к ключу DPoP (RFC 9449, 7.1). Привязанный токен должен
+// предъявляться по схеме DPoP с proof того же ключа; непривязанный - по схеме Bearer,
+// если политика это разрешает.
+func (o *options) checkDPoP(r *http.Request, token string, claims *auth.Claims, dpopScheme bool) error {
+	jkt := claims.DPoPKey()
+	if jkt == "" {
+		if dpopScheme {
+			return auth.ErrDPoPKeyMismatch
+		}
+		if o.dpopPolicy == DPoPRequired {
+			return auth.ErrDPoPBindingRequired
 		}
+		return nil
+	}
+	if !dpopScheme {
+		return auth.ErrDPoPKeyMismatch
+	}
+	proofJKT, err := o.dpop.Verify(r.Header.Get(auth.DPoPHeader), r.Method, RequestURL(r), token)
+	if err != nil {
+		return err
+	}
+	if proofJKT != jkt {
+		return auth.ErrDPoPKeyMismatch
+	}
+	return nil
+}
 
-		next.ServeHTTP(w, r)
-	})
+// RequestURL восстанавливает адрес запроса для сравнения с htu в DPoP proof.
+// Схема определяется по TLS-соединению или заголовку X-Forwarded-Proto.
+func RequestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host + r.URL.EscapedPath()
+}
+
+// dpopUnauthorized отвечает 401 с заголовком WWW-Authenticate схемы DPoP (RFC 9449, 7.1).
+func dpopUnauthorized(w http.ResponseWriter, err error) {
+	code := "invalid_token"
+	if errors.Is(err, auth.ErrInvalidDPoPProof) {
+		code = "invalid_dpop_proof"
+	}
+	description := auth.DPoPErrorDescription(err)
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`DPoP error=%q, error_description=%q, algs=%q`,
+		code, description, strings.Join(auth.DPoPAlgorithms, " ")))
+	http.Error(w, description, http.StatusUnauthorized)
+}
+
+// unauthorized отвечает 401 с заголовком WWW-Authenticate (RFC 6750) и причиной отказа
+// без подробностей, которые могут раскрыть устройство сервера (см. auth.ErrorDescription).
+func unauthorized(w http.ResponseWriter, err error) {
+	if !errors.Is(err, auth.ErrInvalidToken) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	description := auth.ErrorDescription(err)
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="invalid_token", error_description=%q`, description))
+	http.Error(w, description, http.StatusUnauthorized)
 }
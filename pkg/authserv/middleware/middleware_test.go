@@ -0,0 +1,293 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	log "github.com/SergeyIvanovDevelop/tss-tools/pkg/logger"
+)
+
+func TestMain(m *testing.M) {
+	log.Initialize(os.Stderr, "error")
+	os.Exit(m.Run())
+}
+
+func newTestIssuer(t *testing.T) *auth.Issuer {
+	t.Helper()
+	issuer, err := auth.NewIssuer(auth.Config{
+		Secret:     auth.StaticSecret(bytes.Repeat([]byte("k"), 32)),
+		RoleScopes: map[string][]string{"admin": {"users:write"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issuer
+}
+
+// serve пропускает GET-запрос с токеном token через цепочку middlewares.
+func serve(token string, middlewares ...func(http.Handler) http.Handler) *httptest.ResponseRecorder {
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, request)
+	return rec
+}
+
+func TestJWTAuthentication(t *testing.T) {
+	issuer := newTestIssuer(t)
+	pair, err := issuer.GenerateToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+		wantHeader string
+	}{
+		{"access token", pair.AccessToken, http.StatusOK, ""},
+		{"refresh token", pair.RefreshToken, http.StatusUnauthorized, `Bearer error="invalid_token"`},
+		{"malformed token", "not-a-token", http.StatusUnauthorized, `Bearer error="invalid_token"`},
+		{"no header", "", http.StatusUnauthorized, "Bearer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(tt.token, JWTAuthentication(issuer))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if header := rec.Header().Get("WWW-Authenticate"); !strings.HasPrefix(header, tt.wantHeader) {
+				t.Errorf("WWW-Authenticate = %q, want prefix %q", header, tt.wantHeader)
+			}
+		})
+	}
+}
+
+func TestRequireScopes(t *testing.T) {
+	issuer := newTestIssuer(t)
+	token := func(options ...auth.TokenOption) string {
+		pair, err := issuer.GenerateToken("alice", options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pair.AccessToken
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		scopes     []string
+		wantStatus int
+	}{
+		{"has scope", token(auth.WithScopes("users:read")), []string{"users:read"}, http.StatusOK},
+		{"scope from role", token(auth.WithRoles("admin")), []string{"users:write"}, http.StatusOK},
+		{"all scopes required", token(auth.WithScopes("users:read")), []string{"users:read", "users:write"}, http.StatusForbidden},
+		{"no scopes", token(), []string{"users:read"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(tt.token, JWTAuthentication(issuer), RequireScopes(tt.scopes...))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusForbidden {
+				if header := rec.Header().Get("WWW-Authenticate"); !strings.Contains(header, `error="insufficient_scope"`) {
+					t.Errorf("WWW-Authenticate = %q, want insufficient_scope", header)
+				}
+			}
+		})
+	}
+
+	t.Run("without authentication", func(t *testing.T) {
+		if rec := serve("", RequireScopes("users:read")); rec.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+		}
+	})
+}
+
+func TestRequireRoles(t *testing.T) {
+	issuer := newTestIssuer(t)
+	token := func(roles ...string) string {
+		pair, err := issuer.GenerateToken("alice", auth.WithRoles(roles...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pair.AccessToken
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		roles      []string
+		wantStatus int
+	}{
+		{"has role", token("admin"), []string{"admin"}, http.StatusOK},
+		{"one of roles", token("editor"), []string{"admin", "editor"}, http.StatusOK},
+		{"other role", token("editor"), []string{"admin"}, http.StatusForbidden},
+		{"no roles", token(), []string{"admin"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(tt.token, JWTAuthentication(issuer), RequireRoles(tt.roles...))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// blacklist - Blacklist в памяти.
+type blacklist map[string]bool
+
+func (b blacklist) IsInBlacklist(token string) bool {
+	return b[token]
+}
+
+func TestJWTAuthenticationContext(t *testing.T) {
+	issuer := newTestIssuer(t)
+	revoked, err := issuer.GenerateToken("mallory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := issuer.GenerateToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticate := JWTAuthentication(issuer, WithBlacklist(blacklist{revoked.AccessToken: true}))
+
+	var subject string
+	handler := authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFromContext(r.Context())
+		if !ok {
+			t.Fatal("no claims in request context")
+		}
+		subject = claims.Subject
+	}))
+
+	tests := []struct {
+		name        string
+		token       string
+		wantStatus  int
+		wantSubject string
+	}{
+		{"valid token", valid.AccessToken, http.StatusOK, "alice"},
+		{"blacklisted token", revoked.AccessToken, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject = ""
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, request)
+			if rec.Code != tt.wantStatus || subject != tt.wantSubject {
+				t.Errorf("status = %d, subject = %q, want %d and %q", rec.Code, subject, tt.wantStatus, tt.wantSubject)
+			}
+		})
+	}
+
+	if _, ok := ClaimsFromContext(httptest.NewRequest(http.MethodGet, "/", nil).Context()); ok {
+		t.Error("ClaimsFromContext found claims in an unauthenticated request")
+	}
+}
+
+// families - TokenFamilies в памяти, содержит отозванные семейства.
+type families map[string]bool
+
+func (f families) IsTokenFamilyRevoked(familyID string) bool {
+	return f[familyID]
+}
+
+func TestJWTAuthenticationTokenFamilies(t *testing.T) {
+	issuer := newTestIssuer(t)
+	revoked, err := issuer.GenerateToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := issuer.GenerateToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticate := JWTAuthentication(issuer, WithTokenFamilies(families{revoked.AccessClaims.FamilyID: true}))
+
+	if rec := serve(valid.AccessToken, authenticate); rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	rec := serve(revoked.AccessToken, authenticate)
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Header().Get("WWW-Authenticate"), `error="invalid_token"`) {
+		t.Errorf("status = %d, WWW-Authenticate = %q, want 401 invalid_token", rec.Code, rec.Header().Get("WWW-Authenticate"))
+	}
+}
+
+// apiKeys - auth.APIKeyStore в памяти; версия токенов всех пользователей равна 1.
+type apiKeys map[string]auth.APIKey
+
+func (k apiKeys) GetAPIKey(hash string) (*auth.APIKey, error) {
+	key, ok := k[hash]
+	if !ok {
+		return nil, auth.ErrAPIKeyNotFound
+	}
+	return &key, nil
+}
+
+func (k apiKeys) GetTokenVersion(username string) (int64, error) {
+	return 1, nil
+}
+
+func TestJWTAuthenticationAPIKeys(t *testing.T) {
+	issuer := newTestIssuer(t)
+	key, apiKey, err := auth.GenerateAPIKey("key-1", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiKey.TokenVersion = 1
+	oldKey, old, err := auth.GenerateAPIKey("key-2", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := apiKeys{apiKey.Hash: *apiKey, old.Hash: *old}
+
+	tests := []struct {
+		name       string
+		key        string
+		opts       []Option
+		wantStatus int
+	}{
+		{"valid key", key, []Option{WithAPIKeys(store)}, http.StatusOK},
+		{"key of previous token version", oldKey, []Option{WithAPIKeys(store)}, http.StatusUnauthorized},
+		{"api keys disabled", key, nil, http.StatusUnauthorized},
+		// API-ключ нельзя привязать к ключу DPoP.
+		{"dpop required", key, []Option{WithAPIKeys(store), WithDPoP(DPoPRequired, nil)}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := JWTAuthentication(issuer, tt.opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if claims, ok := ClaimsFromContext(r.Context()); !ok || claims.TokenType != auth.TokenTypeAPIKey {
+					t.Errorf("claims = %+v, want API key claims", claims)
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.Header.Set("Authorization", "ApiKey "+tt.key)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, request)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidHeader возвращается SMTPNotifier, если адрес или тема содержат перевод строки.
+var ErrInvalidHeader = errors.New("message header contains a line break")
+
+// Message - уведомление пользователю. To - адрес получателя.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier доставляет уведомления пользователям, например письма со ссылкой сброса пароля.
+type Notifier interface {
+	Notify(message Message) error
+}
+
+// SMTPNotifier отправляет уведомления письмами через SMTP-сервер Addr (host:port).
+// Auth может быть nil, если сервер не требует аутентификации.
+type SMTPNotifier struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+// NewSMTPNotifier создает SMTPNotifier с PLAIN-аутентификацией, если задан username.
+func NewSMTPNotifier(addr, from, username, password string) *SMTPNotifier {
+	notifier := &SMTPNotifier{Addr: addr, From: from}
+	if username != "" {
+		host, _, _ := strings.Cut(addr, ":")
+		notifier.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return notifier
+}
+
+func (n *SMTPNotifier) Notify(message Message) error {
+	if strings.ContainsAny(message.To, "\r\n") || strings.ContainsAny(message.Subject, "\r\n") {
+		return ErrInvalidHeader
+	}
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", n.From)
+	fmt.Fprintf(&body, "To: %s\r\n", message.To)
+	fmt.Fprintf(&body, "Subject: %s\r\n", message.Subject)
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	body.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+	return smtp.SendMail(n.Addr, n.Auth, n.From, []string{message.To}, []byte(body.String()))
+}
+
+// WriterNotifier записывает уведомления в W вместо доставки. Предназначен для разработки и тестов.
+type WriterNotifier struct {
+	mu sync.Mutex
+	W  io.Writer
+}
+
+// NewStdoutNotifier создает WriterNotifier, который печатает уведомления в stdout.
+func NewStdoutNotifier() *WriterNotifier {
+	return &WriterNotifier{W: os.Stdout}
+}
+
+// NewFileNotifier создает WriterNotifier, который дописывает уведомления в файл path.
+func NewFileNotifier(path string) (*WriterNotifier, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterNotifier{W: file}, nil
+}
+
+func (n *WriterNotifier) Notify(message Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, err := fmt.Fprintf(n.W, "To: %s\nSubject: %s\n\n%s\n\n", message.To, message.Subject, message.Body)
+	return err
+}
@@ -0,0 +1,32 @@
+package notify
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWriterNotifier(t *testing.T) {
+	var out strings.Builder
+	notifier := &WriterNotifier{W: &out}
+	if err := notifier.Notify(Message{To: "alice@example.com", Subject: "Password reset", Body: "Reset token: abc"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "To: alice@example.com\nSubject: Password reset\n\nReset token: abc\n\n"
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestSMTPNotifierHeaderInjection(t *testing.T) {
+	// Адрес сервера недоступен: проверка заголовков выполняется до подключения.
+	notifier := NewSMTPNotifier("127.0.0.1:0", "auth@example.com", "", "")
+	for _, message := range []Message{
+		{To: "alice@example.com\r\nBcc: mallory@example.com", Subject: "Password reset"},
+		{To: "alice@example.com", Subject: "Password reset\nBcc: mallory@example.com"},
+	} {
+		if err := notifier.Notify(message); !errors.Is(err, ErrInvalidHeader) {
+			t.Errorf("Notify(%q, %q) err = %v, want %v", message.To, message.Subject, err, ErrInvalidHeader)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// rangePrefixLength - длина префикса SHA-1 хеша, по которому запрашивается диапазон (k-anonymity).
+const rangePrefixLength = 5
+
+// BreachChecker сообщает, встречался ли пароль в утечках.
+type BreachChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// RangeSource возвращает диапазон хешей утекших паролей для префикса SHA-1 хеша из 5 символов
+// в верхнем регистре в формате Have I Been Pwned: строки "SUFFIX:COUNT", где SUFFIX -
+// остальные 35 символов хеша. Пароль целиком в источник не передается.
+type RangeSource interface {
+	Range(prefix string) (io.ReadCloser, error)
+}
+
+// RangeDir - локальный набор диапазонов: файлы <PREFIX>.txt в каталоге, например загруженные
+// PwnedPasswordsDownloader. Отсутствие файла означает пустой диапазон.
+type RangeDir string
+
+func (d RangeDir) Range(prefix string) (io.ReadCloser, error) {
+	file, err := os.Open(filepath.Join(string(d), prefix+".txt"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	return file, err
+}
+
+// BreachedPasswords проверяет пароли по RangeSource. Пароль считается утекшим, если встречался
+// не меньше MinCount раз (0 и 1 - хотя бы один раз).
+type BreachedPasswords struct {
+	Source   RangeSource
+	MinCount int
+}
+
+// NewBreachedPasswords создает BreachChecker по локальному набору диапазонов в каталоге dir.
+func NewBreachedPasswords(dir string) *BreachedPasswords {
+	return &BreachedPasswords{Source: RangeDir(dir)}
+}
+
+func (b *BreachedPasswords) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:rangePrefixLength], hash[rangePrefixLength:]
+
+	hashes, err := b.Source.Range(prefix)
+	if err != nil {
+		return false, err
+	}
+	defer hashes.Close()
+
+	scanner := bufio.NewScanner(hashes)
+	for scanner.Scan() {
+		candidate, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !strings.EqualFold(candidate, suffix) {
+			continue
+		}
+		if b.MinCount <= 1 {
+			return true, nil
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return false, err
+		}
+		return n >= b.MinCount, nil
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,101 @@
+package password
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// SHA-1 хеш "password": 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8.
+const (
+	passwordHashPrefix = "5BAA6"
+	passwordHashSuffix = "1E4C9B93F3F0682250B6CF8331B7EE68FD8"
+)
+
+// stubRangeSource отдает диапазоны из памяти и запоминает запрошенные префиксы.
+type stubRangeSource struct {
+	ranges   map[string]string
+	err      error
+	prefixes []string
+}
+
+func (s *stubRangeSource) Range(prefix string) (io.ReadCloser, error) {
+	s.prefixes = append(s.prefixes, prefix)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return io.NopCloser(strings.NewReader(s.ranges[prefix])), nil
+}
+
+func TestBreachedPasswords(t *testing.T) {
+	sourceErr := errors.New("source is unavailable")
+
+	tests := []struct {
+		name     string
+		hashes   string
+		err      error
+		minCount int
+		password string
+		want     bool
+		wantErr  bool
+	}{
+		{"found", "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n" + passwordHashSuffix + ":3861493\r\n", nil, 0, "password", true, false},
+		{"lowercase suffix", strings.ToLower(passwordHashSuffix) + ":1\n", nil, 0, "password", true, false},
+		{"not found", "0018A45C4D1DEF81644B54AB7F969B88D65:1\n", nil, 0, "password", false, false},
+		{"empty range", "", nil, 0, "password", false, false},
+		{"other prefix", passwordHashSuffix + ":10\n", nil, 0, "Password", false, false},
+		{"count at min count", passwordHashSuffix + ":10\n", nil, 10, "password", true, false},
+		{"count below min count", passwordHashSuffix + ":9\n", nil, 10, "password", false, false},
+		{"invalid count", passwordHashSuffix + ":many\n", nil, 10, "password", false, true},
+		{"source error", "", sourceErr, 0, "password", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &stubRangeSource{ranges: map[string]string{passwordHashPrefix: tt.hashes}, err: tt.err}
+			checker := &BreachedPasswords{Source: source, MinCount: tt.minCount}
+
+			got, err := checker.IsBreached(tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("IsBreached err = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("IsBreached = %v, want %v", got, tt.want)
+			}
+			// В источник уходит только префикс хеша.
+			for _, prefix := range source.prefixes {
+				if len(prefix) != rangePrefixLength || prefix != strings.ToUpper(prefix) {
+					t.Errorf("requested range %q, want an uppercase %d-character prefix", prefix, rangePrefixLength)
+				}
+			}
+		})
+	}
+}
+
+func TestRangeDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, passwordHashPrefix+".txt"), []byte(passwordHashSuffix+":2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	checker := NewBreachedPasswords(dir)
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"password", true},
+		// Диапазона нет в каталоге: он считается пустым.
+		{"correct horse battery staple", false},
+	}
+	for _, tt := range tests {
+		got, err := checker.IsBreached(tt.password)
+		if err != nil {
+			t.Fatalf("IsBreached(%q): %v", tt.password, err)
+		}
+		if got != tt.want {
+			t.Errorf("IsBreached(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+}
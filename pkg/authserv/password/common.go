@@ -0,0 +1,43 @@
+package password
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// defaultCommonPasswords - самые распространенные пароли, не короче 8 символов.
+// Полный список загружается через LoadCommonPasswords.
+var defaultCommonPasswords = []string{
+	"12345678", "123456789", "1234567890", "password", "password1", "password123",
+	"qwerty123", "qwertyuiop", "11111111", "00000000", "iloveyou", "sunshine",
+	"princess", "football", "baseball", "welcome1", "abc12345", "1q2w3e4r",
+	"1qaz2wsx", "qwerty12", "superman", "trustno1", "letmein1", "passw0rd",
+	"zaq12wsx", "q1w2e3r4", "87654321", "12341234", "asdfghjkl", "starwars",
+}
+
+// DefaultCommonPasswords возвращает встроенный короткий список распространенных паролей.
+func DefaultCommonPasswords() map[string]struct{} {
+	common := make(map[string]struct{}, len(defaultCommonPasswords))
+	for _, password := range defaultCommonPasswords {
+		common[password] = struct{}{}
+	}
+	return common
+}
+
+// LoadCommonPasswords читает список распространенных паролей, по одному в строке, для Policy.Common.
+// Пустые строки пропускаются, регистр не учитывается.
+func LoadCommonPasswords(r io.Reader) (map[string]struct{}, error) {
+	common := make(map[string]struct{})
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		password := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if password != "" {
+			common[password] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return common, nil
+}
@@ -0,0 +1,153 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxBcryptLength - максимальная длина пароля в байтах, которую учитывает bcrypt.
+// Более длинные пароли bcrypt отклоняет или, в других реализациях, молча обрезает.
+const MaxBcryptLength = 72
+
+// Правила политики паролей в Violation.Rule.
+const (
+	RuleMinLength = "min_length"
+	RuleMaxLength = "max_length"
+	RuleLowercase = "lowercase"
+	RuleUppercase = "uppercase"
+	RuleDigit     = "digit"
+	RuleSymbol    = "symbol"
+	RuleUsername  = "username"
+	RuleCommon    = "common"
+	RuleBreached  = "breached"
+)
+
+// minUsernameLength - имена короче этого не ищутся внутри пароля, иначе отклонялись бы
+// случайные совпадения.
+const minUsernameLength = 3
+
+// Violation - нарушенное правило политики.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PolicyError возвращается Policy.Validate и перечисляет все нарушенные правила.
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		messages = append(messages, violation.Message)
+	}
+	return "password does not satisfy policy: " + strings.Join(messages, "; ")
+}
+
+// Policy - политика паролей. Нулевые значения отключают соответствующие правила,
+// кроме MaxLength: пароль никогда не может быть длиннее MaxBcryptLength байт.
+type Policy struct {
+	// MinLength - минимальная длина в символах.
+	MinLength int
+	// MaxLength - максимальная длина в байтах, не больше MaxBcryptLength.
+	MaxLength    int
+	RequireLower bool
+	RequireUpper bool
+	RequireDigit bool
+	// RequireSymbol требует знак препинания или символ Unicode (категории P и S).
+	RequireSymbol  bool
+	RejectUsername bool
+	// Common - распространенные пароли в нижнем регистре, см. LoadCommonPasswords.
+	Common map[string]struct{}
+	// Breached проверяет пароль по базе утекших паролей.
+	Breached BreachChecker
+}
+
+// DefaultPolicy возвращает политику по умолчанию: от 8 символов, без требований к классам
+// символов (NIST SP 800-63B, 5.1.1.2), с запретом имени пользователя и распространенных паролей.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		MinLength:      8,
+		MaxLength:      MaxBcryptLength,
+		RejectUsername: true,
+		Common:         DefaultCommonPasswords(),
+	}
+}
+
+// Validate проверяет пароль password пользователя username. Если нарушено хотя бы одно правило,
+// возвращается *PolicyError со всеми нарушениями. Другие ошибки означают, что проверку
+// по базе утекших паролей выполнить не удалось.
+func (p *Policy) Validate(username, password string) error {
+	var violations []Violation
+	fail := func(rule, format string, args ...interface{}) {
+		violations = append(violations, Violation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if p.MinLength > 0 && utf8.RuneCountInString(password) < p.MinLength {
+		fail(RuleMinLength, "must be at least %d characters long", p.MinLength)
+	}
+	if maxLength := p.maxLength(); len(password) > maxLength {
+		fail(RuleMaxLength, "must be at most %d bytes long", maxLength)
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsLetter(r):
+			// Буквы без регистра (например, иероглифы) не считаются ни строчными, ни символами.
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+	if p.RequireLower && !lower {
+		fail(RuleLowercase, "must contain a lowercase letter")
+	}
+	if p.RequireUpper && !upper {
+		fail(RuleUppercase, "must contain an uppercase letter")
+	}
+	if p.RequireDigit && !digit {
+		fail(RuleDigit, "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		fail(RuleSymbol, "must contain a symbol")
+	}
+
+	normalized := strings.ToLower(password)
+	if p.RejectUsername && utf8.RuneCountInString(username) >= minUsernameLength &&
+		strings.Contains(normalized, strings.ToLower(username)) {
+		fail(RuleUsername, "must not contain the username")
+	}
+	if _, common := p.Common[normalized]; common {
+		fail(RuleCommon, "is too common")
+	}
+	if p.Breached != nil {
+		breached, err := p.Breached.IsBreached(password)
+		if err != nil {
+			return fmt.Errorf("check breached passwords: %w", err)
+		}
+		if breached {
+			fail(RuleBreached, "has appeared in a data breach")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func (p *Policy) maxLength() int {
+	if p.MaxLength <= 0 || p.MaxLength > MaxBcryptLength {
+		return MaxBcryptLength
+	}
+	return p.MaxLength
+}
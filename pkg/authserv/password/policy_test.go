@@ -0,0 +1,116 @@
+package password
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// stubBreachChecker считает утекшими пароли из breached.
+type stubBreachChecker struct {
+	breached map[string]bool
+	err      error
+}
+
+func (c stubBreachChecker) IsBreached(password string) (bool, error) {
+	return c.breached[password], c.err
+}
+
+func TestPolicyValidate(t *testing.T) {
+	strict := &Policy{
+		MinLength:     10,
+		RequireLower:  true,
+		RequireUpper:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+	}
+
+	tests := []struct {
+		name      string
+		policy    *Policy
+		username  string
+		password  string
+		wantRules []string
+	}{
+		{"default policy", DefaultPolicy(), "alice", "correct horse battery", nil},
+		{"too short", DefaultPolicy(), "alice", "short", []string{RuleMinLength}},
+		{"length in characters", DefaultPolicy(), "alice", "пароль12", nil},
+		{"longer than bcrypt", DefaultPolicy(), "alice", strings.Repeat("x", MaxBcryptLength+1), []string{RuleMaxLength}},
+		{"multibyte longer than bcrypt", DefaultPolicy(), "alice", strings.Repeat("я", MaxBcryptLength/2+1), []string{RuleMaxLength}},
+		{"max length above bcrypt", &Policy{MaxLength: 100}, "", strings.Repeat("x", MaxBcryptLength+1), []string{RuleMaxLength}},
+		{"custom max length", &Policy{MaxLength: 10}, "", strings.Repeat("x", 11), []string{RuleMaxLength}},
+		{"contains username", DefaultPolicy(), "Alice", "my-alice-password", []string{RuleUsername}},
+		{"short username is not searched", DefaultPolicy(), "al", "my-al-password", nil},
+		{"common password", DefaultPolicy(), "alice", "Password123", []string{RuleCommon}},
+		{"all classes", strict, "", "Abcdefgh1!", nil},
+		{"unicode symbol", strict, "", "Abcdefgh1€", nil},
+		{"no classes", strict, "", "          ", []string{RuleLowercase, RuleUppercase, RuleDigit, RuleSymbol}},
+		{"caseless letters are not symbols", strict, "", "Abcdefgh1漢字", []string{RuleSymbol}},
+		{
+			name:      "all violations are reported",
+			policy:    &Policy{MinLength: 8, RequireDigit: true, RejectUsername: true, Common: DefaultCommonPasswords()},
+			username:  "pass",
+			password:  "passw0rd",
+			wantRules: []string{RuleUsername, RuleCommon},
+		},
+		{"zero policy", &Policy{}, "", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate(tt.username, tt.password)
+			if err == nil {
+				if tt.wantRules != nil {
+					t.Fatalf("Validate accepted the password, want %v", tt.wantRules)
+				}
+				return
+			}
+			var policyErr *PolicyError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("Validate err = %v, want *PolicyError", err)
+			}
+			var rules []string
+			for _, violation := range policyErr.Violations {
+				rules = append(rules, violation.Rule)
+			}
+			if !reflect.DeepEqual(rules, tt.wantRules) {
+				t.Errorf("violated rules = %v, want %v", rules, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestPolicyValidateBreached(t *testing.T) {
+	checkErr := errors.New("source is unavailable")
+
+	tests := []struct {
+		name     string
+		checker  BreachChecker
+		password string
+		wantRule bool
+		wantErr  bool
+	}{
+		{"breached", stubBreachChecker{breached: map[string]bool{"leaked password": true}}, "leaked password", true, false},
+		{"not breached", stubBreachChecker{}, "unique password", false, false},
+		{"checker error", stubBreachChecker{err: checkErr}, "unique password", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &Policy{Breached: tt.checker}
+			err := policy.Validate("alice", tt.password)
+			var policyErr *PolicyError
+			switch {
+			case tt.wantErr:
+				if !errors.Is(err, checkErr) || errors.As(err, &policyErr) {
+					t.Errorf("Validate err = %v, want the checker error", err)
+				}
+			case tt.wantRule:
+				if !errors.As(err, &policyErr) || len(policyErr.Violations) != 1 || policyErr.Violations[0].Rule != RuleBreached {
+					t.Errorf("Validate err = %v, want breached violation", err)
+				}
+			case err != nil:
+				t.Errorf("Validate: %v", err)
+			}
+		})
+	}
+}
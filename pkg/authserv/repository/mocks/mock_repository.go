@@ -6,6 +6,7 @@ package mocks
 
 import (
 	auth "github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	repository "github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
 	time "time"
@@ -48,6 +49,35 @@ func (mr *MockAuthRepositoryMockRecorder) AddToBlacklist(arg0, arg1 interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddToBlacklist", reflect.TypeOf((*MockAuthRepository)(nil).AddToBlacklist), arg0, arg1)
 }
 
+// AuditTokenExchange mocks base method
+func (m *MockAuthRepository) AuditTokenExchange(arg0 repository.TokenExchange) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AuditTokenExchange", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AuditTokenExchange indicates an expected call of AuditTokenExchange
+func (mr *MockAuthRepositoryMockRecorder) AuditTokenExchange(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuditTokenExchange", reflect.TypeOf((*MockAuthRepository)(nil).AuditTokenExchange), arg0)
+}
+
+// BumpTokenVersion mocks base method
+func (m *MockAuthRepository) BumpTokenVersion(arg0 string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BumpTokenVersion", arg0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BumpTokenVersion indicates an expected call of BumpTokenVersion
+func (mr *MockAuthRepositoryMockRecorder) BumpTokenVersion(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BumpTokenVersion", reflect.TypeOf((*MockAuthRepository)(nil).BumpTokenVersion), arg0)
+}
+
 // CleanExpiredTokens mocks base method
 func (m *MockAuthRepository) CleanExpiredTokens() error {
 	m.ctrl.T.Helper()
@@ -62,18 +92,325 @@ func (mr *MockAuthRepositoryMockRecorder) CleanExpiredTokens() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CleanExpiredTokens", reflect.TypeOf((*MockAuthRepository)(nil).CleanExpiredTokens))
 }
 
+// ConfirmTOTPSecret mocks base method
+func (m *MockAuthRepository) ConfirmTOTPSecret(arg0 string, arg1 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmTOTPSecret", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ConfirmTOTPSecret indicates an expected call of ConfirmTOTPSecret
+func (mr *MockAuthRepositoryMockRecorder) ConfirmTOTPSecret(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmTOTPSecret", reflect.TypeOf((*MockAuthRepository)(nil).ConfirmTOTPSecret), arg0, arg1)
+}
+
+// ConsumeAuthorizationCode mocks base method
+func (m *MockAuthRepository) ConsumeAuthorizationCode(arg0 string) (*repository.AuthorizationCode, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeAuthorizationCode", arg0)
+	ret0, _ := ret[0].(*repository.AuthorizationCode)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConsumeAuthorizationCode indicates an expected call of ConsumeAuthorizationCode
+func (mr *MockAuthRepositoryMockRecorder) ConsumeAuthorizationCode(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeAuthorizationCode", reflect.TypeOf((*MockAuthRepository)(nil).ConsumeAuthorizationCode), arg0)
+}
+
+// ConsumeEmailVerification mocks base method
+func (m *MockAuthRepository) ConsumeEmailVerification(arg0 string) (*repository.EmailVerification, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeEmailVerification", arg0)
+	ret0, _ := ret[0].(*repository.EmailVerification)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConsumeEmailVerification indicates an expected call of ConsumeEmailVerification
+func (mr *MockAuthRepositoryMockRecorder) ConsumeEmailVerification(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeEmailVerification", reflect.TypeOf((*MockAuthRepository)(nil).ConsumeEmailVerification), arg0)
+}
+
+// ConsumeMFAChallenge mocks base method
+func (m *MockAuthRepository) ConsumeMFAChallenge(arg0 string) (*repository.MFAChallenge, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeMFAChallenge", arg0)
+	ret0, _ := ret[0].(*repository.MFAChallenge)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConsumeMFAChallenge indicates an expected call of ConsumeMFAChallenge
+func (mr *MockAuthRepositoryMockRecorder) ConsumeMFAChallenge(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeMFAChallenge", reflect.TypeOf((*MockAuthRepository)(nil).ConsumeMFAChallenge), arg0)
+}
+
+// ConsumePasswordReset mocks base method
+func (m *MockAuthRepository) ConsumePasswordReset(arg0 string) (*repository.PasswordReset, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumePasswordReset", arg0)
+	ret0, _ := ret[0].(*repository.PasswordReset)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConsumePasswordReset indicates an expected call of ConsumePasswordReset
+func (mr *MockAuthRepositoryMockRecorder) ConsumePasswordReset(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumePasswordReset", reflect.TypeOf((*MockAuthRepository)(nil).ConsumePasswordReset), arg0)
+}
+
+// CreateAPIKey mocks base method
+func (m *MockAuthRepository) CreateAPIKey(arg0 auth.APIKey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAPIKey", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateAPIKey indicates an expected call of CreateAPIKey
+func (mr *MockAuthRepositoryMockRecorder) CreateAPIKey(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAPIKey", reflect.TypeOf((*MockAuthRepository)(nil).CreateAPIKey), arg0)
+}
+
+// CreateClient mocks base method
+func (m *MockAuthRepository) CreateClient(arg0 repository.OAuthClient) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateClient", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateClient indicates an expected call of CreateClient
+func (mr *MockAuthRepositoryMockRecorder) CreateClient(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateClient", reflect.TypeOf((*MockAuthRepository)(nil).CreateClient), arg0)
+}
+
+// CreateSession mocks base method
+func (m *MockAuthRepository) CreateSession(arg0 repository.Session) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSession", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateSession indicates an expected call of CreateSession
+func (mr *MockAuthRepositoryMockRecorder) CreateSession(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSession", reflect.TypeOf((*MockAuthRepository)(nil).CreateSession), arg0)
+}
+
+// CreateTokenFamily mocks base method
+func (m *MockAuthRepository) CreateTokenFamily(arg0, arg1, arg2 string, arg3 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateTokenFamily", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateTokenFamily indicates an expected call of CreateTokenFamily
+func (mr *MockAuthRepositoryMockRecorder) CreateTokenFamily(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTokenFamily", reflect.TypeOf((*MockAuthRepository)(nil).CreateTokenFamily), arg0, arg1, arg2, arg3)
+}
+
 // CreateUser mocks base method
-func (m *MockAuthRepository) CreateUser(arg0, arg1 string) error {
+func (m *MockAuthRepository) CreateUser(arg0, arg1, arg2 string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateUser", arg0, arg1)
+	ret := m.ctrl.Call(m, "CreateUser", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // CreateUser indicates an expected call of CreateUser
-func (mr *MockAuthRepositoryMockRecorder) CreateUser(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockAuthRepositoryMockRecorder) CreateUser(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockAuthRepository)(nil).CreateUser), arg0, arg1, arg2)
+}
+
+// DeleteOpaqueToken mocks base method
+func (m *MockAuthRepository) DeleteOpaqueToken(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteOpaqueToken", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteOpaqueToken indicates an expected call of DeleteOpaqueToken
+func (mr *MockAuthRepositoryMockRecorder) DeleteOpaqueToken(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteOpaqueToken", reflect.TypeOf((*MockAuthRepository)(nil).DeleteOpaqueToken), arg0)
+}
+
+// DeleteRetiredSigningKeys mocks base method
+func (m *MockAuthRepository) DeleteRetiredSigningKeys(arg0 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteRetiredSigningKeys", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteRetiredSigningKeys indicates an expected call of DeleteRetiredSigningKeys
+func (mr *MockAuthRepositoryMockRecorder) DeleteRetiredSigningKeys(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteRetiredSigningKeys", reflect.TypeOf((*MockAuthRepository)(nil).DeleteRetiredSigningKeys), arg0)
+}
+
+// DeleteTOTPSecret mocks base method
+func (m *MockAuthRepository) DeleteTOTPSecret(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteTOTPSecret", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteTOTPSecret indicates an expected call of DeleteTOTPSecret
+func (mr *MockAuthRepositoryMockRecorder) DeleteTOTPSecret(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockAuthRepository)(nil).CreateUser), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteTOTPSecret", reflect.TypeOf((*MockAuthRepository)(nil).DeleteTOTPSecret), arg0)
+}
+
+// FailMFAChallenge mocks base method
+func (m *MockAuthRepository) FailMFAChallenge(arg0 string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FailMFAChallenge", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FailMFAChallenge indicates an expected call of FailMFAChallenge
+func (mr *MockAuthRepositoryMockRecorder) FailMFAChallenge(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FailMFAChallenge", reflect.TypeOf((*MockAuthRepository)(nil).FailMFAChallenge), arg0)
+}
+
+// GetAPIKey mocks base method
+func (m *MockAuthRepository) GetAPIKey(arg0 string) (*auth.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIKey", arg0)
+	ret0, _ := ret[0].(*auth.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAPIKey indicates an expected call of GetAPIKey
+func (mr *MockAuthRepositoryMockRecorder) GetAPIKey(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIKey", reflect.TypeOf((*MockAuthRepository)(nil).GetAPIKey), arg0)
+}
+
+// GetClient mocks base method
+func (m *MockAuthRepository) GetClient(arg0 string) (*repository.OAuthClient, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetClient", arg0)
+	ret0, _ := ret[0].(*repository.OAuthClient)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetClient indicates an expected call of GetClient
+func (mr *MockAuthRepositoryMockRecorder) GetClient(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetClient", reflect.TypeOf((*MockAuthRepository)(nil).GetClient), arg0)
+}
+
+// GetMFAChallenge mocks base method
+func (m *MockAuthRepository) GetMFAChallenge(arg0 string) (*repository.MFAChallenge, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMFAChallenge", arg0)
+	ret0, _ := ret[0].(*repository.MFAChallenge)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMFAChallenge indicates an expected call of GetMFAChallenge
+func (mr *MockAuthRepositoryMockRecorder) GetMFAChallenge(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMFAChallenge", reflect.TypeOf((*MockAuthRepository)(nil).GetMFAChallenge), arg0)
+}
+
+// GetOpaqueToken mocks base method
+func (m *MockAuthRepository) GetOpaqueToken(arg0 string) (*auth.OpaqueToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOpaqueToken", arg0)
+	ret0, _ := ret[0].(*auth.OpaqueToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOpaqueToken indicates an expected call of GetOpaqueToken
+func (mr *MockAuthRepositoryMockRecorder) GetOpaqueToken(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOpaqueToken", reflect.TypeOf((*MockAuthRepository)(nil).GetOpaqueToken), arg0)
+}
+
+// GetPasswordReset mocks base method
+func (m *MockAuthRepository) GetPasswordReset(arg0 string) (*repository.PasswordReset, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPasswordReset", arg0)
+	ret0, _ := ret[0].(*repository.PasswordReset)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPasswordReset indicates an expected call of GetPasswordReset
+func (mr *MockAuthRepositoryMockRecorder) GetPasswordReset(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPasswordReset", reflect.TypeOf((*MockAuthRepository)(nil).GetPasswordReset), arg0)
+}
+
+// GetSigningKeys mocks base method
+func (m *MockAuthRepository) GetSigningKeys() ([]auth.StoredKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSigningKeys")
+	ret0, _ := ret[0].([]auth.StoredKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSigningKeys indicates an expected call of GetSigningKeys
+func (mr *MockAuthRepositoryMockRecorder) GetSigningKeys() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSigningKeys", reflect.TypeOf((*MockAuthRepository)(nil).GetSigningKeys))
+}
+
+// GetTOTPSecret mocks base method
+func (m *MockAuthRepository) GetTOTPSecret(arg0 string) (*repository.TOTPSecret, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTOTPSecret", arg0)
+	ret0, _ := ret[0].(*repository.TOTPSecret)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTOTPSecret indicates an expected call of GetTOTPSecret
+func (mr *MockAuthRepositoryMockRecorder) GetTOTPSecret(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTOTPSecret", reflect.TypeOf((*MockAuthRepository)(nil).GetTOTPSecret), arg0)
+}
+
+// GetTokenVersion mocks base method
+func (m *MockAuthRepository) GetTokenVersion(arg0 string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTokenVersion", arg0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTokenVersion indicates an expected call of GetTokenVersion
+func (mr *MockAuthRepositoryMockRecorder) GetTokenVersion(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTokenVersion", reflect.TypeOf((*MockAuthRepository)(nil).GetTokenVersion), arg0)
 }
 
 // GetUser mocks base method
@@ -91,6 +428,66 @@ func (mr *MockAuthRepositoryMockRecorder) GetUser(arg0 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockAuthRepository)(nil).GetUser), arg0)
 }
 
+// GetUserAPIKeys mocks base method
+func (m *MockAuthRepository) GetUserAPIKeys(arg0 string) ([]auth.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserAPIKeys", arg0)
+	ret0, _ := ret[0].([]auth.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserAPIKeys indicates an expected call of GetUserAPIKeys
+func (mr *MockAuthRepositoryMockRecorder) GetUserAPIKeys(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserAPIKeys", reflect.TypeOf((*MockAuthRepository)(nil).GetUserAPIKeys), arg0)
+}
+
+// GetUserProfile mocks base method
+func (m *MockAuthRepository) GetUserProfile(arg0 string) (*repository.UserProfile, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserProfile", arg0)
+	ret0, _ := ret[0].(*repository.UserProfile)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserProfile indicates an expected call of GetUserProfile
+func (mr *MockAuthRepositoryMockRecorder) GetUserProfile(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserProfile", reflect.TypeOf((*MockAuthRepository)(nil).GetUserProfile), arg0)
+}
+
+// GetUserRoles mocks base method
+func (m *MockAuthRepository) GetUserRoles(arg0 string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserRoles", arg0)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserRoles indicates an expected call of GetUserRoles
+func (mr *MockAuthRepositoryMockRecorder) GetUserRoles(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserRoles", reflect.TypeOf((*MockAuthRepository)(nil).GetUserRoles), arg0)
+}
+
+// GetUserSessions mocks base method
+func (m *MockAuthRepository) GetUserSessions(arg0 string) ([]repository.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserSessions", arg0)
+	ret0, _ := ret[0].([]repository.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserSessions indicates an expected call of GetUserSessions
+func (mr *MockAuthRepositoryMockRecorder) GetUserSessions(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserSessions", reflect.TypeOf((*MockAuthRepository)(nil).GetUserSessions), arg0)
+}
+
 // IsInBlacklist mocks base method
 func (m *MockAuthRepository) IsInBlacklist(arg0 string) bool {
 	m.ctrl.T.Helper()
@@ -105,17 +502,282 @@ func (mr *MockAuthRepositoryMockRecorder) IsInBlacklist(arg0 interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsInBlacklist", reflect.TypeOf((*MockAuthRepository)(nil).IsInBlacklist), arg0)
 }
 
-// ValidateToken mocks base method
-func (m *MockAuthRepository) ValidateToken(arg0 string) (*auth.Claims, error) {
+// IsTokenFamilyRevoked mocks base method
+func (m *MockAuthRepository) IsTokenFamilyRevoked(arg0 string) bool {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ValidateToken", arg0)
-	ret0, _ := ret[0].(*auth.Claims)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret := m.ctrl.Call(m, "IsTokenFamilyRevoked", arg0)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// IsTokenFamilyRevoked indicates an expected call of IsTokenFamilyRevoked
+func (mr *MockAuthRepositoryMockRecorder) IsTokenFamilyRevoked(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsTokenFamilyRevoked", reflect.TypeOf((*MockAuthRepository)(nil).IsTokenFamilyRevoked), arg0)
+}
+
+// MarkEmailVerified mocks base method
+func (m *MockAuthRepository) MarkEmailVerified(arg0, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkEmailVerified", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkEmailVerified indicates an expected call of MarkEmailVerified
+func (mr *MockAuthRepositoryMockRecorder) MarkEmailVerified(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkEmailVerified", reflect.TypeOf((*MockAuthRepository)(nil).MarkEmailVerified), arg0, arg1)
+}
+
+// RecordTOTPAttempt mocks base method
+func (m *MockAuthRepository) RecordTOTPAttempt(arg0 string, arg1 time.Time, arg2 int, arg3 time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordTOTPAttempt", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordTOTPAttempt indicates an expected call of RecordTOTPAttempt
+func (mr *MockAuthRepositoryMockRecorder) RecordTOTPAttempt(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordTOTPAttempt", reflect.TypeOf((*MockAuthRepository)(nil).RecordTOTPAttempt), arg0, arg1, arg2, arg3)
+}
+
+// RevokeAPIKey mocks base method
+func (m *MockAuthRepository) RevokeAPIKey(arg0, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAPIKey", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAPIKey indicates an expected call of RevokeAPIKey
+func (mr *MockAuthRepositoryMockRecorder) RevokeAPIKey(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAPIKey", reflect.TypeOf((*MockAuthRepository)(nil).RevokeAPIKey), arg0, arg1)
+}
+
+// RevokeOtherSessions mocks base method
+func (m *MockAuthRepository) RevokeOtherSessions(arg0, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeOtherSessions", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeOtherSessions indicates an expected call of RevokeOtherSessions
+func (mr *MockAuthRepositoryMockRecorder) RevokeOtherSessions(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeOtherSessions", reflect.TypeOf((*MockAuthRepository)(nil).RevokeOtherSessions), arg0, arg1)
+}
+
+// RevokeSession mocks base method
+func (m *MockAuthRepository) RevokeSession(arg0, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeSession", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeSession indicates an expected call of RevokeSession
+func (mr *MockAuthRepositoryMockRecorder) RevokeSession(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeSession", reflect.TypeOf((*MockAuthRepository)(nil).RevokeSession), arg0, arg1)
+}
+
+// RevokeTokenFamily mocks base method
+func (m *MockAuthRepository) RevokeTokenFamily(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeTokenFamily", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeTokenFamily indicates an expected call of RevokeTokenFamily
+func (mr *MockAuthRepositoryMockRecorder) RevokeTokenFamily(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeTokenFamily", reflect.TypeOf((*MockAuthRepository)(nil).RevokeTokenFamily), arg0)
+}
+
+// RotateTokenFamily mocks base method
+func (m *MockAuthRepository) RotateTokenFamily(arg0, arg1, arg2 string, arg3 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateTokenFamily", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RotateTokenFamily indicates an expected call of RotateTokenFamily
+func (mr *MockAuthRepositoryMockRecorder) RotateTokenFamily(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateTokenFamily", reflect.TypeOf((*MockAuthRepository)(nil).RotateTokenFamily), arg0, arg1, arg2, arg3)
+}
+
+// SaveAuthorizationCode mocks base method
+func (m *MockAuthRepository) SaveAuthorizationCode(arg0 repository.AuthorizationCode) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveAuthorizationCode", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveAuthorizationCode indicates an expected call of SaveAuthorizationCode
+func (mr *MockAuthRepositoryMockRecorder) SaveAuthorizationCode(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveAuthorizationCode", reflect.TypeOf((*MockAuthRepository)(nil).SaveAuthorizationCode), arg0)
+}
+
+// SaveEmailVerification mocks base method
+func (m *MockAuthRepository) SaveEmailVerification(arg0 repository.EmailVerification) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveEmailVerification", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveEmailVerification indicates an expected call of SaveEmailVerification
+func (mr *MockAuthRepositoryMockRecorder) SaveEmailVerification(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveEmailVerification", reflect.TypeOf((*MockAuthRepository)(nil).SaveEmailVerification), arg0)
+}
+
+// SaveMFAChallenge mocks base method
+func (m *MockAuthRepository) SaveMFAChallenge(arg0 repository.MFAChallenge) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveMFAChallenge", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveMFAChallenge indicates an expected call of SaveMFAChallenge
+func (mr *MockAuthRepositoryMockRecorder) SaveMFAChallenge(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveMFAChallenge", reflect.TypeOf((*MockAuthRepository)(nil).SaveMFAChallenge), arg0)
+}
+
+// SaveOpaqueToken mocks base method
+func (m *MockAuthRepository) SaveOpaqueToken(arg0 auth.OpaqueToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveOpaqueToken", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveOpaqueToken indicates an expected call of SaveOpaqueToken
+func (mr *MockAuthRepositoryMockRecorder) SaveOpaqueToken(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveOpaqueToken", reflect.TypeOf((*MockAuthRepository)(nil).SaveOpaqueToken), arg0)
+}
+
+// SavePasswordReset mocks base method
+func (m *MockAuthRepository) SavePasswordReset(arg0 repository.PasswordReset, arg1 time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SavePasswordReset", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SavePasswordReset indicates an expected call of SavePasswordReset
+func (mr *MockAuthRepositoryMockRecorder) SavePasswordReset(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SavePasswordReset", reflect.TypeOf((*MockAuthRepository)(nil).SavePasswordReset), arg0, arg1)
+}
+
+// SaveSigningKey mocks base method
+func (m *MockAuthRepository) SaveSigningKey(arg0 auth.StoredKey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveSigningKey", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveSigningKey indicates an expected call of SaveSigningKey
+func (mr *MockAuthRepositoryMockRecorder) SaveSigningKey(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveSigningKey", reflect.TypeOf((*MockAuthRepository)(nil).SaveSigningKey), arg0)
+}
+
+// SaveTOTPSecret mocks base method
+func (m *MockAuthRepository) SaveTOTPSecret(arg0 repository.TOTPSecret) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveTOTPSecret", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveTOTPSecret indicates an expected call of SaveTOTPSecret
+func (mr *MockAuthRepositoryMockRecorder) SaveTOTPSecret(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveTOTPSecret", reflect.TypeOf((*MockAuthRepository)(nil).SaveTOTPSecret), arg0)
+}
+
+// SetUserEmail mocks base method
+func (m *MockAuthRepository) SetUserEmail(arg0, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserEmail", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserEmail indicates an expected call of SetUserEmail
+func (mr *MockAuthRepositoryMockRecorder) SetUserEmail(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserEmail", reflect.TypeOf((*MockAuthRepository)(nil).SetUserEmail), arg0, arg1)
+}
+
+// SetUserRoles mocks base method
+func (m *MockAuthRepository) SetUserRoles(arg0 string, arg1 []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserRoles", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserRoles indicates an expected call of SetUserRoles
+func (mr *MockAuthRepositoryMockRecorder) SetUserRoles(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserRoles", reflect.TypeOf((*MockAuthRepository)(nil).SetUserRoles), arg0, arg1)
+}
+
+// TouchSession mocks base method
+func (m *MockAuthRepository) TouchSession(arg0, arg1 string, arg2 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchSession", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchSession indicates an expected call of TouchSession
+func (mr *MockAuthRepositoryMockRecorder) TouchSession(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchSession", reflect.TypeOf((*MockAuthRepository)(nil).TouchSession), arg0, arg1, arg2)
+}
+
+// UpdatePassword mocks base method
+func (m *MockAuthRepository) UpdatePassword(arg0, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePassword", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePassword indicates an expected call of UpdatePassword
+func (mr *MockAuthRepositoryMockRecorder) UpdatePassword(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePassword", reflect.TypeOf((*MockAuthRepository)(nil).UpdatePassword), arg0, arg1)
+}
+
+// UseTOTPStep mocks base method
+func (m *MockAuthRepository) UseTOTPStep(arg0 string, arg1 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTOTPStep", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
-// ValidateToken indicates an expected call of ValidateToken
-func (mr *MockAuthRepositoryMockRecorder) ValidateToken(arg0 interface{}) *gomock.Call {
+// UseTOTPStep indicates an expected call of UseTOTPStep
+func (mr *MockAuthRepositoryMockRecorder) UseTOTPStep(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidateToken", reflect.TypeOf((*MockAuthRepository)(nil).ValidateToken), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTOTPStep", reflect.TypeOf((*MockAuthRepository)(nil).UseTOTPStep), arg0, arg1)
 }
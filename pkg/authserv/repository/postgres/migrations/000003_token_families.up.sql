@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS token_families (
+    family_id TEXT PRIMARY KEY,
+    username TEXT NOT NULL,
+    current_jti TEXT NOT NULL,
+    revoked BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS token_families_expires_at_idx ON token_families (expires_at);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS user_roles (
+    username TEXT NOT NULL REFERENCES users_auth (username) ON DELETE CASCADE,
+    role TEXT NOT NULL,
+    PRIMARY KEY (username, role)
+);
@@ -0,0 +1,5 @@
+ALTER TABLE authorization_codes DROP COLUMN IF EXISTS auth_time;
+ALTER TABLE authorization_codes DROP COLUMN IF EXISTS nonce;
+
+ALTER TABLE users_auth DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE users_auth DROP COLUMN IF EXISTS name;
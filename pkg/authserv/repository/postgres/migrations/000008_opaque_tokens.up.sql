@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS opaque_tokens (
+    token_hash TEXT PRIMARY KEY,
+    claims JSONB NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS opaque_tokens_expires_at_idx ON opaque_tokens (expires_at);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS sessions (
+    family_id TEXT PRIMARY KEY REFERENCES token_families (family_id) ON DELETE CASCADE,
+    username TEXT NOT NULL,
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS sessions_username_idx ON sessions (username);
@@ -0,0 +1 @@
+ALTER TABLE users_auth DROP COLUMN IF EXISTS token_version;
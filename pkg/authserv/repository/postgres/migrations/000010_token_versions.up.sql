@@ -0,0 +1 @@
+ALTER TABLE users_auth ADD COLUMN IF NOT EXISTS token_version BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS token_exchange_audit;
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS exchange_subjects;
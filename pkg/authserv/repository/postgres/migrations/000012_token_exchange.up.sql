@@ -0,0 +1,14 @@
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS exchange_subjects TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS token_exchange_audit (
+    id BIGSERIAL PRIMARY KEY,
+    client_id TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    audience TEXT[] NOT NULL DEFAULT '{}',
+    token_id TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS token_exchange_audit_subject_idx ON token_exchange_audit (subject);
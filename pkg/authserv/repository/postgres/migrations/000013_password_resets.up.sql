@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS password_resets (
+    username TEXT PRIMARY KEY REFERENCES users_auth (username) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS password_resets_expires_at_idx ON password_resets (expires_at);
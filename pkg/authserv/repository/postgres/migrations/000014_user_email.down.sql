@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS email_verifications;
+DROP INDEX IF EXISTS users_auth_email_idx;
+ALTER TABLE users_auth DROP COLUMN IF EXISTS email_verified;
+ALTER TABLE users_auth DROP COLUMN IF EXISTS email;
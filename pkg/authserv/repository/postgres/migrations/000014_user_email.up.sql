@@ -0,0 +1,14 @@
+ALTER TABLE users_auth ADD COLUMN IF NOT EXISTS email TEXT NOT NULL DEFAULT '';
+ALTER TABLE users_auth ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_auth_email_idx ON users_auth (email) WHERE email <> '';
+
+CREATE TABLE IF NOT EXISTS email_verifications (
+    username TEXT PRIMARY KEY REFERENCES users_auth (username) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS email_verifications_expires_at_idx ON email_verifications (expires_at);
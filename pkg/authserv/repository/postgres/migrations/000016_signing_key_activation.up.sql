@@ -0,0 +1 @@
+ALTER TABLE signing_keys ADD COLUMN IF NOT EXISTS activate_at TIMESTAMPTZ;
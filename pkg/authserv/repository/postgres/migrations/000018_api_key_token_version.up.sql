@@ -0,0 +1,4 @@
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS token_version BIGINT NOT NULL DEFAULT 0;
+
+UPDATE api_keys SET token_version = users_auth.token_version
+FROM users_auth WHERE users_auth.username = api_keys.username;
@@ -0,0 +1 @@
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS exchange_audiences TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_auth_verified_email_idx;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_auth_email_idx ON users_auth (email) WHERE email <> '';
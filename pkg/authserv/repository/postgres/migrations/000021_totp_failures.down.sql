@@ -0,0 +1,2 @@
+ALTER TABLE totp_secrets DROP COLUMN IF EXISTS last_failure_at;
+ALTER TABLE totp_secrets DROP COLUMN IF EXISTS failed_attempts;
@@ -0,0 +1,2 @@
+ALTER TABLE totp_secrets ADD COLUMN IF NOT EXISTS failed_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE totp_secrets ADD COLUMN IF NOT EXISTS last_failure_at TIMESTAMPTZ;
@@ -2,9 +2,14 @@ package postgres
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
+	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/repository"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v4"
 )
 
@@ -24,9 +29,9 @@ func (repo *PostgresAuthRepository) Close() {
 	repo.conn.Close(context.Background())
 }
 
-func (repo *PostgresAuthRepository) CreateUser(username, hashedPassword string) error {
+func (repo *PostgresAuthRepository) CreateUser(username, hashedPassword, email string) error {
 	_, err := repo.conn.Exec(context.Background(),
-		"INSERT INTO users_auth (username, password) VALUES ($1, $2)", username, hashedPassword)
+		"INSERT INTO users_auth (username, password, email) VALUES ($1, $2, $3)", username, hashedPassword, email)
 	return err
 }
 
@@ -40,9 +45,111 @@ func (repo *PostgresAuthRepository) GetUser(username string) (string, error) {
 	return passwordHash, nil
 }
 
+func (repo *PostgresAuthRepository) UpdatePassword(username, hashedPassword string) error {
+	tag, err := repo.conn.Exec(context.Background(),
+		"UPDATE users_auth SET password = $2 WHERE username = $1", username, hashedPassword)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (repo *PostgresAuthRepository) GetUserProfile(username string) (*repository.UserProfile, error) {
+	profile := &repository.UserProfile{}
+	err := repo.conn.QueryRow(context.Background(),
+		"SELECT username, name, email, email_verified, updated_at FROM users_auth WHERE username=$1", username).
+		Scan(&profile.Username, &profile.Name, &profile.Email, &profile.EmailVerified, &profile.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// SetUserEmail задает адрес пользователя и снимает отметку о его подтверждении.
+func (repo *PostgresAuthRepository) SetUserEmail(username, email string) error {
+	_, err := repo.conn.Exec(context.Background(),
+		"UPDATE users_auth SET email = $2, email_verified = FALSE, updated_at = NOW() WHERE username = $1",
+		username, email)
+	return err
+}
+
+// isEmailTaken сообщает, что err - нарушение уникальности адреса пользователя.
+func isEmailTaken(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation &&
+		pgErr.ConstraintName == "users_auth_verified_email_idx"
+}
+
+// SaveEmailVerification сохраняет токен подтверждения адреса, заменяя предыдущий токен пользователя.
+func (repo *PostgresAuthRepository) SaveEmailVerification(verification repository.EmailVerification) error {
+	_, err := repo.conn.Exec(context.Background(),
+		`INSERT INTO email_verifications (username, email, token_hash, created_at, expires_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (username) DO UPDATE
+		SET email = EXCLUDED.email, token_hash = EXCLUDED.token_hash,
+			created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at`,
+		verification.Username, verification.Email, verification.TokenHash, verification.CreatedAt, verification.ExpiresAt)
+	return err
+}
+
+// ConsumeEmailVerification удаляет токен и возвращает его данные, поэтому токен можно использовать только один раз.
+func (repo *PostgresAuthRepository) ConsumeEmailVerification(tokenHash string) (*repository.EmailVerification, error) {
+	verification := &repository.EmailVerification{}
+	err := repo.conn.QueryRow(context.Background(),
+		`DELETE FROM email_verifications WHERE token_hash = $1
+		RETURNING token_hash, username, email, created_at, expires_at`, tokenHash).
+		Scan(&verification.TokenHash, &verification.Username, &verification.Email, &verification.CreatedAt, &verification.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, repository.ErrVerificationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return verification, nil
+}
+
+// MarkEmailVerified отмечает адрес подтвержденным, если он по-прежнему совпадает с email.
+// Уникальность подтвержденных адресов проверяет индекс users_auth_verified_email_idx.
+func (repo *PostgresAuthRepository) MarkEmailVerified(username, email string) error {
+	tag, err := repo.conn.Exec(context.Background(),
+		"UPDATE users_auth SET email_verified = TRUE WHERE username = $1 AND email = $2", username, email)
+	if isEmailTaken(err) {
+		return repository.ErrEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrVerificationNotFound
+	}
+	return nil
+}
+
+// GetTokenVersion возвращает версию токенов пользователя. Для неизвестного пользователя - auth.ErrTokenRevoked.
+func (repo *PostgresAuthRepository) GetTokenVersion(username string) (int64, error) {
+	var version int64
+	err := repo.conn.QueryRow(context.Background(),
+		"SELECT token_version FROM users_auth WHERE username = $1", username).Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, auth.ErrTokenRevoked
+	}
+	return version, err
+}
+
+// BumpTokenVersion увеличивает версию токенов пользователя и возвращает новую.
+func (repo *PostgresAuthRepository) BumpTokenVersion(username string) (int64, error) {
+	var version int64
+	err := repo.conn.QueryRow(context.Background(),
+		"UPDATE users_auth SET token_version = token_version + 1 WHERE username = $1 RETURNING token_version",
+		username).Scan(&version)
+	return version, err
+}
+
 func (repo *PostgresAuthRepository) AddToBlacklist(token string, expiration time.Time) error {
 	_, err := repo.conn.Exec(context.Background(),
-		"INSERT INTO token_blacklist (token, expires_at) VALUES ($1, $2)", token, expiration)
+		"INSERT INTO token_blacklist (token, expires_at) VALUES ($1, $2) ON CONFLICT (token) DO NOTHING", token, expiration)
 	return err
 }
 
@@ -56,9 +163,547 @@ func (repo *PostgresAuthRepository) IsInBlacklist(token string) bool {
 func (repo *PostgresAuthRepository) CleanExpiredTokens() error {
 	_, err := repo.conn.Exec(context.Background(),
 		"DELETE FROM token_blacklist WHERE expires_at < NOW()")
+	if err != nil {
+		return err
+	}
+	_, err = repo.conn.Exec(context.Background(),
+		"DELETE FROM token_families WHERE expires_at < NOW()")
+	if err != nil {
+		return err
+	}
+	_, err = repo.conn.Exec(context.Background(),
+		"DELETE FROM authorization_codes WHERE expires_at < NOW()")
+	if err != nil {
+		return err
+	}
+	_, err = repo.conn.Exec(context.Background(),
+		"DELETE FROM opaque_tokens WHERE expires_at < NOW()")
+	if err != nil {
+		return err
+	}
+	_, err = repo.conn.Exec(context.Background(),
+		"DELETE FROM password_resets WHERE expires_at < NOW()")
+	if err != nil {
+		return err
+	}
+	_, err = repo.conn.Exec(context.Background(),
+		"DELETE FROM email_verifications WHERE expires_at < NOW()")
+	if err != nil {
+		return err
+	}
+	_, err = repo.conn.Exec(context.Background(),
+		"DELETE FROM mfa_challenges WHERE expires_at < NOW()")
+	return err
+}
+
+func (repo *PostgresAuthRepository) SaveOpaqueToken(token auth.OpaqueToken) error {
+	claims, err := json.Marshal(token.Claims)
+	if err != nil {
+		return err
+	}
+	_, err = repo.conn.Exec(context.Background(),
+		"INSERT INTO opaque_tokens (token_hash, claims, expires_at) VALUES ($1, $2, $3)",
+		token.Hash, claims, token.Claims.ExpiresAt.Time)
+	return err
+}
+
+func (repo *PostgresAuthRepository) GetOpaqueToken(hash string) (*auth.OpaqueToken, error) {
+	var data []byte
+	err := repo.conn.QueryRow(context.Background(),
+		"SELECT claims FROM opaque_tokens WHERE token_hash = $1", hash).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, auth.ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	token := &auth.OpaqueToken{Hash: hash, Claims: &auth.Claims{}}
+	if err := json.Unmarshal(data, token.Claims); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (repo *PostgresAuthRepository) DeleteOpaqueToken(hash string) error {
+	_, err := repo.conn.Exec(context.Background(),
+		"DELETE FROM opaque_tokens WHERE token_hash = $1", hash)
+	return err
+}
+
+func (repo *PostgresAuthRepository) CreateAPIKey(key auth.APIKey) error {
+	var expiresAt *time.Time
+	if !key.ExpiresAt.IsZero() {
+		expiresAt = &key.ExpiresAt
+	}
+	_, err := repo.conn.Exec(context.Background(),
+		`INSERT INTO api_keys (id, username, name, prefix, key_hash, scopes, token_version, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		key.ID, key.Username, key.Name, key.Prefix, key.Hash, key.Scopes, key.TokenVersion, key.CreatedAt, expiresAt)
+	return err
+}
+
+// GetAPIKey возвращает ключ по хешу. Для неизвестного хеша - auth.ErrAPIKeyNotFound.
+func (repo *PostgresAuthRepository) GetAPIKey(hash string) (*auth.APIKey, error) {
+	rows, err := repo.conn.Query(context.Background(),
+		`SELECT id, username, name, prefix, key_hash, scopes, token_version, created_at, expires_at
+		FROM api_keys WHERE key_hash = $1`, hash)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := scanAPIKeys(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, auth.ErrAPIKeyNotFound
+	}
+	return &keys[0], nil
+}
+
+// GetUserAPIKeys возвращает ключи пользователя, включая истекшие, начиная с последнего созданного.
+func (repo *PostgresAuthRepository) GetUserAPIKeys(username string) ([]auth.APIKey, error) {
+	rows, err := repo.conn.Query(context.Background(),
+		`SELECT id, username, name, prefix, key_hash, scopes, token_version, created_at, expires_at
+		FROM api_keys WHERE username = $1 ORDER BY created_at DESC`, username)
+	if err != nil {
+		return nil, err
+	}
+	return scanAPIKeys(rows)
+}
+
+// RevokeAPIKey удаляет ключ keyID, если он принадлежит username.
+func (repo *PostgresAuthRepository) RevokeAPIKey(username, keyID string) error {
+	tag, err := repo.conn.Exec(context.Background(),
+		"DELETE FROM api_keys WHERE id = $1 AND username = $2", keyID, username)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return auth.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func scanAPIKeys(rows pgx.Rows) ([]auth.APIKey, error) {
+	defer rows.Close()
+
+	var keys []auth.APIKey
+	for rows.Next() {
+		var key auth.APIKey
+		var expiresAt *time.Time
+		err := rows.Scan(&key.ID, &key.Username, &key.Name, &key.Prefix, &key.Hash, &key.Scopes, &key.TokenVersion,
+			&key.CreatedAt, &expiresAt)
+		if err != nil {
+			return nil, err
+		}
+		if expiresAt != nil {
+			key.ExpiresAt = *expiresAt
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (repo *PostgresAuthRepository) SaveSigningKey(key auth.StoredKey) error {
+	_, err := repo.conn.Exec(context.Background(),
+		`INSERT INTO signing_keys (kid, algorithm, key, encrypted, active, created_at, activate_at, retire_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (kid) DO UPDATE
+		SET key = EXCLUDED.key, encrypted = EXCLUDED.encrypted, active = EXCLUDED.active, retire_at = EXCLUDED.retire_at`,
+		key.ID, key.Algorithm, key.Key, key.Encrypted, key.Active, key.CreatedAt, key.ActivateAt, key.RetireAt)
+	return err
+}
+
+func (repo *PostgresAuthRepository) GetSigningKeys() ([]auth.StoredKey, error) {
+	rows, err := repo.conn.Query(context.Background(),
+		"SELECT kid, algorithm, key, encrypted, active, created_at, activate_at, retire_at FROM signing_keys ORDER BY created_at")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []auth.StoredKey
+	for rows.Next() {
+		var key auth.StoredKey
+		if err := rows.Scan(&key.ID, &key.Algorithm, &key.Key, &key.Encrypted, &key.Active, &key.CreatedAt, &key.ActivateAt, &key.RetireAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (repo *PostgresAuthRepository) DeleteRetiredSigningKeys(now time.Time) error {
+	_, err := repo.conn.Exec(context.Background(),
+		"DELETE FROM signing_keys WHERE retire_at < $1", now)
+	return err
+}
+
+func (repo *PostgresAuthRepository) CreateTokenFamily(familyID, username, refreshJTI string, expiration time.Time) error {
+	_, err := repo.conn.Exec(context.Background(),
+		"INSERT INTO token_families (family_id, username, current_jti, expires_at) VALUES ($1, $2, $3, $4)",
+		familyID, username, refreshJTI, expiration)
+	return err
+}
+
+// RotateTokenFamily атомарно заменяет текущий refresh-токен семейства.
+// Если oldJTI уже не является текущим, возвращается repository.ErrTokenReused.
+func (repo *PostgresAuthRepository) RotateTokenFamily(familyID, oldJTI, newJTI string, expiration time.Time) error {
+	tag, err := repo.conn.Exec(context.Background(),
+		`UPDATE token_families SET current_jti = $3, expires_at = $4
+		WHERE family_id = $1 AND current_jti = $2 AND NOT revoked`,
+		familyID, oldJTI, newJTI, expiration)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrTokenReused
+	}
+	return nil
+}
+
+func (repo *PostgresAuthRepository) RevokeTokenFamily(familyID string) error {
+	_, err := repo.conn.Exec(context.Background(),
+		"UPDATE token_families SET revoked = TRUE WHERE family_id = $1", familyID)
+	return err
+}
+
+func (repo *PostgresAuthRepository) IsTokenFamilyRevoked(familyID string) bool {
+	var revoked bool
+	err := repo.conn.QueryRow(context.Background(),
+		"SELECT revoked FROM token_families WHERE family_id = $1", familyID).Scan(&revoked)
+	return err != nil || revoked
+}
+
+func (repo *PostgresAuthRepository) CreateSession(session repository.Session) error {
+	_, err := repo.conn.Exec(context.Background(),
+		`INSERT INTO sessions (family_id, username, ip, user_agent, created_at, last_used_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		session.ID, session.Username, session.IP, session.UserAgent, session.CreatedAt, session.LastUsedAt)
+	return err
+}
+
+func (repo *PostgresAuthRepository) TouchSession(sessionID, ip string, lastUsedAt time.Time) error {
+	_, err := repo.conn.Exec(context.Background(),
+		"UPDATE sessions SET ip = $2, last_used_at = $3 WHERE family_id = $1", sessionID, ip, lastUsedAt)
+	return err
+}
+
+// GetUserSessions возвращает неотозванные и неистекшие сессии пользователя, начиная с последней использованной.
+func (repo *PostgresAuthRepository) GetUserSessions(username string) ([]repository.Session, error) {
+	rows, err := repo.conn.Query(context.Background(),
+		`SELECT s.family_id, s.username, s.ip, s.user_agent, s.created_at, s.last_used_at
+		FROM sessions s JOIN token_families f ON f.family_id = s.family_id
+		WHERE s.username = $1 AND NOT f.revoked AND f.expires_at > NOW()
+		ORDER BY s.last_used_at DESC`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []repository.Session
+	for rows.Next() {
+		var session repository.Session
+		err := rows.Scan(&session.ID, &session.Username, &session.IP, &session.UserAgent, &session.CreatedAt, &session.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeSession отзывает семейство токенов сессии, если оно принадлежит username.
+func (repo *PostgresAuthRepository) RevokeSession(username, sessionID string) error {
+	tag, err := repo.conn.Exec(context.Background(),
+		"UPDATE token_families SET revoked = TRUE WHERE family_id = $1 AND username = $2 AND NOT revoked",
+		sessionID, username)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeOtherSessions отзывает все семейства токенов пользователя, кроме currentSessionID.
+func (repo *PostgresAuthRepository) RevokeOtherSessions(username, currentSessionID string) error {
+	_, err := repo.conn.Exec(context.Background(),
+		"UPDATE token_families SET revoked = TRUE WHERE username = $1 AND family_id <> $2 AND NOT revoked",
+		username, currentSessionID)
+	return err
+}
+
+func (repo *PostgresAuthRepository) GetUserRoles(username string) ([]string, error) {
+	rows, err := repo.conn.Query(context.Background(),
+		"SELECT role FROM user_roles WHERE username = $1 ORDER BY role", username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []string
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+// SetUserRoles заменяет все роли пользователя на roles.
+func (repo *PostgresAuthRepository) SetUserRoles(username string, roles []string) error {
+	ctx := context.Background()
+	tx, err := repo.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "DELETE FROM user_roles WHERE username = $1", username); err != nil {
+		return err
+	}
+	for _, role := range roles {
+		_, err := tx.Exec(ctx,
+			"INSERT INTO user_roles (username, role) VALUES ($1, $2) ON CONFLICT DO NOTHING", username, role)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (repo *PostgresAuthRepository) CreateClient(client repository.OAuthClient) error {
+	_, err := repo.conn.Exec(context.Background(),
+		`INSERT INTO oauth_clients (client_id, secret_hash, scopes, redirect_uris, exchange_subjects, exchange_audiences)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		client.ID, client.SecretHash, client.Scopes, client.RedirectURIs, client.ExchangeSubjects, client.ExchangeAudiences)
 	return err
 }
 
-func (repo *PostgresAuthRepository) ValidateToken(tokenString string) (*auth.Claims, error) {
-	return auth.ValidateToken(tokenString)
+func (repo *PostgresAuthRepository) GetClient(clientID string) (*repository.OAuthClient, error) {
+	client := &repository.OAuthClient{}
+	err := repo.conn.QueryRow(context.Background(),
+		`SELECT client_id, secret_hash, scopes, redirect_uris, exchange_subjects, exchange_audiences
+		FROM oauth_clients WHERE client_id = $1`, clientID).
+		Scan(&client.ID, &client.SecretHash, &client.Scopes, &client.RedirectURIs, &client.ExchangeSubjects,
+			&client.ExchangeAudiences)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func (repo *PostgresAuthRepository) AuditTokenExchange(exchange repository.TokenExchange) error {
+	_, err := repo.conn.Exec(context.Background(),
+		`INSERT INTO token_exchange_audit (client_id, subject, actor, scopes, audience, token_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		exchange.ClientID, exchange.Subject, exchange.Actor, exchange.Scopes, exchange.Audience, exchange.TokenID, exchange.CreatedAt)
+	return err
+}
+
+// SavePasswordReset сохраняет токен сброса пароля, заменяя предыдущий токен пользователя, если
+// тот истек или выпущен не меньше чем за cooldown до нового. Иначе - repository.ErrPasswordResetTooSoon.
+func (repo *PostgresAuthRepository) SavePasswordReset(reset repository.PasswordReset, cooldown time.Duration) error {
+	tag, err := repo.conn.Exec(context.Background(),
+		`INSERT INTO password_resets (username, token_hash, created_at, expires_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (username) DO UPDATE
+		SET token_hash = EXCLUDED.token_hash, created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at
+		WHERE password_resets.expires_at <= EXCLUDED.created_at OR password_resets.created_at <= $5`,
+		reset.Username, reset.TokenHash, reset.CreatedAt, reset.ExpiresAt, reset.CreatedAt.Add(-cooldown))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrPasswordResetTooSoon
+	}
+	return nil
+}
+
+func (repo *PostgresAuthRepository) GetPasswordReset(tokenHash string) (*repository.PasswordReset, error) {
+	reset := &repository.PasswordReset{}
+	err := repo.conn.QueryRow(context.Background(),
+		"SELECT token_hash, username, created_at, expires_at FROM password_resets WHERE token_hash = $1", tokenHash).
+		Scan(&reset.TokenHash, &reset.Username, &reset.CreatedAt, &reset.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, repository.ErrResetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reset, nil
+}
+
+// ConsumePasswordReset удаляет токен и возвращает его данные, поэтому токен можно использовать только один раз.
+func (repo *PostgresAuthRepository) ConsumePasswordReset(tokenHash string) (*repository.PasswordReset, error) {
+	reset := &repository.PasswordReset{}
+	err := repo.conn.QueryRow(context.Background(),
+		"DELETE FROM password_resets WHERE token_hash = $1 RETURNING token_hash, username, created_at, expires_at", tokenHash).
+		Scan(&reset.TokenHash, &reset.Username, &reset.CreatedAt, &reset.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, repository.ErrResetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reset, nil
+}
+
+// SaveTOTPSecret сохраняет новый неподтвержденный секрет пользователя, заменяя предыдущий.
+// Подтвержденный секрет не заменяется (ErrTOTPEnabled): сначала его нужно удалить.
+func (repo *PostgresAuthRepository) SaveTOTPSecret(secret repository.TOTPSecret) error {
+	tag, err := repo.conn.Exec(context.Background(),
+		`INSERT INTO totp_secrets (username, secret, confirmed, last_step, created_at) VALUES ($1, $2, FALSE, 0, $3)
+		ON CONFLICT (username) DO UPDATE
+		SET secret = EXCLUDED.secret, last_step = 0, created_at = EXCLUDED.created_at
+		WHERE NOT totp_secrets.confirmed`,
+		secret.Username, secret.Secret, secret.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrTOTPEnabled
+	}
+	return nil
+}
+
+func (repo *PostgresAuthRepository) GetTOTPSecret(username string) (*repository.TOTPSecret, error) {
+	secret := &repository.TOTPSecret{}
+	err := repo.conn.QueryRow(context.Background(),
+		"SELECT username, secret, confirmed, last_step, created_at FROM totp_secrets WHERE username = $1", username).
+		Scan(&secret.Username, &secret.Secret, &secret.Confirmed, &secret.LastStep, &secret.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, repository.ErrTOTPNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// ConfirmTOTPSecret включает TOTP пользователя. Код подтверждения с шагом step
+// считается использованным.
+func (repo *PostgresAuthRepository) ConfirmTOTPSecret(username string, step int64) error {
+	tag, err := repo.conn.Exec(context.Background(),
+		"UPDATE totp_secrets SET confirmed = TRUE, last_step = $2 WHERE username = $1 AND NOT confirmed", username, step)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrTOTPNotFound
+	}
+	return nil
+}
+
+// UseTOTPStep отмечает код шага step использованным и сбрасывает счетчик неверных кодов.
+// Проверка и запись выполняются одним запросом, поэтому один код не пройдет в двух
+// параллельных запросах.
+func (repo *PostgresAuthRepository) UseTOTPStep(username string, step int64) error {
+	tag, err := repo.conn.Exec(context.Background(),
+		"UPDATE totp_secrets SET last_step = $2, failed_attempts = 0 WHERE username = $1 AND confirmed AND last_step < $2",
+		username, step)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrTOTPCodeUsed
+	}
+	return nil
+}
+
+// RecordTOTPAttempt заранее засчитывает попытку ввода кода TOTP как неверную; успешный
+// UseTOTPStep сбрасывает счетчик. После maxFailures неверных кодов следующая попытка
+// разрешается не раньше, чем через lockout после последней. Проверка и запись выполняются
+// одним запросом, поэтому параллельные запросы не обходят ограничение.
+func (repo *PostgresAuthRepository) RecordTOTPAttempt(username string, now time.Time, maxFailures int, lockout time.Duration) error {
+	tag, err := repo.conn.Exec(context.Background(),
+		`UPDATE totp_secrets SET failed_attempts = failed_attempts + 1, last_failure_at = $2
+		WHERE username = $1 AND confirmed AND (failed_attempts < $3 OR last_failure_at <= $4)`,
+		username, now, maxFailures, now.Add(-lockout))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repository.ErrTOTPLocked
+	}
+	return nil
+}
+
+func (repo *PostgresAuthRepository) DeleteTOTPSecret(username string) error {
+	_, err := repo.conn.Exec(context.Background(),
+		"DELETE FROM totp_secrets WHERE username = $1", username)
+	return err
+}
+
+func (repo *PostgresAuthRepository) SaveMFAChallenge(challenge repository.MFAChallenge) error {
+	_, err := repo.conn.Exec(context.Background(),
+		"INSERT INTO mfa_challenges (token_hash, username, attempts, created_at, expires_at) VALUES ($1, $2, 0, $3, $4)",
+		challenge.TokenHash, challenge.Username, challenge.CreatedAt, challenge.ExpiresAt)
+	return err
+}
+
+func (repo *PostgresAuthRepository) GetMFAChallenge(tokenHash string) (*repository.MFAChallenge, error) {
+	challenge := &repository.MFAChallenge{}
+	err := repo.conn.QueryRow(context.Background(),
+		"SELECT token_hash, username, attempts, created_at, expires_at FROM mfa_challenges WHERE token_hash = $1", tokenHash).
+		Scan(&challenge.TokenHash, &challenge.Username, &challenge.Attempts, &challenge.CreatedAt, &challenge.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, repository.ErrChallengeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// FailMFAChallenge увеличивает число неверных попыток и возвращает новое значение.
+func (repo *PostgresAuthRepository) FailMFAChallenge(tokenHash string) (int, error) {
+	var attempts int
+	err := repo.conn.QueryRow(context.Background(),
+		"UPDATE mfa_challenges SET attempts = attempts + 1 WHERE token_hash = $1 RETURNING attempts", tokenHash).
+		Scan(&attempts)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, repository.ErrChallengeNotFound
+	}
+	return attempts, err
+}
+
+// ConsumeMFAChallenge удаляет challenge и возвращает его данные, поэтому его можно использовать только один раз.
+func (repo *PostgresAuthRepository) ConsumeMFAChallenge(tokenHash string) (*repository.MFAChallenge, error) {
+	challenge := &repository.MFAChallenge{}
+	err := repo.conn.QueryRow(context.Background(),
+		"DELETE FROM mfa_challenges WHERE token_hash = $1 RETURNING token_hash, username, attempts, created_at, expires_at", tokenHash).
+		Scan(&challenge.TokenHash, &challenge.Username, &challenge.Attempts, &challenge.CreatedAt, &challenge.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, repository.ErrChallengeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+func (repo *PostgresAuthRepository) SaveAuthorizationCode(code repository.AuthorizationCode) error {
+	_, err := repo.conn.Exec(context.Background(),
+		`INSERT INTO authorization_codes (code_hash, client_id, username, redirect_uri, scopes, code_challenge, nonce, auth_time, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		code.CodeHash, code.ClientID, code.Username, code.RedirectURI, code.Scopes, code.CodeChallenge, code.Nonce, code.AuthTime, code.ExpiresAt)
+	return err
+}
+
+// ConsumeAuthorizationCode удаляет код и возвращает его данные, поэтому код можно использовать только один раз.
+func (repo *PostgresAuthRepository) ConsumeAuthorizationCode(codeHash string) (*repository.AuthorizationCode, error) {
+	code := &repository.AuthorizationCode{}
+	err := repo.conn.QueryRow(context.Background(),
+		`DELETE FROM authorization_codes WHERE code_hash = $1
+		RETURNING code_hash, client_id, username, redirect_uri, scopes, code_challenge, nonce, auth_time, expires_at`, codeHash).
+		Scan(&code.CodeHash, &code.ClientID, &code.Username, &code.RedirectURI, &code.Scopes, &code.CodeChallenge,
+			&code.Nonce, &code.AuthTime, &code.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return code, nil
 }
@@ -1,16 +1,224 @@
 package repository
 
 import (
+	"errors"
+	"slices"
 	"time"
 
 	"github.com/SergeyIvanovDevelop/tss-tools/pkg/authserv/auth"
 )
 
+// ErrTokenReused возвращается RotateTokenFamily, если предъявленный refresh-токен
+// уже был обменян или его семейство отозвано.
+var ErrTokenReused = errors.New("refresh token has already been used")
+
+// ErrResetNotFound возвращается для неизвестного или уже использованного токена сброса пароля.
+var ErrResetNotFound = errors.New("password reset token not found")
+
+// ErrVerificationNotFound возвращается для неизвестного или уже использованного токена подтверждения адреса.
+var ErrVerificationNotFound = errors.New("email verification token not found")
+
+// ErrEmailTaken возвращается MarkEmailVerified, если адрес уже подтвержден другим пользователем.
+// Неподтвержденный адрес может указать кто угодно, поэтому уникальны только подтвержденные адреса.
+var ErrEmailTaken = errors.New("email is already taken")
+
+// ErrTOTPNotFound возвращается, если пользователь не начинал подключение TOTP.
+var ErrTOTPNotFound = errors.New("totp secret not found")
+
+// ErrTOTPEnabled возвращается SaveTOTPSecret, если у пользователя уже включен TOTP.
+var ErrTOTPEnabled = errors.New("totp is already enabled")
+
+// ErrTOTPCodeUsed возвращается UseTOTPStep, если код этого или более позднего шага уже использован.
+var ErrTOTPCodeUsed = errors.New("totp code has already been used")
+
+// ErrTOTPLocked возвращается RecordTOTPAttempt, если проверка кодов TOTP пользователя
+// временно заблокирована после серии неверных кодов.
+var ErrTOTPLocked = errors.New("too many failed totp attempts")
+
+// ErrChallengeNotFound возвращается для неизвестного или уже использованного MFA challenge.
+var ErrChallengeNotFound = errors.New("mfa challenge not found")
+
+// ErrPasswordResetTooSoon возвращается SavePasswordReset, если действующий токен пользователя
+// выпущен недавно и еще не может быть заменен.
+var ErrPasswordResetTooSoon = errors.New("password reset was requested too recently")
+
+// ErrSessionNotFound возвращается RevokeSession, если у пользователя нет такой активной сессии.
+var ErrSessionNotFound = errors.New("session not found")
+
+// ExchangeSubjectUsers в OAuthClient.ExchangeSubjects разрешает обмен токенов, выданных
+// пользователям при входе без OAuth-клиента.
+const ExchangeSubjectUsers = "@users"
+
+// OAuthClient - зарегистрированный OAuth-клиент. SecretHash содержит bcrypt-хеш секрета
+// (пустой у публичных клиентов), Scopes - разрешения, которые клиент может запросить,
+// RedirectURIs - допустимые адреса возврата для authorization code flow.
+// ExchangeSubjects - клиенты, токены которых этот клиент может обменять (RFC 8693),
+// и ExchangeSubjectUsers для токенов пользователей; пустой список запрещает обмен.
+// ExchangeAudiences - значения audience, которые клиент может запросить при обмене.
+type OAuthClient struct {
+	ID                string
+	SecretHash        string
+	Scopes            []string
+	RedirectURIs      []string
+	ExchangeSubjects  []string
+	ExchangeAudiences []string
+}
+
+// MayExchange сообщает, может ли клиент обменять токен с claims subject.
+func (c *OAuthClient) MayExchange(subject *auth.Claims) bool {
+	owner := subject.ClientID
+	if owner == "" {
+		owner = ExchangeSubjectUsers
+	}
+	return slices.Contains(c.ExchangeSubjects, owner)
+}
+
+// MayRequestAudience сообщает, может ли клиент получить обменом токен для всех audience.
+func (c *OAuthClient) MayRequestAudience(audience []string) bool {
+	for _, aud := range audience {
+		if !slices.Contains(c.ExchangeAudiences, aud) {
+			return false
+		}
+	}
+	return true
+}
+
+// TokenExchange - запись журнала обмена токенов: клиент ClientID получил токен TokenID
+// субъекта Subject, с которым действует Actor.
+type TokenExchange struct {
+	ClientID  string
+	Subject   string
+	Actor     string
+	Scopes    []string
+	Audience  []string
+	TokenID   string
+	CreatedAt time.Time
+}
+
+// AuthorizationCode - одноразовый код авторизации. Хранится только SHA-256 хеш кода.
+type AuthorizationCode struct {
+	CodeHash      string
+	ClientID      string
+	Username      string
+	RedirectURI   string
+	Scopes        []string
+	CodeChallenge string
+	// Nonce и AuthTime переносятся в ID Token (OpenID Connect Core 1.0, 3.1.3.6).
+	Nonce     string
+	AuthTime  time.Time
+	ExpiresAt time.Time
+}
+
+// Session - вход пользователя. ID совпадает с идентификатором семейства токенов,
+// поэтому отзыв сессии отзывает все ее токены.
+type Session struct {
+	ID         string
+	Username   string
+	IP         string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+// PasswordReset - токен сброса пароля. Хранится только SHA-256 хеш токена; у пользователя
+// может быть только один действующий токен.
+type PasswordReset struct {
+	TokenHash string
+	Username  string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// EmailVerification - токен подтверждения адреса Email пользователя. Хранится только SHA-256
+// хеш токена; у пользователя может быть только один действующий токен.
+type EmailVerification struct {
+	TokenHash string
+	Username  string
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// TOTPSecret - секрет TOTP пользователя, зашифрованный totp.Cipher. Неподтвержденный секрет
+// не включает двухфакторную аутентификацию. LastStep - шаг последнего принятого кода.
+type TOTPSecret struct {
+	Username  string
+	Secret    []byte
+	Confirmed bool
+	LastStep  int64
+	CreatedAt time.Time
+}
+
+// MFAChallenge - выданный после проверки пароля токен второго шага входа. Хранится только
+// SHA-256 хеш токена. Attempts - число неверных кодов, предъявленных с этим токеном.
+type MFAChallenge struct {
+	TokenHash string
+	Username  string
+	Attempts  int
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// UserProfile - данные пользователя для OpenID Connect userinfo.
+type UserProfile struct {
+	Username      string
+	Name          string
+	Email         string
+	EmailVerified bool
+	UpdatedAt     time.Time
+}
+
 type AuthRepository interface {
-	CreateUser(username, password string) error
+	CreateUser(username, password, email string) error
 	GetUser(username string) (string, error)
+	UpdatePassword(username, hashedPassword string) error
+	GetUserProfile(username string) (*UserProfile, error)
+	SetUserEmail(username, email string) error
+	SaveEmailVerification(verification EmailVerification) error
+	ConsumeEmailVerification(tokenHash string) (*EmailVerification, error)
+	MarkEmailVerified(username, email string) error
+	GetTokenVersion(username string) (int64, error)
+	BumpTokenVersion(username string) (int64, error)
 	AddToBlacklist(token string, expiration time.Time) error
 	IsInBlacklist(token string) bool
 	CleanExpiredTokens() error
-	ValidateToken(tokenString string) (*auth.Claims, error)
+	SaveSigningKey(key auth.StoredKey) error
+	GetSigningKeys() ([]auth.StoredKey, error)
+	DeleteRetiredSigningKeys(now time.Time) error
+	CreateTokenFamily(familyID, username, refreshJTI string, expiration time.Time) error
+	RotateTokenFamily(familyID, oldJTI, newJTI string, expiration time.Time) error
+	RevokeTokenFamily(familyID string) error
+	IsTokenFamilyRevoked(familyID string) bool
+	CreateSession(session Session) error
+	TouchSession(sessionID, ip string, lastUsedAt time.Time) error
+	GetUserSessions(username string) ([]Session, error)
+	RevokeSession(username, sessionID string) error
+	RevokeOtherSessions(username, currentSessionID string) error
+	GetUserRoles(username string) ([]string, error)
+	SetUserRoles(username string, roles []string) error
+	CreateClient(client OAuthClient) error
+	GetClient(clientID string) (*OAuthClient, error)
+	SaveAuthorizationCode(code AuthorizationCode) error
+	ConsumeAuthorizationCode(codeHash string) (*AuthorizationCode, error)
+	SaveOpaqueToken(token auth.OpaqueToken) error
+	GetOpaqueToken(hash string) (*auth.OpaqueToken, error)
+	DeleteOpaqueToken(hash string) error
+	CreateAPIKey(key auth.APIKey) error
+	GetAPIKey(hash string) (*auth.APIKey, error)
+	GetUserAPIKeys(username string) ([]auth.APIKey, error)
+	RevokeAPIKey(username, keyID string) error
+	AuditTokenExchange(exchange TokenExchange) error
+	SavePasswordReset(reset PasswordReset, cooldown time.Duration) error
+	GetPasswordReset(tokenHash string) (*PasswordReset, error)
+	ConsumePasswordReset(tokenHash string) (*PasswordReset, error)
+	SaveTOTPSecret(secret TOTPSecret) error
+	GetTOTPSecret(username string) (*TOTPSecret, error)
+	ConfirmTOTPSecret(username string, step int64) error
+	UseTOTPStep(username string, step int64) error
+	RecordTOTPAttempt(username string, now time.Time, maxFailures int, lockout time.Duration) error
+	DeleteTOTPSecret(username string) error
+	SaveMFAChallenge(challenge MFAChallenge) error
+	GetMFAChallenge(tokenHash string) (*MFAChallenge, error)
+	FailMFAChallenge(tokenHash string) (int, error)
+	ConsumeMFAChallenge(tokenHash string) (*MFAChallenge, error)
 }
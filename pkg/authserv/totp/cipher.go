@@ -0,0 +1,59 @@
+package totp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// KeySize - размер ключа шифрования секретов (AES-256).
+const KeySize = 32
+
+// ErrDecrypt возвращается, если секрет не удалось расшифровать: ключ не тот или данные повреждены.
+var ErrDecrypt = errors.New("could not decrypt totp secret")
+
+// Cipher шифрует секреты TOTP для хранения в репозитории (AES-256-GCM). Имя пользователя
+// входит в аутентифицируемые данные, поэтому секрет одного пользователя нельзя подставить другому.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher создает Cipher с ключом key длиной KeySize байт.
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("totp encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// Encrypt шифрует секрет пользователя username. Результат начинается со случайного nonce.
+func (c *Cipher) Encrypt(username, secret string) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, []byte(secret), []byte(username)), nil
+}
+
+// Decrypt расшифровывает секрет пользователя username, зашифрованный Encrypt.
+func (c *Cipher) Decrypt(username string, data []byte) (string, error) {
+	nonceSize := c.aead.NonceSize()
+	if len(data) < nonceSize {
+		return "", ErrDecrypt
+	}
+	secret, err := c.aead.Open(nil, data[:nonceSize], data[nonceSize:], []byte(username))
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	return string(secret), nil
+}
@@ -0,0 +1,179 @@
+package totp
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Секрет тестовых векторов RFC 6238, приложение B ("12345678901234567890" в base32).
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// Векторы SHA1 из RFC 6238, приложение B. В RFC коды 8-значные, при Digits = 6
+// остаются последние шесть цифр.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCode(t *testing.T) {
+	for _, v := range rfcVectors {
+		code, err := Code(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatalf("T=%d: %v", v.unix, err)
+		}
+		if code != v.code {
+			t.Errorf("T=%d: code = %s, want %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestCodeInvalidSecret(t *testing.T) {
+	for _, secret := range []string{"", "not base32!", "===="} {
+		if _, err := Code(secret, 1); !errors.Is(err, ErrInvalidSecret) {
+			t.Errorf("secret %q: err = %v, want ErrInvalidSecret", secret, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", rfcSecret, "050471", step, true},
+		{"lowercase secret with padding", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq====", "050471", step, true},
+		{"surrounding spaces", rfcSecret, " 050471 ", step, true},
+		{"previous step", rfcSecret, mustCode(t, step-1), step - 1, true},
+		{"next step", rfcSecret, mustCode(t, step+1), step + 1, true},
+		{"outside skew", rfcSecret, mustCode(t, step-Skew-1), 0, false},
+		{"wrong code", rfcSecret, "000000", 0, false},
+		{"short code", rfcSecret, "05047", 0, false},
+		{"long code", rfcSecret, "0504710", 0, false},
+		{"empty code", rfcSecret, "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok, err := Validate(tt.secret, tt.code, now)
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("Validate = (%d, %v), want (%d, %v)", gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := decodeSecret(secret)
+	if err != nil {
+		t.Fatalf("decode %q: %v", secret, err)
+	}
+	if len(key) != SecretSize {
+		t.Errorf("secret size = %d, want %d", len(key), SecretSize)
+	}
+	other, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == secret {
+		t.Error("GenerateSecret returned the same secret twice")
+	}
+}
+
+func TestCipher(t *testing.T) {
+	c, err := NewCipher(bytes.Repeat([]byte("k"), KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewCipher(bytes.Repeat([]byte("o"), KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := c.Encrypt("alice", rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := c.Encrypt("alice", rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(data, again) {
+		t.Error("Encrypt reused a nonce")
+	}
+	if bytes.Contains(data, []byte(rfcSecret)) {
+		t.Error("ciphertext contains the plain secret")
+	}
+
+	tampered := append([]byte(nil), data...)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name     string
+		cipher   *Cipher
+		username string
+		data     []byte
+		wantErr  bool
+	}{
+		{"round trip", c, "alice", data, false},
+		{"other user", c, "bob", data, true},
+		{"other key", other, "alice", data, true},
+		{"tampered", c, "alice", tampered, true},
+		{"truncated", c, "alice", data[:4], true},
+		{"empty", c, "alice", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret, err := tt.cipher.Decrypt(tt.username, tt.data)
+			if tt.wantErr {
+				if !errors.Is(err, ErrDecrypt) {
+					t.Errorf("Decrypt err = %v, want ErrDecrypt", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decrypt: %v", err)
+			}
+			if secret != rfcSecret {
+				t.Errorf("Decrypt = %q, want %q", secret, rfcSecret)
+			}
+		})
+	}
+}
+
+func TestNewCipherKeySize(t *testing.T) {
+	for _, size := range []int{0, 16, KeySize - 1, KeySize + 1} {
+		if _, err := NewCipher(make([]byte, size)); err == nil {
+			t.Errorf("NewCipher accepted a %d-byte key", size)
+		}
+	}
+}
+
+func mustCode(t *testing.T, step int64) string {
+	t.Helper()
+	code, err := Code(rfcSecret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}